@@ -0,0 +1,80 @@
+package main
+
+import (
+	"context"
+	"os"
+	"os/user"
+
+	"github.com/abcxyz/pkg/logging"
+
+	"github.com/yolocs/ar-terraform-registry/pkg/audit"
+	"github.com/yolocs/ar-terraform-registry/pkg/config"
+	"github.com/yolocs/ar-terraform-registry/pkg/notify"
+)
+
+// newAuditLogger creates the configured audit sinks, including the webhook
+// notifier, which is also returned. The logger is nil if nothing is
+// configured.
+func newAuditLogger(ctx context.Context, cfg *config.Config) (*audit.Logger, *notify.Notifier, error) {
+	var sinks []audit.Sink
+	if cfg.AuditLogFile != "" {
+		s, err := audit.NewFileSink(cfg.AuditLogFile)
+		if err != nil {
+			return nil, nil, err
+		}
+		sinks = append(sinks, s)
+	}
+	if cfg.AuditLogStdout {
+		sinks = append(sinks, audit.NewWriterSink(os.Stdout))
+	}
+	if cfg.AuditWebhookURL != "" {
+		sinks = append(sinks, audit.NewWebhookSink(&audit.WebhookConfig{
+			URL:     cfg.AuditWebhookURL,
+			Headers: cfg.AuditWebhookHeaders,
+			Logger:  logging.FromContext(ctx),
+		}))
+	}
+	var notifier *notify.Notifier
+	if len(cfg.Webhooks) > 0 {
+		deliveries, err := notify.NewDeliveryLog(cfg.WebhookDeliveryLog, 0)
+		if err != nil {
+			return nil, nil, err
+		}
+		hooks := make([]*notify.Hook, 0, len(cfg.Webhooks))
+		for _, w := range cfg.Webhooks {
+			hooks = append(hooks, &notify.Hook{
+				Name:       w.Name,
+				URL:        w.URL,
+				Secret:     w.Secret,
+				Namespaces: w.Namespaces,
+				Events:     w.Events,
+				Headers:    w.Headers,
+			})
+		}
+		notifier = notify.New(&notify.Config{
+			Hooks:       hooks,
+			MaxAttempts: cfg.WebhookMaxAttempts,
+			DeliveryLog: deliveries,
+			Logger:      logging.FromContext(ctx),
+		})
+		sinks = append(sinks, notifier)
+	}
+	if len(sinks) == 0 {
+		return nil, nil, nil
+	}
+	return audit.New(sinks...), notifier, nil
+}
+
+// withCLIAudit attaches the audit logger to ctx and attributes the events of
+// a command to the local user.
+func withCLIAudit(ctx context.Context, cfg *config.Config) (context.Context, *audit.Logger, error) {
+	al, _, err := newAuditLogger(ctx, cfg)
+	if err != nil {
+		return nil, nil, err
+	}
+	principal := "cli"
+	if u, err := user.Current(); err == nil {
+		principal += ":" + u.Username
+	}
+	return audit.WithPrincipal(audit.WithLogger(ctx, al), principal), al, nil
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"context"
+	"fmt"
+
+	ar "cloud.google.com/go/artifactregistry/apiv1"
+
+	"github.com/yolocs/ar-terraform-registry/pkg/config"
+	"github.com/yolocs/ar-terraform-registry/pkg/model"
+	"github.com/yolocs/ar-terraform-registry/pkg/store"
+)
+
+// backend is a store serving both providers and modules.
+type backend interface {
+	model.ProviderStore
+	model.ModuleStore
+}
+
+// backendFactory builds stores from the declared backends. Artifact Registry
+// clients are created on first use and shared across reloads, so they keep
+// the retry policy of the initial config.
+type backendFactory struct {
+	cfg        *config.Config
+	arClient   *ar.Client
+	downloader *store.Downloader
+	uploader   *store.Uploader
+}
+
+// routes creates the configured backends and the routes dispatching to them,
+// along with health checkers for every backend.
+func (f *backendFactory) routes(ctx context.Context, cfg *config.Config) ([]*store.Route, map[string]model.HealthChecker, error) {
+	backends, checkers, err := f.backends(ctx, cfg)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	routes := make([]*store.Route, 0, len(cfg.Routes))
+	for _, r := range cfg.Routes {
+		be := backends[r.Backend]
+		routes = append(routes, &store.Route{
+			Namespace: r.Namespace,
+			Providers: be,
+			Modules:   be,
+		})
+	}
+	return routes, checkers, nil
+}
+
+// backends creates the configured backends by name, along with their health
+// checkers.
+func (f *backendFactory) backends(ctx context.Context, cfg *config.Config) (map[string]backend, map[string]model.HealthChecker, error) {
+	checkers := make(map[string]model.HealthChecker)
+	backends := make(map[string]backend, len(cfg.Backends))
+	for _, b := range cfg.Backends {
+		var (
+			be  backend
+			err error
+		)
+		mapping := &store.Mapping{
+			Repositories:    b.Repositories,
+			ModulePackage:   b.ModulePackage,
+			ProviderPackage: b.ProviderPackage,
+		}
+		switch b.Type {
+		case config.BackendArtifactRegistry:
+			if err = f.initArtifactRegistry(ctx); err != nil {
+				break
+			}
+			checkers["downloader"] = f.downloader
+			be, err = store.NewArtifactRegistryGeneric(&store.Config{
+				ProjectID:              b.ProjectID,
+				Location:               b.Location,
+				ArtifactRegistryClient: f.arClient,
+				Downloader:             f.downloader,
+				Uploader:               f.uploader,
+				Mapping:                mapping,
+			})
+		case config.BackendFilesystem:
+			be, err = store.NewFilesystem(&store.FilesystemConfig{Root: b.Path, Mapping: mapping})
+		case config.BackendProxy:
+			be, err = store.NewProxy(&store.ProxyConfig{URL: b.URL, Mapping: mapping})
+		default:
+			err = fmt.Errorf("unknown backend type %q", b.Type)
+		}
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to create backend %q: %w", b.Name, err)
+		}
+
+		backends[b.Name] = be
+		if hc, ok := be.(model.HealthChecker); ok {
+			checkers["backend:"+b.Name] = hc
+		}
+	}
+	return backends, checkers, nil
+}
+
+// initArtifactRegistry creates the Artifact Registry clients, so credentials
+// are only required when an Artifact Registry backend is configured.
+func (f *backendFactory) initArtifactRegistry(ctx context.Context) error {
+	if f.arClient != nil {
+		return nil
+	}
+
+	retry := &store.RetryConfig{
+		MaxAttempts:    f.cfg.RetryMaxAttempts,
+		InitialBackoff: f.cfg.RetryInitialBackoff,
+		MaxBackoff:     f.cfg.RetryMaxBackoff,
+		Timeout:        f.cfg.CallTimeout,
+	}
+	downloader, err := store.NewDownloader(ctx, retry)
+	if err != nil {
+		return err
+	}
+	arClient, err := store.NewArtifactRegistryClient(ctx, retry)
+	if err != nil {
+		return err
+	}
+	uploader, err := store.NewUploader(ctx)
+	if err != nil {
+		return err
+	}
+	f.downloader, f.arClient, f.uploader = downloader, arClient, uploader
+	return nil
+}
@@ -0,0 +1,162 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/abcxyz/pkg/logging"
+
+	"github.com/yolocs/ar-terraform-registry/pkg/bundle"
+	"github.com/yolocs/ar-terraform-registry/pkg/config"
+	"github.com/yolocs/ar-terraform-registry/pkg/store"
+)
+
+const bundleUsage = `Usage:
+  registry bundle export -o <file> [-provider <ns>/<name>[@<constraints>]]... [-module <ns>/<name>/<system>[@<constraints>]]...
+  registry bundle import <file>
+
+The backends are taken from the server config (CONFIG_FILE and environment).
+Use "-" as file for stdout or stdin.`
+
+// stringsFlag collects the values of a repeated flag.
+type stringsFlag []string
+
+func (f *stringsFlag) String() string { return strings.Join(*f, ",") }
+
+func (f *stringsFlag) Set(v string) error {
+	*f = append(*f, v)
+	return nil
+}
+
+// bundleMain runs the "bundle export" and "bundle import" commands.
+func bundleMain(ctx context.Context, args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("missing bundle command\n%s", bundleUsage)
+	}
+	switch args[0] {
+	case "export":
+		return bundleExport(ctx, args[1:])
+	case "import":
+		return bundleImport(ctx, args[1:])
+	default:
+		return fmt.Errorf("unknown bundle command %q\n%s", args[0], bundleUsage)
+	}
+}
+
+func bundleExport(ctx context.Context, args []string) error {
+	logger := logging.FromContext(ctx)
+
+	fs := flag.NewFlagSet("bundle export", flag.ContinueOnError)
+	out := fs.String("o", "", "bundle file to write")
+	var providers, modules stringsFlag
+	fs.Var(&providers, "provider", "provider to export, `<ns>/<name>[@<constraints>]`; repeatable")
+	fs.Var(&modules, "module", "module to export, `<ns>/<name>/<system>[@<constraints>]`; repeatable")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *out == "" || fs.NArg() > 0 {
+		return fmt.Errorf("invalid arguments\n%s", bundleUsage)
+	}
+
+	sel, err := bundle.ParseSelection(providers, modules)
+	if err != nil {
+		return err
+	}
+	if len(sel.Providers) == 0 && len(sel.Modules) == 0 {
+		return fmt.Errorf("nothing to export\n%s", bundleUsage)
+	}
+
+	router, _, err := loadRouter(ctx)
+	if err != nil {
+		return err
+	}
+
+	w := os.Stdout
+	if *out != "-" {
+		if w, err = os.Create(*out); err != nil {
+			return fmt.Errorf("failed to create bundle: %w", err)
+		}
+		defer w.Close()
+	}
+
+	m, err := bundle.Export(ctx, w, router, sel)
+	if err == nil && w != os.Stdout {
+		err = w.Close()
+	}
+	if err != nil {
+		if w != os.Stdout {
+			os.Remove(*out)
+		}
+		return fmt.Errorf("failed to export bundle: %w", err)
+	}
+
+	logger.InfoContext(ctx, "bundle exported",
+		"file", *out,
+		"providers", len(m.Providers),
+		"modules", len(m.Modules))
+	return nil
+}
+
+func bundleImport(ctx context.Context, args []string) error {
+	logger := logging.FromContext(ctx)
+
+	fs := flag.NewFlagSet("bundle import", flag.ContinueOnError)
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		return fmt.Errorf("invalid arguments\n%s", bundleUsage)
+	}
+
+	router, cfg, err := loadRouter(ctx)
+	if err != nil {
+		return err
+	}
+	ctx, auditLogger, err := withCLIAudit(ctx, cfg)
+	if err != nil {
+		return err
+	}
+	defer auditLogger.Close()
+
+	var r io.Reader = os.Stdin
+	if fs.Arg(0) != "-" {
+		f, err := os.Open(fs.Arg(0))
+		if err != nil {
+			return fmt.Errorf("failed to open bundle: %w", err)
+		}
+		defer f.Close()
+		r = f
+	}
+
+	res, err := bundle.Import(ctx, r, router)
+	if err != nil {
+		return err
+	}
+	logger.InfoContext(ctx, "bundle imported",
+		"providers", res.Providers,
+		"modules", res.Modules,
+		"skipped_existing", res.Skipped)
+	return nil
+}
+
+// loadRouter loads the config and builds the configured backends and routes.
+func loadRouter(ctx context.Context) (*store.Router, *config.Config, error) {
+	cfg, err := config.Load(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+	factory := &backendFactory{cfg: cfg}
+	routes, _, err := factory.routes(ctx, cfg)
+	if err != nil {
+		return nil, nil, err
+	}
+	router, err := store.NewRouter(routes)
+	if err != nil {
+		return nil, nil, err
+	}
+	return router, cfg, nil
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/yolocs/ar-terraform-registry/pkg/conformance"
+)
+
+const conformanceUsage = `Usage:
+  registry conformance [-dir <dir>]
+
+Serves a filesystem store seeded with fixtures and checks the responses
+against the service discovery, module registry and provider registry
+protocols.`
+
+// conformanceMain runs the "conformance" command.
+func conformanceMain(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("conformance", flag.ContinueOnError)
+	dir := fs.String("dir", "", "store directory to seed and keep, must be empty; defaults to a temporary one")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() > 0 {
+		return fmt.Errorf("invalid arguments\n%s", conformanceUsage)
+	}
+
+	report, err := conformance.Run(ctx, &conformance.Config{Dir: *dir})
+	if err != nil {
+		return err
+	}
+	for _, res := range report.Results {
+		if res.Err != nil {
+			fmt.Fprintf(os.Stdout, "FAIL %s\n    %s\n", res.Name, indent(res.Err.Error()))
+			continue
+		}
+		fmt.Fprintf(os.Stdout, "PASS %s\n", res.Name)
+	}
+	if failed := report.Failed(); len(failed) > 0 {
+		return fmt.Errorf("%d of %d conformance checks failed", len(failed), len(report.Results))
+	}
+	return nil
+}
+
+func indent(s string) string {
+	return strings.ReplaceAll(s, "\n", "\n    ")
+}
@@ -2,19 +2,29 @@ package main
 
 import (
 	"context"
+	"maps"
 	"os"
 	"os/signal"
 	"syscall"
 
-	ar "cloud.google.com/go/artifactregistry/apiv1"
 	"github.com/abcxyz/pkg/logging"
 
 	"github.com/yolocs/ar-terraform-registry/internal/version"
+	"github.com/yolocs/ar-terraform-registry/pkg/audit"
 	"github.com/yolocs/ar-terraform-registry/pkg/config"
+	"github.com/yolocs/ar-terraform-registry/pkg/model"
 	"github.com/yolocs/ar-terraform-registry/pkg/server"
+	"github.com/yolocs/ar-terraform-registry/pkg/stats"
 	"github.com/yolocs/ar-terraform-registry/pkg/store"
 )
 
+// commands are the subcommands of the registry binary.
+var commands = map[string]func(context.Context, []string) error{
+	"bundle":      bundleMain,
+	"conformance": conformanceMain,
+	"sync":        syncMain,
+}
+
 func main() {
 	ctx, done := signal.NotifyContext(context.Background(),
 		syscall.SIGINT, syscall.SIGTERM)
@@ -23,6 +33,18 @@ func main() {
 	logger := logging.NewFromEnv("")
 	ctx = logging.WithLogger(ctx, logger)
 
+	// Subcommands run once instead of serving.
+	if len(os.Args) > 1 {
+		if cmd, ok := commands[os.Args[1]]; ok {
+			if err := cmd(ctx, os.Args[2:]); err != nil {
+				done()
+				logger.ErrorContext(ctx, err.Error())
+				os.Exit(1)
+			}
+			return
+		}
+	}
+
 	if err := realMain(ctx); err != nil {
 		done()
 		logger.ErrorContext(ctx, err.Error())
@@ -44,36 +66,130 @@ func realMain(ctx context.Context) error {
 		return err
 	}
 
-	donwloader, err := store.NewDownloader(ctx)
+	auditLogger, notifier, err := newAuditLogger(ctx, cfg)
 	if err != nil {
 		return err
 	}
+	defer auditLogger.Close()
+	ctx = audit.WithLogger(ctx, auditLogger)
 
-	arClient, err := ar.NewClient(ctx)
+	factory := &backendFactory{cfg: cfg}
+	routes, healthCheckers, err := factory.routes(ctx, cfg)
 	if err != nil {
 		return err
 	}
-
-	arStore, err := store.NewArtifactRegistryGeneric(&store.Config{
-		ProjectID:              cfg.ProjectID,
-		Location:               cfg.Location,
-		ArtifactRegistryClient: arClient,
-		Downloader:             donwloader,
-	})
+	if len(cfg.Syncs) > 0 {
+		backends, _, err := factory.backends(ctx, cfg)
+		if err != nil {
+			return err
+		}
+		if err := runSyncJobs(ctx, cfg, backends); err != nil {
+			return err
+		}
+	}
+	router, err := store.NewRouter(routes)
 	if err != nil {
 		return err
 	}
 
+	// Health checkers of stores that aren't reloaded.
+	staticCheckers := make(map[string]model.HealthChecker)
+
+	var modules model.ModuleStore = router
+	if len(cfg.GitModuleRepos) > 0 {
+		gitStore, err := store.NewGitModules(&store.GitConfig{
+			Repos:           cfg.GitModuleRepos,
+			CacheDir:        cfg.GitCacheDir,
+			RefreshInterval: cfg.GitRefreshInterval,
+			ServeArchives:   cfg.GitServeArchives,
+			Fallback:        router,
+		})
+		if err != nil {
+			return err
+		}
+		modules = gitStore
+		staticCheckers["git"] = gitStore
+	}
+	maps.Copy(healthCheckers, staticCheckers)
+
+	var tlsConfig *server.TLSConfig
+	if cfg.TLSCertFile != "" {
+		tlsConfig = &server.TLSConfig{
+			CertFile:          cfg.TLSCertFile,
+			KeyFile:           cfg.TLSKeyFile,
+			ClientCAFile:      cfg.TLSClientCAFile,
+			RequireClientCert: cfg.TLSRequireClientCert,
+		}
+	}
+
+	var adminConfig *server.AdminConfig
+	if cfg.AdminEnabled() {
+		adminConfig = &server.AdminConfig{
+			Store:      router,
+			Tokens:     cfg.AdminTokens,
+			Principals: cfg.AdminPrincipals,
+		}
+	}
+
+	var statsStore *stats.Store
+	if cfg.StatsFile != "" {
+		statsStore, err = stats.Open(&stats.Config{
+			Path:          cfg.StatsFile,
+			FlushInterval: cfg.StatsFlushInterval,
+			Logger:        logger,
+		})
+		if err != nil {
+			return err
+		}
+		defer statsStore.Close()
+	}
+
 	svr, err := server.New(&server.Config{
-		Port:      cfg.Port,
-		Providers: arStore,
-		Modules:   arStore,
-		Logger:    logger,
+		Port:           cfg.Port,
+		Providers:      router,
+		Modules:        modules,
+		Logger:         logger,
+		HealthCheckers: healthCheckers,
+		ReadyTimeout:   cfg.ReadyTimeout,
+		ReadyCacheTTL:  cfg.ReadyCacheTTL,
+		DrainDelay:     cfg.DrainDelay,
+		DrainTimeout:   cfg.DrainTimeout,
+		TLS:            tlsConfig,
+		RateLimit: &server.RateLimitConfig{
+			ClientRPS:         cfg.RateLimitClientRPS,
+			ClientBurst:       cfg.RateLimitClientBurst,
+			NamespaceRPS:      cfg.RateLimitNamespaceRPS,
+			NamespaceBurst:    cfg.RateLimitNamespaceBurst,
+			MaxAssetStreams:   cfg.MaxAssetStreams,
+			TrustForwardedFor: cfg.TrustForwardedFor,
+		},
+
+		Admin:    adminConfig,
+		Audit:    auditLogger,
+		Stats:    statsStore,
+		Webhooks: notifier,
 	})
 	if err != nil {
 		return err
 	}
 
+	go config.Watch(ctx, cfg, func(ctx context.Context, next *config.Config) error {
+		routes, checkers, err := factory.routes(ctx, next)
+		if err != nil {
+			return err
+		}
+		if err := router.SetRoutes(routes); err != nil {
+			return err
+		}
+		maps.Copy(checkers, staticCheckers)
+		svr.SetHealthCheckers(checkers)
+		svr.SetAdminCredentials(next.AdminTokens, next.AdminPrincipals)
+		logger.InfoContext(ctx, "applied reloaded backends and routes",
+			"backends", len(next.Backends),
+			"routes", len(next.Routes))
+		return nil
+	})
+
 	if err := svr.Start(ctx); err != nil {
 		return err
 	}
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"time"
+
+	"github.com/abcxyz/pkg/logging"
+
+	"github.com/yolocs/ar-terraform-registry/pkg/audit"
+	"github.com/yolocs/ar-terraform-registry/pkg/bundle"
+	"github.com/yolocs/ar-terraform-registry/pkg/config"
+)
+
+const syncUsage = `Usage:
+  registry sync -from <backend> -to <backend> [-dry-run] [-provider <ns>/<name>[@<constraints>]]... [-module <ns>/<name>/<system>[@<constraints>]]...
+
+The backends are taken from the server config (CONFIG_FILE and environment).`
+
+// syncMain runs the "sync" command.
+func syncMain(ctx context.Context, args []string) error {
+	logger := logging.FromContext(ctx)
+
+	fs := flag.NewFlagSet("sync", flag.ContinueOnError)
+	from := fs.String("from", "", "source backend")
+	to := fs.String("to", "", "destination backend")
+	dryRun := fs.Bool("dry-run", false, "only report missing versions")
+	var providers, modules stringsFlag
+	fs.Var(&providers, "provider", "provider to sync, `<ns>/<name>[@<constraints>]`; repeatable")
+	fs.Var(&modules, "module", "module to sync, `<ns>/<name>/<system>[@<constraints>]`; repeatable")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *from == "" || *to == "" || *from == *to || fs.NArg() > 0 {
+		return fmt.Errorf("invalid arguments\n%s", syncUsage)
+	}
+	sel, err := bundle.ParseSelection(providers, modules)
+	if err != nil {
+		return err
+	}
+	if len(sel.Providers) == 0 && len(sel.Modules) == 0 {
+		return fmt.Errorf("nothing to sync\n%s", syncUsage)
+	}
+
+	cfg, err := config.Load(ctx)
+	if err != nil {
+		return err
+	}
+	backends, _, err := (&backendFactory{cfg: cfg}).backends(ctx, cfg)
+	if err != nil {
+		return err
+	}
+	src, dst, err := syncBackends(backends, *from, *to)
+	if err != nil {
+		return err
+	}
+	ctx, auditLogger, err := withCLIAudit(ctx, cfg)
+	if err != nil {
+		return err
+	}
+	defer auditLogger.Close()
+
+	summary, err := bundle.Sync(ctx, src, dst, sel, *dryRun)
+	logger.InfoContext(ctx, "sync finished",
+		"from", *from,
+		"to", *to,
+		"dry_run", *dryRun,
+		"summary", summary)
+	return err
+}
+
+func syncBackends(backends map[string]backend, from, to string) (backend, bundle.Store, error) {
+	src, ok := backends[from]
+	if !ok {
+		return nil, nil, fmt.Errorf("unknown backend %q", from)
+	}
+	be, ok := backends[to]
+	if !ok {
+		return nil, nil, fmt.Errorf("unknown backend %q", to)
+	}
+	dst, ok := be.(bundle.Store)
+	if !ok {
+		return nil, nil, fmt.Errorf("backend %q is read-only", to)
+	}
+	return src, dst, nil
+}
+
+// runSyncJobs runs the configured sync jobs until ctx is done. The jobs use
+// the backends of the config the server started with. No job is started if
+// any of them is invalid.
+func runSyncJobs(ctx context.Context, cfg *config.Config, backends map[string]backend) error {
+	logger := logging.FromContext(ctx)
+
+	sels := make([]*bundle.Selection, len(cfg.Syncs))
+	for i, job := range cfg.Syncs {
+		sel, err := bundle.ParseSelection(job.Providers, job.Modules)
+		if err != nil {
+			return fmt.Errorf("syncs[%d]: %w", i, err)
+		}
+		sels[i] = sel
+	}
+
+	for i, job := range cfg.Syncs {
+		sel := sels[i]
+		src, dst, err := syncBackends(backends, job.From, job.To)
+		if err != nil {
+			return fmt.Errorf("syncs[%d]: %w", i, err)
+		}
+
+		ctx := audit.WithPrincipal(ctx, fmt.Sprintf("sync:%s->%s", job.From, job.To))
+		go func() {
+			t := time.NewTicker(job.Interval)
+			defer t.Stop()
+			for {
+				summary, err := bundle.Sync(ctx, src, dst, sel, job.DryRun)
+				if err != nil {
+					logger.ErrorContext(ctx, "sync failed", "from", job.From, "to", job.To, "error", err)
+				}
+				logger.InfoContext(ctx, "sync finished",
+					"from", job.From,
+					"to", job.To,
+					"dry_run", job.DryRun,
+					"checked", summary.Checked,
+					"missing", summary.Missing,
+					"copied", summary.Copied,
+					"failed", summary.Failed)
+
+				select {
+				case <-ctx.Done():
+					return
+				case <-t.C:
+				}
+			}
+		}()
+	}
+	return nil
+}
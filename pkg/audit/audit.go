@@ -0,0 +1,150 @@
+// Package audit records who downloaded, published or deleted which providers
+// and modules.
+package audit
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/abcxyz/pkg/logging"
+)
+
+// Actions.
+const (
+	ActionProviderDownload      = "provider.download"
+	ActionProviderAssetDownload = "provider.asset.download"
+	ActionModuleDownload        = "module.download"
+	ActionModuleArchiveDownload = "module.archive.download"
+	ActionProviderPublish       = "provider.publish"
+	ActionModulePublish         = "module.publish"
+
+	ActionNamespaceList     = "namespace.list"
+	ActionNamespaceCreate   = "namespace.create"
+	ActionPackageList       = "package.list"
+	ActionPackageDelete     = "package.delete"
+	ActionVersionList       = "version.list"
+	ActionVersionFiles      = "version.files"
+	ActionVersionDelete     = "version.delete"
+	ActionVersionYank       = "version.yank"
+	ActionVersionUnyank     = "version.unyank"
+	ActionReportDownloads   = "report.downloads"
+	ActionWebhookDeliveries = "webhook.deliveries"
+)
+
+// Results.
+const (
+	ResultSuccess = "success"
+	ResultFailure = "failure"
+	ResultDenied  = "denied"
+)
+
+// Event is one audited action.
+type Event struct {
+	Time time.Time `json:"time"`
+	// Principal is the authenticated caller, empty for anonymous requests.
+	Principal string `json:"principal,omitempty"`
+	// Auth is how the principal was authenticated, e.g. "mtls" or "token".
+	Auth   string `json:"auth,omitempty"`
+	Action string `json:"action"`
+
+	Namespace string `json:"namespace,omitempty"`
+	// Kind is "provider" or "module".
+	Kind    string `json:"kind,omitempty"`
+	Name    string `json:"name,omitempty"`
+	System  string `json:"system,omitempty"`
+	Version string `json:"version,omitempty"`
+	OS      string `json:"os,omitempty"`
+	Arch    string `json:"arch,omitempty"`
+	// File is the stored file name of asset downloads.
+	File string `json:"file,omitempty"`
+
+	Result string `json:"result"`
+	// Status is the HTTP status of requests.
+	Status int    `json:"status,omitempty"`
+	Error  string `json:"error,omitempty"`
+
+	ClientIP  string `json:"client_ip,omitempty"`
+	UserAgent string `json:"user_agent,omitempty"`
+}
+
+// Sink receives audit events.
+type Sink interface {
+	Write(ctx context.Context, e *Event) error
+	// Close flushes pending events.
+	Close() error
+}
+
+// Logger writes events to its sinks. A nil Logger discards events.
+type Logger struct {
+	sinks []Sink
+}
+
+func New(sinks ...Sink) *Logger {
+	return &Logger{sinks: sinks}
+}
+
+// Emit writes the event to every sink. Sink errors are logged, not returned,
+// so auditing never fails the audited action.
+func (l *Logger) Emit(ctx context.Context, e *Event) {
+	if l == nil {
+		return
+	}
+	if e.Time.IsZero() {
+		e.Time = time.Now().UTC()
+	}
+	for _, s := range l.sinks {
+		if err := s.Write(ctx, e); err != nil {
+			logging.FromContext(ctx).ErrorContext(ctx, "failed to write audit event", "action", e.Action, "error", err)
+		}
+	}
+}
+
+// Close closes the sinks.
+func (l *Logger) Close() error {
+	if l == nil {
+		return nil
+	}
+	var merr error
+	for _, s := range l.sinks {
+		merr = errors.Join(merr, s.Close())
+	}
+	return merr
+}
+
+type (
+	loggerKey    struct{}
+	principalKey struct{}
+)
+
+// WithLogger returns a context carrying the audit logger, for code paths
+// without access to the server's, such as publishing.
+func WithLogger(ctx context.Context, l *Logger) context.Context {
+	return context.WithValue(ctx, loggerKey{}, l)
+}
+
+// FromContext returns the audit logger of the context, or nil.
+func FromContext(ctx context.Context) *Logger {
+	l, _ := ctx.Value(loggerKey{}).(*Logger)
+	return l
+}
+
+// WithPrincipal returns a context attributing the events emitted from it to
+// the principal, e.g. "cli:alice" or "sync:ar->local".
+func WithPrincipal(ctx context.Context, principal string) context.Context {
+	return context.WithValue(ctx, principalKey{}, principal)
+}
+
+// PrincipalFromContext returns the principal set by WithPrincipal.
+func PrincipalFromContext(ctx context.Context) string {
+	p, _ := ctx.Value(principalKey{}).(string)
+	return p
+}
+
+// Result returns the result of an action that returned err.
+func Result(err error) string {
+	if err != nil {
+		return ResultFailure
+	}
+	return ResultSuccess
+}
@@ -0,0 +1,55 @@
+package audit
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+)
+
+// WriterSink writes events as JSON lines.
+type WriterSink struct {
+	mu     sync.Mutex
+	w      io.Writer
+	closer io.Closer
+}
+
+// NewWriterSink writes events to w, e.g. os.Stdout. Closing the sink doesn't
+// close w.
+func NewWriterSink(w io.Writer) *WriterSink {
+	return &WriterSink{w: w}
+}
+
+// NewFileSink appends events to the file, creating it if needed.
+func NewFileSink(path string) (*WriterSink, error) {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o600)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open audit log: %w", err)
+	}
+	return &WriterSink{w: f, closer: f}, nil
+}
+
+func (s *WriterSink) Write(ctx context.Context, e *Event) error {
+	b, err := json.Marshal(e)
+	if err != nil {
+		return fmt.Errorf("failed to marshal audit event: %w", err)
+	}
+	b = append(b, '\n')
+
+	// One write per line keeps lines whole in appended files.
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, err := s.w.Write(b); err != nil {
+		return fmt.Errorf("failed to write audit event: %w", err)
+	}
+	return nil
+}
+
+func (s *WriterSink) Close() error {
+	if s.closer == nil {
+		return nil
+	}
+	return s.closer.Close()
+}
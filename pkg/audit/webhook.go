@@ -0,0 +1,162 @@
+package audit
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"sync"
+	"time"
+)
+
+const (
+	defaultWebhookQueueSize = 1000
+	defaultWebhookTimeout   = 10 * time.Second
+	webhookMaxAttempts      = 3
+)
+
+type WebhookConfig struct {
+	URL string
+	// Headers are added to every request, e.g. for authentication.
+	Headers map[string]string
+	// QueueSize bounds the events waiting to be sent. Events are dropped
+	// while the queue is full. Defaults to 1000.
+	QueueSize int
+	// Timeout bounds each request. Defaults to 10s.
+	Timeout time.Duration
+	// Logger reports dropped events.
+	Logger *slog.Logger
+}
+
+// WebhookSink POSTs each event as JSON to a URL. Events are sent in the
+// background so slow endpoints don't delay the audited requests, and are
+// retried on network errors and 429 and 5xx responses.
+type WebhookSink struct {
+	cfg    *WebhookConfig
+	client *http.Client
+	logger *slog.Logger
+	queue  chan *Event
+	done   chan struct{}
+
+	mu     sync.RWMutex
+	closed bool
+}
+
+func NewWebhookSink(cfg *WebhookConfig) *WebhookSink {
+	size := cfg.QueueSize
+	if size <= 0 {
+		size = defaultWebhookQueueSize
+	}
+	timeout := cfg.Timeout
+	if timeout <= 0 {
+		timeout = defaultWebhookTimeout
+	}
+	logger := cfg.Logger
+	if logger == nil {
+		logger = slog.Default()
+	}
+	s := &WebhookSink{
+		cfg:    cfg,
+		logger: logger,
+		client: &http.Client{Timeout: timeout},
+		queue:  make(chan *Event, size),
+		done:   make(chan struct{}),
+	}
+	go s.run()
+	return s
+}
+
+// Write queues the event. It returns an error if the queue is full.
+func (s *WebhookSink) Write(ctx context.Context, e *Event) error {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if s.closed {
+		return fmt.Errorf("audit webhook is closed, dropped %s event", e.Action)
+	}
+	select {
+	case s.queue <- e:
+		return nil
+	default:
+		return fmt.Errorf("audit webhook queue is full, dropped %s event", e.Action)
+	}
+}
+
+// Close sends the queued events and stops the sink. Events failing while
+// closing aren't retried.
+func (s *WebhookSink) Close() error {
+	s.mu.Lock()
+	if !s.closed {
+		s.closed = true
+		close(s.queue)
+	}
+	s.mu.Unlock()
+	<-s.done
+	return nil
+}
+
+func (s *WebhookSink) run() {
+	defer close(s.done)
+	for e := range s.queue {
+		if err := s.send(e); err != nil {
+			s.logger.Error("failed to send audit event", "action", e.Action, "error", err)
+		}
+	}
+}
+
+func (s *WebhookSink) send(e *Event) error {
+	b, err := json.Marshal(e)
+	if err != nil {
+		return fmt.Errorf("failed to marshal audit event: %w", err)
+	}
+
+	backoff := time.Second
+	for attempt := 1; ; attempt++ {
+		retry, err := s.post(b)
+		if err == nil {
+			return nil
+		}
+		if !retry || attempt == webhookMaxAttempts || s.closing() {
+			return err
+		}
+		time.Sleep(backoff)
+		backoff *= 2
+	}
+}
+
+// post sends the event and reports whether a failure may be retried.
+func (s *WebhookSink) post(body []byte) (bool, error) {
+	req, err := http.NewRequest(http.MethodPost, s.cfg.URL, bytes.NewReader(body))
+	if err != nil {
+		return false, fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range s.cfg.Headers {
+		req.Header.Set(k, v)
+	}
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return true, fmt.Errorf("failed to post audit event: %w", err)
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 1<<16))
+
+	switch {
+	case resp.StatusCode < 300:
+		return false, nil
+	case resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500:
+		return true, fmt.Errorf("audit webhook returned %s", resp.Status)
+	default:
+		return false, fmt.Errorf("audit webhook returned %s", resp.Status)
+	}
+}
+
+// closing reports whether Close has been called.
+func (s *WebhookSink) closing() bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.closed
+}
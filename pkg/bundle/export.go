@@ -0,0 +1,321 @@
+package bundle
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/abcxyz/pkg/logging"
+
+	"github.com/yolocs/ar-terraform-registry/pkg/model"
+)
+
+// Source is a store providers and modules are exported from.
+type Source interface {
+	model.ProviderStore
+	model.ModuleStore
+}
+
+// Export writes the selected providers and modules from src to w as a gzipped
+// tarball with a manifest. Provider binaries are verified against their
+// SHA256SUMS on the way.
+func Export(ctx context.Context, w io.Writer, src Source, sel *Selection) (*Manifest, error) {
+	logger := logging.FromContext(ctx)
+
+	gz := gzip.NewWriter(w)
+	tw := tar.NewWriter(gz)
+	e := &exporter{src: src, tw: tw}
+	m := &Manifest{FormatVersion: FormatVersion, CreatedAt: time.Now().UTC()}
+
+	for _, ps := range sel.Providers {
+		entries, err := e.providers(ctx, ps)
+		if err != nil {
+			return nil, fmt.Errorf("failed to export provider %s/%s: %w", ps.Namespace, ps.Name, err)
+		}
+		if len(entries) == 0 {
+			logger.WarnContext(ctx, "no provider versions match", "provider", ps.Namespace+"/"+ps.Name)
+		}
+		m.Providers = append(m.Providers, entries...)
+	}
+	for _, ms := range sel.Modules {
+		entries, err := e.modules(ctx, ms)
+		if err != nil {
+			return nil, fmt.Errorf("failed to export module %s/%s/%s: %w", ms.Namespace, ms.Name, ms.System, err)
+		}
+		if len(entries) == 0 {
+			logger.WarnContext(ctx, "no module versions match", "module", ms.Namespace+"/"+ms.Name+"/"+ms.System)
+		}
+		m.Modules = append(m.Modules, entries...)
+	}
+
+	b, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal manifest: %w", err)
+	}
+	if err := tw.WriteHeader(&tar.Header{
+		Name:    manifestName,
+		Mode:    0o644,
+		Size:    int64(len(b)),
+		ModTime: m.CreatedAt,
+	}); err != nil {
+		return nil, fmt.Errorf("failed to write manifest: %w", err)
+	}
+	if _, err := tw.Write(b); err != nil {
+		return nil, fmt.Errorf("failed to write manifest: %w", err)
+	}
+	if err := tw.Close(); err != nil {
+		return nil, fmt.Errorf("failed to finish bundle: %w", err)
+	}
+	if err := gz.Close(); err != nil {
+		return nil, fmt.Errorf("failed to finish bundle: %w", err)
+	}
+	return m, nil
+}
+
+type exporter struct {
+	src Source
+	tw  *tar.Writer
+}
+
+func (e *exporter) providers(ctx context.Context, ps *ProviderSelector) ([]*ProviderEntry, error) {
+	logger := logging.FromContext(ctx)
+
+	vs, err := e.src.ListProviderVersions(ctx, ps.Namespace, ps.Name)
+	if err != nil {
+		return nil, err
+	}
+
+	var entries []*ProviderEntry
+	for _, v := range vs.Versions {
+		if !ps.Constraints.Check(v.Version) {
+			continue
+		}
+		for _, pl := range v.Platforms {
+			p, err := e.src.GetProviderVersion(ctx, ps.Namespace, ps.Name, v.Version, pl.OS, pl.Arch)
+			if err != nil {
+				return nil, fmt.Errorf("failed to get %s %s_%s: %w", v.Version, pl.OS, pl.Arch, err)
+			}
+
+			entry := &ProviderEntry{
+				Namespace: ps.Namespace,
+				Name:      ps.Name,
+				Version:   v.Version,
+				OS:        pl.OS,
+				Arch:      pl.Arch,
+			}
+			dir := path.Join("providers", ps.Namespace, ps.Name, v.Version, pl.OS+"_"+pl.Arch)
+
+			files, err := providerFiles(e.src, ps.Namespace, p)
+			if err != nil {
+				return nil, err
+			}
+			for _, pf := range files {
+				f, err := e.copyAsset(dir, pf.name, func() (io.ReadCloser, error) {
+					return pf.open(ctx)
+				})
+				if err != nil {
+					return nil, err
+				}
+				if pf.binary && f.SHA256 != p.SHASum {
+					return nil, fmt.Errorf("checksum of %s is %s, want %s", pf.name, f.SHA256, p.SHASum)
+				}
+				entry.Files = append(entry.Files, f)
+			}
+
+			logger.InfoContext(ctx, "exported provider",
+				"provider", ps.Namespace+"/"+ps.Name,
+				"version", v.Version,
+				"platform", pl.OS+"_"+pl.Arch)
+			entries = append(entries, entry)
+		}
+	}
+	return entries, nil
+}
+
+func (e *exporter) modules(ctx context.Context, ms *ModuleSelector) ([]*ModuleEntry, error) {
+	logger := logging.FromContext(ctx)
+
+	vs, err := e.src.ListModuleVersions(ctx, ms.Namespace, ms.Name, ms.System)
+	if err != nil {
+		return nil, err
+	}
+
+	var entries []*ModuleEntry
+	for _, v := range vs {
+		if !ms.Constraints.Check(v.Version) {
+			continue
+		}
+
+		storeName, format, err := moduleArchive(v)
+		if err != nil {
+			return nil, err
+		}
+
+		dir := path.Join("modules", ms.Namespace, ms.Name, ms.System, v.Version)
+		f, err := e.copyAsset(dir, "module-archive."+format, func() (io.ReadCloser, error) {
+			return e.src.GetModuleArchive(ctx, ms.Namespace, storeName)
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		logger.InfoContext(ctx, "exported module",
+			"module", ms.Namespace+"/"+ms.Name+"/"+ms.System,
+			"version", v.Version)
+		entries = append(entries, &ModuleEntry{
+			Namespace: ms.Namespace,
+			Name:      ms.Name,
+			System:    ms.System,
+			Version:   v.Version,
+			Format:    format,
+			Subdir:    v.Subdir,
+			File:      f,
+		})
+	}
+	return entries, nil
+}
+
+// copyAsset spools the asset to a temporary file, since tar headers need the
+// size up front, and then appends it to the bundle.
+func (e *exporter) copyAsset(dir, name string, open func() (io.ReadCloser, error)) (*File, error) {
+	rc, err := open()
+	if err != nil {
+		return nil, fmt.Errorf("failed to open %s: %w", name, err)
+	}
+	defer rc.Close()
+
+	tmp, err := os.CreateTemp("", "bundle-*")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create temporary file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	h := sha256.New()
+	size, err := io.Copy(io.MultiWriter(tmp, h), rc)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", name, err)
+	}
+	if _, err := tmp.Seek(0, io.SeekStart); err != nil {
+		return nil, fmt.Errorf("failed to rewind %s: %w", name, err)
+	}
+
+	f := &File{
+		Name:   name,
+		Path:   path.Join(dir, name),
+		Size:   size,
+		SHA256: hex.EncodeToString(h.Sum(nil)),
+	}
+	if err := e.tw.WriteHeader(&tar.Header{
+		Name:    f.Path,
+		Mode:    0o644,
+		Size:    size,
+		ModTime: time.Now().UTC(),
+	}); err != nil {
+		return nil, fmt.Errorf("failed to write %s: %w", f.Path, err)
+	}
+	if _, err := io.Copy(e.tw, tmp); err != nil {
+		return nil, fmt.Errorf("failed to write %s: %w", f.Path, err)
+	}
+	return f, nil
+}
+
+// providerFile is a file of a provider platform release.
+type providerFile struct {
+	// name is the file name without package and version prefix.
+	name   string
+	binary bool
+	open   func(ctx context.Context) (io.ReadCloser, error)
+}
+
+// providerFiles lists the files making up a provider platform release in src:
+// the binary, SHA256SUMS, its signature and the signing key. The key is part
+// of the version metadata and is stored like the other files so it can be
+// written as one.
+func providerFiles(src model.ProviderStore, namespace string, p *model.Provider) ([]*providerFile, error) {
+	var files []*providerFile
+	var shaSumsName string
+	for _, u := range []string{p.DownloadURL, p.SHASumsURL, p.SHASumsSignatureURL} {
+		storeName, name, err := assetNames(u)
+		if err != nil {
+			return nil, err
+		}
+		if u == p.SHASumsURL {
+			shaSumsName = name
+		}
+		files = append(files, &providerFile{
+			name:   name,
+			binary: u == p.DownloadURL,
+			open: func(ctx context.Context) (io.ReadCloser, error) {
+				return src.GetProviderAsset(ctx, namespace, storeName)
+			},
+		})
+	}
+
+	if len(p.SigningKeys.GPGPublicKeys) > 0 {
+		armor := p.SigningKeys.GPGPublicKeys[0].ASCIIArmor
+		files = append(files, &providerFile{
+			name: strings.TrimSuffix(shaSumsName, "_SHA256SUMS") + "_gpg-public-key.pem",
+			open: func(context.Context) (io.ReadCloser, error) {
+				return io.NopCloser(strings.NewReader(armor)), nil
+			},
+		})
+	}
+	return files, nil
+}
+
+// moduleArchive returns the store file name and format of a module version's
+// archive.
+func moduleArchive(v *model.ModuleVersion) (string, string, error) {
+	u, err := url.Parse(v.SourceURL)
+	if err != nil || u.IsAbs() || !strings.HasPrefix(u.Path, "/download/module/") {
+		return "", "", fmt.Errorf("version %s is not served by the registry (%q)", v.Version, v.SourceURL)
+	}
+	storeName := path.Base(u.Path)
+	format := u.Query().Get("archive")
+	if format == "" {
+		format = archiveFormat(storeName)
+	}
+	if format == "" {
+		return "", "", fmt.Errorf("unrecognized module archive %q", storeName)
+	}
+	return storeName, format, nil
+}
+
+// assetNames returns the store file name of a registry download URL and the
+// name without the "<package>:<version>:" prefix.
+func assetNames(rawURL string) (string, string, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return "", "", fmt.Errorf("invalid asset URL %q: %w", rawURL, err)
+	}
+	if u.IsAbs() {
+		return "", "", fmt.Errorf("asset %q is not served by the registry", rawURL)
+	}
+	storeName := path.Base(u.Path)
+	parts := strings.SplitN(storeName, ":", 3)
+	if len(parts) != 3 || validName(parts[2]) != nil {
+		return "", "", fmt.Errorf("unrecognized asset name %q", storeName)
+	}
+	return storeName, parts[2], nil
+}
+
+// archiveFormat guesses the archive format from the file name.
+func archiveFormat(name string) string {
+	for _, f := range archiveFormats {
+		if strings.HasSuffix(name, "."+f) {
+			return f
+		}
+	}
+	return ""
+}
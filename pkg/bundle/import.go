@@ -0,0 +1,299 @@
+package bundle
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/abcxyz/pkg/logging"
+
+	"github.com/yolocs/ar-terraform-registry/pkg/model"
+	"github.com/yolocs/ar-terraform-registry/pkg/publish"
+)
+
+// Target is a store bundles are imported into.
+type Target interface {
+	model.ProviderWriter
+	model.ModuleWriter
+}
+
+// ImportResult counts the imported versions. Versions whose files already
+// exist in the target are skipped.
+type ImportResult struct {
+	Providers int
+	Modules   int
+	Skipped   int
+}
+
+// Import validates the bundle read from r against its manifest and loads it
+// into dst. Nothing is written unless the whole bundle is valid.
+func Import(ctx context.Context, r io.Reader, dst Target) (*ImportResult, error) {
+	logger := logging.FromContext(ctx)
+
+	dir, err := os.MkdirTemp("", "bundle-import-*")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create temporary directory: %w", err)
+	}
+	defer os.RemoveAll(dir)
+
+	m, err := extract(r, dir, maxBundleSize)
+	if err != nil {
+		return nil, err
+	}
+
+	// Analyze every module before anything is written.
+	metadata := make([]*model.ModuleMetadata, len(m.Modules))
+	var merr error
+	for i, mod := range m.Modules {
+		metadata[i], err = publish.AnalyzeModule(moduleRelease(dir, mod))
+		merr = errors.Join(merr, err)
+	}
+	if merr != nil {
+		return nil, fmt.Errorf("invalid bundle: %w", merr)
+	}
+
+	res := &ImportResult{}
+	for _, p := range m.Providers {
+		err := publish.WriteProvider(ctx, dst, providerRelease(dir, p))
+		skipped := errors.Is(err, model.ErrAlreadyExists)
+		if err != nil && !skipped {
+			return res, fmt.Errorf("failed to import provider %s/%s %s %s_%s: %w", p.Namespace, p.Name, p.Version, p.OS, p.Arch, err)
+		}
+		logger.InfoContext(ctx, "imported provider",
+			"provider", p.Namespace+"/"+p.Name,
+			"version", p.Version,
+			"platform", p.OS+"_"+p.Arch,
+			"skipped_existing", skipped)
+		if skipped {
+			res.Skipped++
+		} else {
+			res.Providers++
+		}
+	}
+
+	for i, mod := range m.Modules {
+		err := publish.WriteModule(ctx, dst, moduleRelease(dir, mod), metadata[i])
+		if errors.Is(err, model.ErrAlreadyExists) {
+			res.Skipped++
+			logger.InfoContext(ctx, "module already exists",
+				"module", mod.Namespace+"/"+mod.Name+"/"+mod.System,
+				"version", mod.Version)
+			continue
+		}
+		if err != nil {
+			return res, fmt.Errorf("failed to import module %s/%s/%s %s: %w", mod.Namespace, mod.Name, mod.System, mod.Version, err)
+		}
+		logger.InfoContext(ctx, "imported module",
+			"module", mod.Namespace+"/"+mod.Name+"/"+mod.System,
+			"version", mod.Version)
+		res.Modules++
+	}
+	return res, nil
+}
+
+// maxBundleSize bounds the total size of an unpacked bundle.
+const maxBundleSize = 64 << 30
+
+// extract unpacks the bundle into dir and checks it against the manifest:
+// every listed file must be present with the recorded size and checksum, no
+// other files may be present, and provider releases must pass
+// publish.ValidateProvider. Bundles expanding to more than limit bytes are
+// rejected.
+func extract(r io.Reader, dir string, limit int64) (*Manifest, error) {
+	gz, err := gzip.NewReader(r)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read bundle: %w", err)
+	}
+	defer gz.Close()
+
+	var m *Manifest
+	var size int64
+	got := make(map[string]*File)
+	tr := tar.NewReader(gz)
+	for {
+		hdr, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read bundle: %w", err)
+		}
+		if hdr.Typeflag == tar.TypeDir {
+			continue
+		}
+		if hdr.Typeflag != tar.TypeReg {
+			return nil, fmt.Errorf("bundle entry %q is not a regular file", hdr.Name)
+		}
+		if size += hdr.Size; size > limit {
+			return nil, fmt.Errorf("bundle expands to more than %d bytes", limit)
+		}
+
+		if hdr.Name == manifestName {
+			dec := json.NewDecoder(tr)
+			dec.DisallowUnknownFields()
+			if err := dec.Decode(&m); err != nil {
+				return nil, fmt.Errorf("failed to parse manifest: %w", err)
+			}
+			continue
+		}
+
+		if !validPath(hdr.Name) {
+			return nil, fmt.Errorf("bundle entry %q has an invalid path", hdr.Name)
+		}
+		if _, ok := got[hdr.Name]; ok {
+			return nil, fmt.Errorf("bundle entry %q is a duplicate", hdr.Name)
+		}
+		f, err := writeEntry(tr, dir, hdr.Name)
+		if err != nil {
+			return nil, err
+		}
+		got[hdr.Name] = f
+	}
+
+	if m == nil {
+		return nil, fmt.Errorf("bundle has no %s", manifestName)
+	}
+	if m.FormatVersion != FormatVersion {
+		return nil, fmt.Errorf("unsupported bundle format version %d", m.FormatVersion)
+	}
+
+	var merr error
+	want := make(map[string]struct{})
+	check := func(f *File) bool {
+		if f == nil {
+			merr = errors.Join(merr, fmt.Errorf("manifest entry without file"))
+			return false
+		}
+		want[f.Path] = struct{}{}
+		g, ok := got[f.Path]
+		switch {
+		case !ok:
+			merr = errors.Join(merr, fmt.Errorf("%s is missing", f.Path))
+		case g.Size != f.Size || g.SHA256 != f.SHA256:
+			merr = errors.Join(merr, fmt.Errorf("%s doesn't match its checksum", f.Path))
+		case validName(f.Name) != nil:
+			merr = errors.Join(merr, fmt.Errorf("%s has an invalid name %q", f.Path, f.Name))
+		default:
+			return true
+		}
+		return false
+	}
+	for i, p := range m.Providers {
+		if p == nil {
+			merr = errors.Join(merr, fmt.Errorf("provider entry %d is null", i))
+			continue
+		}
+		for _, s := range []string{p.Namespace, p.Name, p.Version, p.OS, p.Arch} {
+			if err := validName(s); err != nil {
+				merr = errors.Join(merr, fmt.Errorf("provider %s/%s: %w", p.Namespace, p.Name, err))
+			}
+		}
+		ok := true
+		for _, f := range p.Files {
+			ok = check(f) && ok
+		}
+		if ok {
+			merr = errors.Join(merr, publish.ValidateProvider(providerRelease(dir, p)))
+		}
+	}
+	for i, mod := range m.Modules {
+		if mod == nil {
+			merr = errors.Join(merr, fmt.Errorf("module entry %d is null", i))
+			continue
+		}
+		for _, s := range []string{mod.Namespace, mod.Name, mod.System, mod.Version} {
+			if err := validName(s); err != nil {
+				merr = errors.Join(merr, fmt.Errorf("module %s/%s/%s: %w", mod.Namespace, mod.Name, mod.System, err))
+			}
+		}
+		if !slices.Contains(archiveFormats, mod.Format) {
+			merr = errors.Join(merr, fmt.Errorf("module %s/%s/%s %s has unsupported format %q", mod.Namespace, mod.Name, mod.System, mod.Version, mod.Format))
+		}
+		check(mod.File)
+	}
+	for p := range got {
+		if _, ok := want[p]; !ok {
+			merr = errors.Join(merr, fmt.Errorf("%s is not in the manifest", p))
+		}
+	}
+	if merr != nil {
+		return nil, fmt.Errorf("invalid bundle: %w", merr)
+	}
+	return m, nil
+}
+
+// providerRelease locates the extracted files of a provider entry.
+func providerRelease(dir string, p *ProviderEntry) *publish.ProviderRelease {
+	rel := &publish.ProviderRelease{
+		Namespace: p.Namespace,
+		Name:      p.Name,
+		Version:   p.Version,
+		OS:        p.OS,
+		Arch:      p.Arch,
+		Files:     make(map[string]string, len(p.Files)),
+	}
+	for _, f := range p.Files {
+		rel.Files[f.Name] = filepath.Join(dir, filepath.FromSlash(f.Path))
+	}
+	return rel
+}
+
+// moduleRelease locates the extracted archive of a module entry.
+func moduleRelease(dir string, mod *ModuleEntry) *publish.ModuleRelease {
+	return &publish.ModuleRelease{
+		Namespace: mod.Namespace,
+		Name:      mod.Name,
+		System:    mod.System,
+		Version:   mod.Version,
+		Format:    mod.Format,
+		Subdir:    mod.Subdir,
+		Archive:   filepath.Join(dir, filepath.FromSlash(mod.File.Path)),
+	}
+}
+
+func writeEntry(r io.Reader, dir, name string) (*File, error) {
+	p := filepath.Join(dir, filepath.FromSlash(name))
+	if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create directory for %s: %w", name, err)
+	}
+	w, err := os.Create(p)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create %s: %w", name, err)
+	}
+	defer w.Close()
+
+	h := sha256.New()
+	size, err := io.Copy(io.MultiWriter(w, h), r)
+	if err != nil {
+		return nil, fmt.Errorf("failed to extract %s: %w", name, err)
+	}
+	if err := w.Close(); err != nil {
+		return nil, fmt.Errorf("failed to extract %s: %w", name, err)
+	}
+	return &File{Path: name, Size: size, SHA256: hex.EncodeToString(h.Sum(nil))}, nil
+}
+
+// validPath accepts clean, relative, slash separated paths under the
+// providers and modules directories.
+func validPath(p string) bool {
+	if p != path.Clean(p) || path.IsAbs(p) || strings.Contains(p, `\`) {
+		return false
+	}
+	for _, seg := range strings.Split(p, "/") {
+		if seg == "" || seg == "." || seg == ".." {
+			return false
+		}
+	}
+	return strings.HasPrefix(p, "providers/") || strings.HasPrefix(p, "modules/")
+}
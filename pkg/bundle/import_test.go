@@ -0,0 +1,185 @@
+package bundle
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+const moduleArchivePath = "modules/acme/vpc/aws/1.0.0/module.tar.gz"
+
+var moduleArchiveContent = []byte("not analyzed by extract")
+
+// moduleFile is the manifest entry of moduleArchiveContent.
+func moduleFile() *File {
+	sum := sha256.Sum256(moduleArchiveContent)
+	return &File{
+		Name:   "module.tar.gz",
+		Path:   moduleArchivePath,
+		Size:   int64(len(moduleArchiveContent)),
+		SHA256: hex.EncodeToString(sum[:]),
+	}
+}
+
+func moduleEntry() *ModuleEntry {
+	return &ModuleEntry{Namespace: "acme", Name: "vpc", System: "aws", Version: "1.0.0", Format: "tar.gz", File: moduleFile()}
+}
+
+// writeBundle packs the files and, unless it's empty, the manifest into a
+// bundle.
+func writeBundle(t *testing.T, manifest string, files map[string][]byte) *bytes.Buffer {
+	t.Helper()
+
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gz)
+	add := func(name string, b []byte) {
+		if err := tw.WriteHeader(&tar.Header{Name: name, Mode: 0o644, Size: int64(len(b)), Typeflag: tar.TypeReg}); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tw.Write(b); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for name, b := range files {
+		add(name, b)
+	}
+	if manifest != "" {
+		add(manifestName, []byte(manifest))
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := gz.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return &buf
+}
+
+func manifestJSON(t *testing.T, m *Manifest) string {
+	t.Helper()
+	b, err := json.Marshal(m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(b)
+}
+
+func TestExtract(t *testing.T) {
+	t.Parallel()
+
+	archive := map[string][]byte{moduleArchivePath: moduleArchiveContent}
+	mismatched := moduleEntry()
+	mismatched.File.SHA256 = strings.Repeat("0", 64)
+	badFormat := moduleEntry()
+	badFormat.Format = "rar"
+
+	cases := []struct {
+		name     string
+		manifest string
+		files    map[string][]byte
+		limit    int64
+		wantErr  string
+	}{
+		{
+			name:     "valid",
+			manifest: manifestJSON(t, &Manifest{FormatVersion: FormatVersion, Modules: []*ModuleEntry{moduleEntry()}}),
+			files:    archive,
+		},
+		{
+			name:     "null provider",
+			manifest: `{"format_version": 1, "providers": [null], "modules": []}`,
+			wantErr:  "provider entry 0 is null",
+		},
+		{
+			name:     "null module",
+			manifest: `{"format_version": 1, "providers": [], "modules": [null]}`,
+			wantErr:  "module entry 0 is null",
+		},
+		{
+			name:     "module without file",
+			manifest: `{"format_version": 1, "modules": [{"namespace": "acme", "name": "vpc", "system": "aws", "version": "1.0.0", "format": "zip"}]}`,
+			wantErr:  "manifest entry without file",
+		},
+		{
+			name:     "missing file",
+			manifest: manifestJSON(t, &Manifest{FormatVersion: FormatVersion, Modules: []*ModuleEntry{moduleEntry()}}),
+			wantErr:  moduleArchivePath + " is missing",
+		},
+		{
+			name:     "checksum mismatch",
+			manifest: manifestJSON(t, &Manifest{FormatVersion: FormatVersion, Modules: []*ModuleEntry{mismatched}}),
+			files:    archive,
+			wantErr:  "doesn't match its checksum",
+		},
+		{
+			name:     "unlisted file",
+			manifest: manifestJSON(t, &Manifest{FormatVersion: FormatVersion}),
+			files:    archive,
+			wantErr:  "is not in the manifest",
+		},
+		{
+			name:     "unsupported archive format",
+			manifest: manifestJSON(t, &Manifest{FormatVersion: FormatVersion, Modules: []*ModuleEntry{badFormat}}),
+			files:    archive,
+			wantErr:  `unsupported format "rar"`,
+		},
+		{
+			name:     "format version",
+			manifest: manifestJSON(t, &Manifest{FormatVersion: FormatVersion + 1}),
+			wantErr:  "unsupported bundle format version",
+		},
+		{
+			name:     "unknown manifest field",
+			manifest: `{"format_version": 1, "extra": true}`,
+			wantErr:  "failed to parse manifest",
+		},
+		{
+			name:    "no manifest",
+			files:   archive,
+			wantErr: "bundle has no manifest.json",
+		},
+		{
+			name:     "path traversal",
+			manifest: manifestJSON(t, &Manifest{FormatVersion: FormatVersion}),
+			files:    map[string][]byte{"modules/../../escape": []byte("x")},
+			wantErr:  "has an invalid path",
+		},
+		{
+			name:     "size limit",
+			manifest: manifestJSON(t, &Manifest{FormatVersion: FormatVersion, Modules: []*ModuleEntry{moduleEntry()}}),
+			files:    archive,
+			limit:    int64(len(moduleArchiveContent)),
+			wantErr:  "bundle expands to more than",
+		},
+	}
+	for _, tc := range cases {
+		limit := tc.limit
+		if limit == 0 {
+			limit = maxBundleSize
+		}
+		_, err := extract(writeBundle(t, tc.manifest, tc.files), t.TempDir(), limit)
+		switch {
+		case tc.wantErr == "" && err != nil:
+			t.Errorf("%s: %v", tc.name, err)
+		case tc.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tc.wantErr)):
+			t.Errorf("%s: got error %v, want %q", tc.name, err, tc.wantErr)
+		}
+	}
+}
+
+func TestImportNullEntry(t *testing.T) {
+	t.Parallel()
+
+	// The manifest is rejected before the target is used.
+	b := writeBundle(t, `{"format_version": 1, "providers": [null], "modules": [null]}`, nil)
+	if _, err := Import(context.Background(), b, nil); err == nil {
+		t.Errorf("got no error, want the null entries rejected")
+	}
+}
@@ -0,0 +1,57 @@
+package bundle
+
+import (
+	"time"
+)
+
+const (
+	// FormatVersion is the version of the bundle layout written by Export.
+	FormatVersion = 1
+	// manifestName is the path of the manifest inside the bundle. It's the
+	// last entry, as the checksums are only known once the files are written.
+	manifestName = "manifest.json"
+)
+
+// archiveFormats are the supported module archive formats.
+var archiveFormats = []string{"tar.gz", "tgz", "zip"}
+
+// Manifest describes the content of a bundle.
+type Manifest struct {
+	FormatVersion int              `json:"format_version"`
+	CreatedAt     time.Time        `json:"created_at"`
+	Providers     []*ProviderEntry `json:"providers"`
+	Modules       []*ModuleEntry   `json:"modules"`
+}
+
+// ProviderEntry is one platform of a provider version.
+type ProviderEntry struct {
+	Namespace string `json:"namespace"`
+	Name      string `json:"name"`
+	Version   string `json:"version"`
+	OS        string `json:"os"`
+	Arch      string `json:"arch"`
+	// Files are the binary, SHA256SUMS, its signature and the signing key.
+	Files []*File `json:"files"`
+}
+
+// ModuleEntry is a module version.
+type ModuleEntry struct {
+	Namespace string `json:"namespace"`
+	Name      string `json:"name"`
+	System    string `json:"system"`
+	Version   string `json:"version"`
+	// Format is the archive format, "tar.gz", "tgz" or "zip".
+	Format string `json:"format"`
+	Subdir string `json:"subdir,omitempty"`
+	File   *File  `json:"file"`
+}
+
+// File is a file in the bundle.
+type File struct {
+	// Name is the file name in the store, without package and version.
+	Name string `json:"name"`
+	// Path is the location in the bundle.
+	Path   string `json:"path"`
+	Size   int64  `json:"size"`
+	SHA256 string `json:"sha256"`
+}
@@ -0,0 +1,195 @@
+// Package bundle moves providers and modules between stores, either through a
+// single archive that can be carried into an air-gapped network, or by
+// syncing two stores directly.
+package bundle
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"golang.org/x/mod/semver"
+)
+
+// Selection chooses the providers and modules to export or sync.
+type Selection struct {
+	Providers []*ProviderSelector
+	Modules   []*ModuleSelector
+}
+
+// ProviderSelector selects the versions of a provider matching Constraints.
+type ProviderSelector struct {
+	Namespace   string
+	Name        string
+	Constraints Constraints
+}
+
+// ModuleSelector selects the versions of a module matching Constraints.
+type ModuleSelector struct {
+	Namespace   string
+	Name        string
+	System      string
+	Constraints Constraints
+}
+
+// ParseSelection parses provider and module selectors.
+func ParseSelection(providers, modules []string) (*Selection, error) {
+	sel := &Selection{}
+	for _, p := range providers {
+		s, err := ParseProviderSelector(p)
+		if err != nil {
+			return nil, err
+		}
+		sel.Providers = append(sel.Providers, s)
+	}
+	for _, m := range modules {
+		s, err := ParseModuleSelector(m)
+		if err != nil {
+			return nil, err
+		}
+		sel.Modules = append(sel.Modules, s)
+	}
+	return sel, nil
+}
+
+// ParseProviderSelector parses "<namespace>/<name>[@<constraints>]", e.g.
+// "acme/aws@>= 1.2, < 2.0".
+func ParseProviderSelector(s string) (*ProviderSelector, error) {
+	parts, cs, err := parseSelector(s, 2)
+	if err != nil {
+		return nil, err
+	}
+	return &ProviderSelector{Namespace: parts[0], Name: parts[1], Constraints: cs}, nil
+}
+
+// ParseModuleSelector parses "<namespace>/<name>/<system>[@<constraints>]",
+// e.g. "acme/vpc/aws@~> 1.4".
+func ParseModuleSelector(s string) (*ModuleSelector, error) {
+	parts, cs, err := parseSelector(s, 3)
+	if err != nil {
+		return nil, err
+	}
+	return &ModuleSelector{Namespace: parts[0], Name: parts[1], System: parts[2], Constraints: cs}, nil
+}
+
+func parseSelector(s string, n int) ([]string, Constraints, error) {
+	addr, constraints, _ := strings.Cut(s, "@")
+	parts := strings.Split(addr, "/")
+	if len(parts) != n {
+		return nil, nil, fmt.Errorf("invalid address %q: want %d slash separated parts", addr, n)
+	}
+	for _, p := range parts {
+		if err := validName(p); err != nil {
+			return nil, nil, fmt.Errorf("invalid address %q: %w", addr, err)
+		}
+	}
+	cs, err := ParseConstraints(constraints)
+	if err != nil {
+		return nil, nil, err
+	}
+	return parts, cs, nil
+}
+
+// validName rejects address parts that can't be used as path segments.
+func validName(s string) error {
+	if s == "" || s == "." || s == ".." || strings.ContainsAny(s, `/\:`) {
+		return fmt.Errorf("invalid name %q", s)
+	}
+	return nil
+}
+
+// Constraints is a list of version constraints that must all hold. An empty
+// list matches every release version.
+type Constraints []*constraint
+
+type constraint struct {
+	op      string
+	version string
+	// upper is the exclusive upper bound of a "~>" constraint, if any.
+	upper string
+}
+
+// ParseConstraints parses comma separated Terraform style constraints using
+// the "=", "!=", ">", ">=", "<", "<=" and "~>" operators.
+func ParseConstraints(s string) (Constraints, error) {
+	if strings.TrimSpace(s) == "" {
+		return nil, nil
+	}
+
+	var cs Constraints
+	for _, part := range strings.Split(s, ",") {
+		part = strings.TrimSpace(part)
+		c := &constraint{op: "="}
+		for _, op := range []string{"~>", ">=", "<=", "!=", ">", "<", "="} {
+			if strings.HasPrefix(part, op) {
+				c.op, part = op, strings.TrimSpace(strings.TrimPrefix(part, op))
+				break
+			}
+		}
+		c.version = "v" + part
+		if !semver.IsValid(c.version) {
+			return nil, fmt.Errorf("invalid version %q in constraint %q", part, s)
+		}
+		if c.op == "~>" {
+			// The rightmost given segment may increase: "~> 1" and "~> 1.2"
+			// allow 1.x from 1.0 and 1.2, "~> 1.2.3" allows 1.2.x from 1.2.3.
+			given, _, _ := strings.Cut(part, "-")
+			given, _, _ = strings.Cut(given, "+")
+			core, _, _ := strings.Cut(strings.TrimPrefix(semver.Canonical(c.version), "v"), "-")
+			segs := strings.Split(core, ".")
+			major, _ := strconv.Atoi(segs[0])
+			minor, _ := strconv.Atoi(segs[1])
+			switch strings.Count(given, ".") {
+			case 0, 1:
+				c.upper = fmt.Sprintf("v%d", major+1)
+			case 2:
+				c.upper = fmt.Sprintf("v%d.%d", major, minor+1)
+			}
+		}
+		cs = append(cs, c)
+	}
+	return cs, nil
+}
+
+// Check reports whether the version satisfies every constraint. Prerelease
+// versions are only matched by an exact "=" constraint.
+func (cs Constraints) Check(version string) bool {
+	v := "v" + version
+	if !semver.IsValid(v) {
+		return false
+	}
+	if semver.Prerelease(v) != "" {
+		exact := false
+		for _, c := range cs {
+			exact = exact || (c.op == "=" && semver.Compare(v, c.version) == 0)
+		}
+		if !exact {
+			return false
+		}
+	}
+
+	for _, c := range cs {
+		cmp := semver.Compare(v, c.version)
+		var ok bool
+		switch c.op {
+		case "=":
+			ok = cmp == 0
+		case "!=":
+			ok = cmp != 0
+		case ">":
+			ok = cmp > 0
+		case ">=":
+			ok = cmp >= 0
+		case "<":
+			ok = cmp < 0
+		case "<=":
+			ok = cmp <= 0
+		case "~>":
+			ok = cmp >= 0 && (c.upper == "" || semver.Compare(v, c.upper) < 0)
+		}
+		if !ok {
+			return false
+		}
+	}
+	return true
+}
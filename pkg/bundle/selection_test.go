@@ -0,0 +1,97 @@
+package bundle
+
+import (
+	"testing"
+)
+
+func TestConstraintsCheck(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		constraints string
+		match       []string
+		skip        []string
+	}{
+		{
+			constraints: "",
+			match:       []string{"0.1.0", "1.0.0", "2.3.4"},
+			skip:        []string{"1.0.0-beta", "latest"},
+		},
+		{
+			constraints: "1.2.0",
+			match:       []string{"1.2.0"},
+			skip:        []string{"1.2.1", "1.1.9"},
+		},
+		{
+			constraints: "~> 1",
+			match:       []string{"1.0.0", "1.9.9"},
+			skip:        []string{"0.9.0", "2.0.0", "1.1.0-rc1"},
+		},
+		{
+			constraints: "~> 1.2",
+			match:       []string{"1.2.0", "1.9.0"},
+			skip:        []string{"1.1.9", "2.0.0"},
+		},
+		{
+			constraints: "~> 1.2.3",
+			match:       []string{"1.2.3", "1.2.9"},
+			skip:        []string{"1.2.2", "1.3.0"},
+		},
+		{
+			constraints: ">= 1.2, < 2.0, != 1.5.0",
+			match:       []string{"1.2.0", "1.9.9"},
+			skip:        []string{"1.1.0", "1.5.0", "2.0.0"},
+		},
+		{
+			constraints: "= 1.0.0-beta",
+			match:       []string{"1.0.0-beta"},
+			skip:        []string{"1.0.0"},
+		},
+	}
+	for _, tc := range cases {
+		cs, err := ParseConstraints(tc.constraints)
+		if err != nil {
+			t.Errorf("%q: %v", tc.constraints, err)
+			continue
+		}
+		for _, v := range tc.match {
+			if !cs.Check(v) {
+				t.Errorf("%q: got %s skipped, want matched", tc.constraints, v)
+			}
+		}
+		for _, v := range tc.skip {
+			if cs.Check(v) {
+				t.Errorf("%q: got %s matched, want skipped", tc.constraints, v)
+			}
+		}
+	}
+}
+
+func TestParseSelection(t *testing.T) {
+	t.Parallel()
+
+	sel, err := ParseSelection([]string{"acme/aws@>= 1.2, < 2.0"}, []string{"acme/vpc/aws@~> 1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p := sel.Providers[0]; p.Namespace != "acme" || p.Name != "aws" || len(p.Constraints) != 2 {
+		t.Errorf("provider: got %+v", p)
+	}
+	if m := sel.Modules[0]; m.Namespace != "acme" || m.Name != "vpc" || m.System != "aws" || !m.Constraints.Check("1.4.0") {
+		t.Errorf("module: got %+v", m)
+	}
+
+	for _, tc := range []struct {
+		providers, modules []string
+	}{
+		{providers: []string{"acme"}},
+		{providers: []string{"acme/../aws"}},
+		{providers: []string{"acme/aws@>= one"}},
+		{modules: []string{"acme/vpc"}},
+		{modules: []string{`acme/vpc\x/aws`}},
+	} {
+		if _, err := ParseSelection(tc.providers, tc.modules); err == nil {
+			t.Errorf("%v %v: got no error", tc.providers, tc.modules)
+		}
+	}
+}
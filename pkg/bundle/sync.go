@@ -0,0 +1,343 @@
+package bundle
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/abcxyz/pkg/logging"
+
+	"github.com/yolocs/ar-terraform-registry/pkg/model"
+	"github.com/yolocs/ar-terraform-registry/pkg/publish"
+)
+
+// Store is a store that versions are synced into. It's read to find missing
+// versions and to verify copies.
+type Store interface {
+	Source
+	Target
+}
+
+// Sync statuses of a version.
+const (
+	StatusPlanned = "planned"
+	StatusCopied  = "copied"
+	StatusFailed  = "failed"
+)
+
+// SyncItem is a provider platform or module version missing in the
+// destination.
+type SyncItem struct {
+	// Address is "<namespace>/<name>" for providers and
+	// "<namespace>/<name>/<system>" for modules.
+	Address  string `json:"address"`
+	Version  string `json:"version"`
+	Platform string `json:"platform,omitempty"`
+	Status   string `json:"status"`
+	Error    string `json:"error,omitempty"`
+}
+
+// SyncSummary reports what a sync found and did.
+type SyncSummary struct {
+	// Checked counts the selected versions (provider platforms) in the
+	// source.
+	Checked int         `json:"checked"`
+	Missing int         `json:"missing"`
+	Copied  int         `json:"copied"`
+	Failed  int         `json:"failed"`
+	Items   []*SyncItem `json:"items"`
+}
+
+// Sync copies the selected provider platforms and module versions that are in
+// src but not in dst, and verifies the checksums of the copies by reading them
+// back. Provider releases must pass publish.ValidateProvider and module
+// archives publish.AnalyzeModule before they are written. A dry run only
+// reports the missing versions. Failures of single versions don't stop the
+// sync; they are recorded in the summary and returned joined.
+func Sync(ctx context.Context, src Source, dst Store, sel *Selection, dryRun bool) (*SyncSummary, error) {
+	s := &syncer{src: src, dst: dst, dryRun: dryRun, summary: &SyncSummary{}}
+
+	var merr error
+	for _, ps := range sel.Providers {
+		if err := s.providers(ctx, ps); err != nil {
+			merr = errors.Join(merr, fmt.Errorf("failed to sync provider %s/%s: %w", ps.Namespace, ps.Name, err))
+		}
+	}
+	for _, ms := range sel.Modules {
+		if err := s.modules(ctx, ms); err != nil {
+			merr = errors.Join(merr, fmt.Errorf("failed to sync module %s/%s/%s: %w", ms.Namespace, ms.Name, ms.System, err))
+		}
+	}
+	return s.summary, merr
+}
+
+type syncer struct {
+	src     Source
+	dst     Store
+	dryRun  bool
+	summary *SyncSummary
+}
+
+func (s *syncer) providers(ctx context.Context, ps *ProviderSelector) error {
+	logger := logging.FromContext(ctx)
+	addr := ps.Namespace + "/" + ps.Name
+
+	vs, err := s.src.ListProviderVersions(ctx, ps.Namespace, ps.Name)
+	if err != nil {
+		return err
+	}
+
+	have := make(map[string]struct{})
+	if dvs, err := s.dst.ListProviderVersions(ctx, ps.Namespace, ps.Name); err != nil {
+		logger.DebugContext(ctx, "provider not listed in destination", "provider", addr, "error", err)
+	} else {
+		for _, v := range dvs.Versions {
+			for _, pl := range v.Platforms {
+				have[v.Version+" "+pl.OS+"_"+pl.Arch] = struct{}{}
+			}
+		}
+	}
+
+	var merr error
+	for _, v := range vs.Versions {
+		if !ps.Constraints.Check(v.Version) {
+			continue
+		}
+		for _, pl := range v.Platforms {
+			s.summary.Checked++
+			platform := pl.OS + "_" + pl.Arch
+			if _, ok := have[v.Version+" "+platform]; ok {
+				continue
+			}
+
+			item := &SyncItem{Address: addr, Version: v.Version, Platform: platform}
+			err := s.copy(ctx, item, func() error {
+				return s.copyProvider(ctx, ps, v.Version, pl)
+			})
+			merr = errors.Join(merr, err)
+		}
+	}
+	return merr
+}
+
+func (s *syncer) copyProvider(ctx context.Context, ps *ProviderSelector, version string, pl model.Platform) error {
+	p, err := s.src.GetProviderVersion(ctx, ps.Namespace, ps.Name, version, pl.OS, pl.Arch)
+	if err != nil {
+		return err
+	}
+	files, err := providerFiles(s.src, ps.Namespace, p)
+	if err != nil {
+		return err
+	}
+
+	dir, err := os.MkdirTemp("", "sync-provider-*")
+	if err != nil {
+		return fmt.Errorf("failed to create temporary directory: %w", err)
+	}
+	defer os.RemoveAll(dir)
+
+	rel := &publish.ProviderRelease{
+		Namespace: ps.Namespace,
+		Name:      ps.Name,
+		Version:   version,
+		OS:        pl.OS,
+		Arch:      pl.Arch,
+		Files:     make(map[string]string, len(files)),
+	}
+	sums := make(map[string]string, len(files))
+	for _, f := range files {
+		local := filepath.Join(dir, f.name)
+		sum, err := copyHashed(ctx, f.open, func(r io.Reader) error {
+			return writeLocal(local, r)
+		})
+		if err != nil {
+			return fmt.Errorf("failed to copy %s: %w", f.name, err)
+		}
+		if f.binary && sum != p.SHASum {
+			return fmt.Errorf("source checksum of %s is %s, want %s", f.name, sum, p.SHASum)
+		}
+		rel.Files[f.name] = local
+		sums[f.name] = sum
+	}
+	if err := publish.Provider(ctx, s.dst, rel); err != nil {
+		return err
+	}
+
+	// Read the copy back through the destination's own metadata.
+	dp, err := s.dst.GetProviderVersion(ctx, ps.Namespace, ps.Name, version, pl.OS, pl.Arch)
+	if err != nil {
+		return fmt.Errorf("failed to verify copy: %w", err)
+	}
+	if dp.SHASum != p.SHASum {
+		return fmt.Errorf("destination reports checksum %s, want %s", dp.SHASum, p.SHASum)
+	}
+	dfiles, err := providerFiles(s.dst, ps.Namespace, dp)
+	if err != nil {
+		return fmt.Errorf("failed to verify copy: %w", err)
+	}
+	for _, f := range dfiles {
+		sum, err := hashOf(ctx, f.open)
+		if err != nil {
+			return fmt.Errorf("failed to verify %s: %w", f.name, err)
+		}
+		if want, ok := sums[f.name]; ok && sum != want {
+			return fmt.Errorf("checksum of copied %s is %s, want %s", f.name, sum, want)
+		}
+	}
+	return nil
+}
+
+func (s *syncer) modules(ctx context.Context, ms *ModuleSelector) error {
+	logger := logging.FromContext(ctx)
+	addr := ms.Namespace + "/" + ms.Name + "/" + ms.System
+
+	vs, err := s.src.ListModuleVersions(ctx, ms.Namespace, ms.Name, ms.System)
+	if err != nil {
+		return err
+	}
+
+	have := make(map[string]struct{})
+	if dvs, err := s.dst.ListModuleVersions(ctx, ms.Namespace, ms.Name, ms.System); err != nil {
+		logger.DebugContext(ctx, "module not listed in destination", "module", addr, "error", err)
+	} else {
+		for _, v := range dvs {
+			have[v.Version] = struct{}{}
+		}
+	}
+
+	var merr error
+	for _, v := range vs {
+		if !ms.Constraints.Check(v.Version) {
+			continue
+		}
+		s.summary.Checked++
+		if _, ok := have[v.Version]; ok {
+			continue
+		}
+
+		item := &SyncItem{Address: addr, Version: v.Version}
+		err := s.copy(ctx, item, func() error {
+			return s.copyModule(ctx, ms, v)
+		})
+		merr = errors.Join(merr, err)
+	}
+	return merr
+}
+
+func (s *syncer) copyModule(ctx context.Context, ms *ModuleSelector, v *model.ModuleVersion) error {
+	storeName, format, err := moduleArchive(v)
+	if err != nil {
+		return err
+	}
+	dir, err := os.MkdirTemp("", "sync-module-*")
+	if err != nil {
+		return fmt.Errorf("failed to create temporary directory: %w", err)
+	}
+	defer os.RemoveAll(dir)
+
+	rel := &publish.ModuleRelease{
+		Namespace: ms.Namespace,
+		Name:      ms.Name,
+		System:    ms.System,
+		Version:   v.Version,
+		Format:    format,
+		Subdir:    v.Subdir,
+		Archive:   filepath.Join(dir, "module-archive."+format),
+	}
+	sum, err := copyHashed(ctx, func(ctx context.Context) (io.ReadCloser, error) {
+		return s.src.GetModuleArchive(ctx, ms.Namespace, storeName)
+	}, func(r io.Reader) error {
+		return writeLocal(rel.Archive, r)
+	})
+	if err != nil {
+		return err
+	}
+	if err := publish.Module(ctx, s.dst, rel); err != nil {
+		return err
+	}
+
+	dv, err := s.dst.GetModuleVersion(ctx, ms.Namespace, ms.Name, ms.System, v.Version)
+	if err != nil {
+		return fmt.Errorf("failed to verify copy: %w", err)
+	}
+	if dv.Subdir != v.Subdir {
+		return fmt.Errorf("destination reports subdir %q, want %q", dv.Subdir, v.Subdir)
+	}
+	dstName, _, err := moduleArchive(dv)
+	if err != nil {
+		return fmt.Errorf("failed to verify copy: %w", err)
+	}
+	got, err := hashOf(ctx, func(ctx context.Context) (io.ReadCloser, error) {
+		return s.dst.GetModuleArchive(ctx, ms.Namespace, dstName)
+	})
+	if err != nil {
+		return fmt.Errorf("failed to verify copy: %w", err)
+	}
+	if got != sum {
+		return fmt.Errorf("checksum of copied archive is %s, want %s", got, sum)
+	}
+	return nil
+}
+
+// copy records the item and runs do unless this is a dry run.
+func (s *syncer) copy(ctx context.Context, item *SyncItem, do func() error) error {
+	logger := logging.FromContext(ctx)
+
+	s.summary.Missing++
+	s.summary.Items = append(s.summary.Items, item)
+	if s.dryRun {
+		item.Status = StatusPlanned
+		logger.InfoContext(ctx, "would copy", "address", item.Address, "version", item.Version, "platform", item.Platform)
+		return nil
+	}
+
+	if err := do(); err != nil {
+		item.Status, item.Error = StatusFailed, err.Error()
+		s.summary.Failed++
+		logger.ErrorContext(ctx, "failed to copy", "address", item.Address, "version", item.Version, "platform", item.Platform, "error", err)
+		return fmt.Errorf("%s %s: %w", item.Version, item.Platform, err)
+	}
+	item.Status = StatusCopied
+	s.summary.Copied++
+	logger.InfoContext(ctx, "copied", "address", item.Address, "version", item.Version, "platform", item.Platform)
+	return nil
+}
+
+// copyHashed streams the opened content into put and returns its SHA256.
+func copyHashed(ctx context.Context, open func(context.Context) (io.ReadCloser, error), put func(io.Reader) error) (string, error) {
+	rc, err := open(ctx)
+	if err != nil {
+		return "", err
+	}
+	defer rc.Close()
+
+	h := sha256.New()
+	if err := put(io.TeeReader(rc, h)); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+func writeLocal(p string, r io.Reader) error {
+	f, err := os.Create(p)
+	if err != nil {
+		return fmt.Errorf("failed to create %s: %w", p, err)
+	}
+	if _, err := io.Copy(f, r); err != nil {
+		f.Close()
+		return fmt.Errorf("failed to write %s: %w", p, err)
+	}
+	return f.Close()
+}
+
+func hashOf(ctx context.Context, open func(context.Context) (io.ReadCloser, error)) (string, error) {
+	return copyHashed(ctx, open, func(r io.Reader) error {
+		_, err := io.Copy(io.Discard, r)
+		return err
+	})
+}
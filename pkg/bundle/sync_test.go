@@ -0,0 +1,154 @@
+package bundle
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"github.com/yolocs/ar-terraform-registry/pkg/publish"
+	"github.com/yolocs/ar-terraform-registry/pkg/store"
+)
+
+func newFilesystem(t *testing.T) *store.Filesystem {
+	t.Helper()
+	fs, err := store.NewFilesystem(&store.FilesystemConfig{Root: t.TempDir()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return fs
+}
+
+// publishModule publishes a minimal acme/vpc/aws module version.
+func publishModule(t *testing.T, fs *store.Filesystem, version string) {
+	t.Helper()
+
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gz)
+	tf := []byte(`variable "cidr" {}` + "\n")
+	if err := tw.WriteHeader(&tar.Header{Name: "main.tf", Mode: 0o644, Size: int64(len(tf)), Typeflag: tar.TypeReg}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := tw.Write(tf); err != nil {
+		t.Fatal(err)
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := gz.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	archive := filepath.Join(t.TempDir(), "module.tar.gz")
+	if err := os.WriteFile(archive, buf.Bytes(), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	rel := &publish.ModuleRelease{Namespace: "acme", Name: "vpc", System: "aws", Version: version, Format: "tar.gz", Archive: archive}
+	if err := publish.Module(context.Background(), fs, rel); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// putProvider stores the files of a provider platform without validating
+// them, which is enough for dry runs.
+func putProvider(t *testing.T, fs *store.Filesystem, version, goos, arch string) {
+	t.Helper()
+	prefix := "terraform-provider-demo_" + version
+	for _, name := range []string{prefix + "_" + goos + "_" + arch + ".zip", prefix + "_SHA256SUMS", prefix + "_SHA256SUMS.sig"} {
+		if err := fs.PutProviderFile(context.Background(), "acme", "demo", version, goos, arch, name, bytes.NewReader([]byte(name))); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func syncedItems(sum *SyncSummary) []string {
+	var items []string
+	for _, it := range sum.Items {
+		items = append(items, it.Version+" "+it.Platform+" "+it.Status)
+	}
+	return items
+}
+
+func TestSyncModulesSkipsExisting(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	src, dst := newFilesystem(t), newFilesystem(t)
+	for _, v := range []string{"1.0.0", "1.1.0", "2.0.0"} {
+		publishModule(t, src, v)
+	}
+	publishModule(t, dst, "1.0.0")
+
+	ms, err := ParseModuleSelector("acme/vpc/aws@~> 1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	sel := &Selection{Modules: []*ModuleSelector{ms}}
+
+	sum, err := Sync(ctx, src, dst, sel, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sum.Checked != 2 || sum.Missing != 1 || sum.Copied != 1 || sum.Failed != 0 {
+		t.Errorf("first sync: got %+v, want 2 checked and 1.1.0 copied", sum)
+	}
+	if got, want := syncedItems(sum), []string{"1.1.0  copied"}; !slices.Equal(got, want) {
+		t.Errorf("first sync items: got %q, want %q", got, want)
+	}
+	if _, err := dst.GetModuleVersion(ctx, "acme", "vpc", "aws", "1.1.0"); err != nil {
+		t.Errorf("copied version: %v", err)
+	}
+
+	// Everything selected is present now.
+	sum, err = Sync(ctx, src, dst, sel, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sum.Checked != 2 || sum.Missing != 0 || len(sum.Items) != 0 {
+		t.Errorf("second sync: got %+v, want nothing missing", sum)
+	}
+}
+
+func TestSyncProvidersDryRun(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	src, dst := newFilesystem(t), newFilesystem(t)
+	for _, v := range []string{"1.0.0", "1.1.0"} {
+		putProvider(t, src, v, "linux", "amd64")
+		putProvider(t, src, v, "darwin", "arm64")
+	}
+	putProvider(t, dst, "1.0.0", "linux", "amd64")
+
+	ps, err := ParseProviderSelector("acme/demo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	sum, err := Sync(ctx, src, dst, &Selection{Providers: []*ProviderSelector{ps}}, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sum.Checked != 4 || sum.Missing != 3 || sum.Copied != 0 {
+		t.Errorf("got %+v, want 4 checked and 3 missing", sum)
+	}
+	got := syncedItems(sum)
+	slices.Sort(got)
+	want := []string{"1.0.0 darwin_arm64 planned", "1.1.0 darwin_arm64 planned", "1.1.0 linux_amd64 planned"}
+	if !slices.Equal(got, want) {
+		t.Errorf("items: got %q, want %q", got, want)
+	}
+
+	// A dry run writes nothing.
+	vs, err := dst.ListProviderVersions(ctx, "acme", "demo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(vs.Versions) != 1 {
+		t.Errorf("destination versions: got %+v, want only 1.0.0", vs.Versions)
+	}
+}
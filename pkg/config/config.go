@@ -1,23 +1,402 @@
 package config
 
 import (
+	"bytes"
 	"context"
+	"errors"
 	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path"
+	"slices"
+	"time"
 
 	"github.com/sethvargo/go-envconfig"
+	"gopkg.in/yaml.v3"
+
+	"github.com/yolocs/ar-terraform-registry/pkg/notify"
+)
+
+const (
+	BackendArtifactRegistry = "artifactregistry"
+	BackendFilesystem       = "filesystem"
+	BackendProxy            = "proxy"
 )
 
+// Config is loaded from the optional YAML or JSON file named by CONFIG_FILE,
+// then overridden by environment variables.
+//
+// Backends and Routes can only be set in the file and, together with the
+// health checks derived from them, are reloaded at runtime. Changes to other
+// settings require a restart.
 type Config struct {
-	Port      string `env:"PORT, default=8080"`
-	ProjectID string `env:"PROJECT_ID, required"`
-	Location  string `env:"LOCATION, default=us"`
+	// ConfigFile is the path of the config file. It's only read from the
+	// environment.
+	ConfigFile string `yaml:"-" env:"CONFIG_FILE"`
+	// ConfigPollInterval is how often the config file is checked for changes.
+	// Zero disables polling; SIGHUP always triggers a reload.
+	ConfigPollInterval time.Duration `yaml:"config_poll_interval" env:"CONFIG_POLL_INTERVAL"`
+
+	Port      string `yaml:"port" env:"PORT, default=8080"`
+	ProjectID string `yaml:"project_id" env:"PROJECT_ID"`
+	Location  string `yaml:"location" env:"LOCATION, default=us"`
+
+	// TLSCertFile and TLSKeyFile enable HTTPS. The files are reloaded when
+	// they change. TLSClientCAFile additionally verifies client certificates
+	// against the bundle, and TLSRequireClientCert makes them mandatory.
+	TLSCertFile          string `yaml:"tls_cert_file" env:"TLS_CERT_FILE"`
+	TLSKeyFile           string `yaml:"tls_key_file" env:"TLS_KEY_FILE"`
+	TLSClientCAFile      string `yaml:"tls_client_ca_file" env:"TLS_CLIENT_CA_FILE"`
+	TLSRequireClientCert bool   `yaml:"tls_require_client_cert" env:"TLS_REQUIRE_CLIENT_CERT"`
+
+	// Rate limits in requests per second; zero disables a limit. Clients are
+	// identified by their principal, or IP for anonymous requests.
+	RateLimitClientRPS      float64 `yaml:"rate_limit_client_rps" env:"RATE_LIMIT_CLIENT_RPS"`
+	RateLimitClientBurst    int     `yaml:"rate_limit_client_burst" env:"RATE_LIMIT_CLIENT_BURST"`
+	RateLimitNamespaceRPS   float64 `yaml:"rate_limit_namespace_rps" env:"RATE_LIMIT_NAMESPACE_RPS"`
+	RateLimitNamespaceBurst int     `yaml:"rate_limit_namespace_burst" env:"RATE_LIMIT_NAMESPACE_BURST"`
+	MaxAssetStreams         int     `yaml:"max_asset_streams" env:"MAX_ASSET_STREAMS"`
+	TrustForwardedFor       bool    `yaml:"trust_forwarded_for" env:"TRUST_FORWARDED_FOR"`
+
+	ReadyTimeout  time.Duration `yaml:"ready_timeout" env:"READY_TIMEOUT, default=5s"`
+	ReadyCacheTTL time.Duration `yaml:"ready_cache_ttl" env:"READY_CACHE_TTL, default=10s"`
+
+	// On SIGTERM the server reports not-ready and keeps serving for
+	// DrainDelay, then stops accepting connections and lets in-flight
+	// downloads complete for up to DrainTimeout.
+	DrainDelay   time.Duration `yaml:"drain_delay" env:"DRAIN_DELAY"`
+	DrainTimeout time.Duration `yaml:"drain_timeout" env:"DRAIN_TIMEOUT, default=30s"`
+
+	// AdminTokens maps caller names to the bearer tokens accepted by the admin
+	// API, e.g. "ci:<token>". AdminPrincipals are the client certificate
+	// principals accepted by it. The admin API is disabled unless either is
+	// set.
+	AdminTokens     map[string]string `yaml:"admin_tokens" env:"ADMIN_TOKENS"`
+	AdminPrincipals []string          `yaml:"admin_principals" env:"ADMIN_PRINCIPALS"`
+
+	// Audit events of downloads, publishing and admin API calls are written
+	// as JSON lines to AuditLogFile and, with AuditLogStdout, to stdout, and
+	// POSTed to AuditWebhookURL with the AuditWebhookHeaders.
+	AuditLogFile        string            `yaml:"audit_log_file" env:"AUDIT_LOG_FILE"`
+	AuditLogStdout      bool              `yaml:"audit_log_stdout" env:"AUDIT_LOG_STDOUT"`
+	AuditWebhookURL     string            `yaml:"audit_webhook_url" env:"AUDIT_WEBHOOK_URL"`
+	AuditWebhookHeaders map[string]string `yaml:"audit_webhook_headers" env:"AUDIT_WEBHOOK_HEADERS"`
+
+	// Webhooks are notified of published, yanked and deleted versions.
+	// Delivery attempts are appended to WebhookDeliveryLog as JSON lines.
+	Webhooks           []*Webhook `yaml:"webhooks"`
+	WebhookDeliveryLog string     `yaml:"webhook_delivery_log" env:"WEBHOOK_DELIVERY_LOG"`
+	WebhookMaxAttempts int        `yaml:"webhook_max_attempts" env:"WEBHOOK_MAX_ATTEMPTS, default=5"`
+
+	// StatsFile enables download statistics, kept in a bbolt database at the
+	// path. Counts are written every StatsFlushInterval.
+	StatsFile          string        `yaml:"stats_file" env:"STATS_FILE"`
+	StatsFlushInterval time.Duration `yaml:"stats_flush_interval" env:"STATS_FLUSH_INTERVAL, default=10s"`
+
+	// Retry policy for Artifact Registry downloads and API calls. CallTimeout
+	// bounds each attempt.
+	RetryMaxAttempts    int           `yaml:"retry_max_attempts" env:"RETRY_MAX_ATTEMPTS, default=4"`
+	RetryInitialBackoff time.Duration `yaml:"retry_initial_backoff" env:"RETRY_INITIAL_BACKOFF, default=200ms"`
+	RetryMaxBackoff     time.Duration `yaml:"retry_max_backoff" env:"RETRY_MAX_BACKOFF, default=5s"`
+	CallTimeout         time.Duration `yaml:"call_timeout" env:"CALL_TIMEOUT, default=30s"`
+
+	// GitModuleRepos maps "<namespace>/<name>/<system>" to git remotes, e.g.
+	// "acme/vpc/aws:https://github.com/acme/terraform-aws-vpc.git".
+	GitModuleRepos     map[string]string `yaml:"git_module_repos" env:"GIT_MODULE_REPOS"`
+	GitCacheDir        string            `yaml:"git_cache_dir" env:"GIT_CACHE_DIR, default=/tmp/ar-terraform-registry/git"`
+	GitRefreshInterval time.Duration     `yaml:"git_refresh_interval" env:"GIT_REFRESH_INTERVAL, default=5m"`
+	GitServeArchives   bool              `yaml:"git_serve_archives" env:"GIT_SERVE_ARCHIVES"`
+
+	// Backends and Routes default to serving every namespace from the Artifact
+	// Registry project and location above.
+	Backends []*Backend `yaml:"backends"`
+	Routes   []*Route   `yaml:"routes"`
+
+	// Syncs are background jobs copying missing versions between backends.
+	Syncs []*Sync `yaml:"syncs"`
+}
+
+// Backend declares a store that routes can send namespaces to.
+type Backend struct {
+	Name string `yaml:"name"`
+	// Type is one of "artifactregistry", "filesystem" or "proxy".
+	Type string `yaml:"type"`
+
+	// ProjectID and Location select the Artifact Registry project and
+	// location. They default to PROJECT_ID and LOCATION.
+	ProjectID string `yaml:"project_id"`
+	Location  string `yaml:"location"`
+
+	// Path is the root directory of a filesystem backend.
+	Path string `yaml:"path"`
+
+	// URL is the base URL of the upstream registry of a proxy backend.
+	URL string `yaml:"url"`
+
+	// Repositories maps public namespaces to the repository IDs (or upstream
+	// namespaces) holding them. Unmapped namespaces are used verbatim.
+	Repositories map[string]string `yaml:"repositories"`
+	// ModulePackage and ProviderPackage are package name templates, see
+	// store.Mapping.
+	ModulePackage   string `yaml:"module_package"`
+	ProviderPackage string `yaml:"provider_package"`
+}
+
+// Route sends the namespaces matching a path.Match pattern to a backend. The
+// first matching route wins.
+type Route struct {
+	Namespace string `yaml:"namespace"`
+	Backend   string `yaml:"backend"`
+}
+
+// Sync periodically copies the selected providers and modules missing in one
+// backend from another.
+type Sync struct {
+	From     string        `yaml:"from"`
+	To       string        `yaml:"to"`
+	Interval time.Duration `yaml:"interval"`
+	// Providers are "<namespace>/<name>[@<constraints>]" and Modules
+	// "<namespace>/<name>/<system>[@<constraints>]" selectors.
+	Providers []string `yaml:"providers"`
+	Modules   []string `yaml:"modules"`
+	// DryRun only logs the missing versions.
+	DryRun bool `yaml:"dry_run"`
+}
+
+// Webhook subscribes a URL to registry events, see notify.Hook.
+type Webhook struct {
+	Name string `yaml:"name"`
+	URL  string `yaml:"url"`
+	// Secret signs the payloads with HMAC-SHA256.
+	Secret string `yaml:"secret"`
+	// Namespaces are path.Match patterns; empty matches every namespace.
+	Namespaces []string `yaml:"namespaces"`
+	// Events are the notify events to send; empty sends all of them.
+	Events  []string          `yaml:"events"`
+	Headers map[string]string `yaml:"headers"`
 }
 
 func Load(ctx context.Context) (*Config, error) {
 	var c Config
-	if err := envconfig.Process(ctx, &c); err != nil {
+
+	if f := os.Getenv("CONFIG_FILE"); f != "" {
+		if err := c.readFile(f); err != nil {
+			return nil, err
+		}
+	}
+
+	// Values from the file are only overwritten by variables which are set.
+	if err := envconfig.ProcessWith(ctx, &envconfig.Config{
+		Target:           &c,
+		DefaultOverwrite: true,
+	}); err != nil {
 		return nil, fmt.Errorf("failed to load config: %w", err)
 	}
 
+	if len(c.Backends) == 0 && len(c.Routes) == 0 {
+		c.Backends = []*Backend{{Name: "default", Type: BackendArtifactRegistry}}
+		c.Routes = []*Route{{Namespace: "*", Backend: "default"}}
+	}
+	for _, b := range c.Backends {
+		if b.Type == BackendArtifactRegistry {
+			if b.ProjectID == "" {
+				b.ProjectID = c.ProjectID
+			}
+			if b.Location == "" {
+				b.Location = c.Location
+			}
+		}
+	}
+
+	if err := c.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid config: %w", err)
+	}
+
 	return &c, nil
 }
+
+// readFile decodes the config file. JSON is a subset of YAML, so one strict
+// decoder handles both and reports unknown keys with their line numbers.
+func (c *Config) readFile(path string) error {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read config file: %w", err)
+	}
+
+	dec := yaml.NewDecoder(bytes.NewReader(b))
+	dec.KnownFields(true)
+	if err := dec.Decode(c); err != nil && !errors.Is(err, io.EOF) {
+		return fmt.Errorf("failed to parse config file %s: %w", path, err)
+	}
+	return nil
+}
+
+// Validate reports every problem found in the config, naming the offending
+// setting.
+func (c *Config) Validate() error {
+	var merr error
+	if c.Port == "" {
+		merr = errors.Join(merr, fmt.Errorf("port is required"))
+	}
+	if c.ConfigPollInterval < 0 {
+		merr = errors.Join(merr, fmt.Errorf("config_poll_interval must not be negative"))
+	}
+	if c.ReadyTimeout < 0 {
+		merr = errors.Join(merr, fmt.Errorf("ready_timeout must not be negative"))
+	}
+	if c.ReadyCacheTTL < 0 {
+		merr = errors.Join(merr, fmt.Errorf("ready_cache_ttl must not be negative"))
+	}
+	if c.DrainDelay < 0 || c.DrainTimeout < 0 {
+		merr = errors.Join(merr, fmt.Errorf("drain_delay and drain_timeout must not be negative"))
+	}
+	if c.RateLimitClientRPS < 0 || c.RateLimitClientBurst < 0 {
+		merr = errors.Join(merr, fmt.Errorf("rate_limit_client_rps and rate_limit_client_burst must not be negative"))
+	}
+	if c.RateLimitNamespaceRPS < 0 || c.RateLimitNamespaceBurst < 0 {
+		merr = errors.Join(merr, fmt.Errorf("rate_limit_namespace_rps and rate_limit_namespace_burst must not be negative"))
+	}
+	if c.MaxAssetStreams < 0 {
+		merr = errors.Join(merr, fmt.Errorf("max_asset_streams must not be negative"))
+	}
+	if c.RetryMaxAttempts < 1 {
+		merr = errors.Join(merr, fmt.Errorf("retry_max_attempts must be at least 1"))
+	}
+	if c.RetryInitialBackoff < 0 || c.RetryMaxBackoff < 0 {
+		merr = errors.Join(merr, fmt.Errorf("retry_initial_backoff and retry_max_backoff must not be negative"))
+	}
+	if c.RetryInitialBackoff > c.RetryMaxBackoff {
+		merr = errors.Join(merr, fmt.Errorf("retry_initial_backoff must not exceed retry_max_backoff"))
+	}
+	if c.CallTimeout < 0 {
+		merr = errors.Join(merr, fmt.Errorf("call_timeout must not be negative"))
+	}
+	if (c.TLSCertFile == "") != (c.TLSKeyFile == "") {
+		merr = errors.Join(merr, fmt.Errorf("tls_cert_file and tls_key_file must be set together"))
+	}
+	if c.TLSClientCAFile != "" && c.TLSCertFile == "" {
+		merr = errors.Join(merr, fmt.Errorf("tls_client_ca_file requires tls_cert_file and tls_key_file"))
+	}
+	if c.TLSRequireClientCert && c.TLSClientCAFile == "" {
+		merr = errors.Join(merr, fmt.Errorf("tls_require_client_cert requires tls_client_ca_file"))
+	}
+	for name, token := range c.AdminTokens {
+		if name == "" || len(token) < 16 {
+			merr = errors.Join(merr, fmt.Errorf("admin_tokens[%q] must be named and at least 16 characters", name))
+		}
+	}
+	if len(c.AdminPrincipals) > 0 && c.TLSClientCAFile == "" {
+		merr = errors.Join(merr, fmt.Errorf("admin_principals requires tls_client_ca_file"))
+	}
+	if c.AuditWebhookURL != "" {
+		if u, err := url.Parse(c.AuditWebhookURL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			merr = errors.Join(merr, fmt.Errorf("audit_webhook_url %q is not an http(s) URL", c.AuditWebhookURL))
+		}
+	}
+	if c.WebhookMaxAttempts < 1 {
+		merr = errors.Join(merr, fmt.Errorf("webhook_max_attempts must be at least 1"))
+	}
+	merr = errors.Join(merr, c.validateWebhooks())
+	if c.StatsFlushInterval < 0 {
+		merr = errors.Join(merr, fmt.Errorf("stats_flush_interval must not be negative"))
+	}
+	return errors.Join(merr, c.validateRouting())
+}
+
+func (c *Config) validateWebhooks() error {
+	var merr error
+	names := make(map[string]struct{}, len(c.Webhooks))
+	for i, w := range c.Webhooks {
+		if w.Name == "" {
+			merr = errors.Join(merr, fmt.Errorf("webhooks[%d].name is required", i))
+		} else if _, ok := names[w.Name]; ok {
+			merr = errors.Join(merr, fmt.Errorf("webhooks[%d].name %q is used more than once", i, w.Name))
+		}
+		names[w.Name] = struct{}{}
+		if u, err := url.Parse(w.URL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			merr = errors.Join(merr, fmt.Errorf("webhooks[%d].url %q is not an http(s) URL", i, w.URL))
+		}
+		for _, ns := range w.Namespaces {
+			if _, err := path.Match(ns, ""); err != nil {
+				merr = errors.Join(merr, fmt.Errorf("webhooks[%d].namespaces %q is not a valid pattern: %w", i, ns, err))
+			}
+		}
+		for _, e := range w.Events {
+			if !slices.Contains(notify.Events, e) {
+				merr = errors.Join(merr, fmt.Errorf("webhooks[%d].events %q is not one of %v", i, e, notify.Events))
+			}
+		}
+	}
+	return merr
+}
+
+// AdminEnabled reports whether the admin API accepts any caller.
+func (c *Config) AdminEnabled() bool {
+	return len(c.AdminTokens) > 0 || len(c.AdminPrincipals) > 0
+}
+
+func (c *Config) validateRouting() error {
+	var merr error
+	names := make(map[string]struct{}, len(c.Backends))
+	for i, b := range c.Backends {
+		if b.Name == "" {
+			merr = errors.Join(merr, fmt.Errorf("backends[%d].name is required", i))
+			continue
+		}
+		if _, ok := names[b.Name]; ok {
+			merr = errors.Join(merr, fmt.Errorf("backends[%d].name %q is a duplicate", i, b.Name))
+		}
+		names[b.Name] = struct{}{}
+
+		switch b.Type {
+		case BackendArtifactRegistry:
+			if b.ProjectID == "" {
+				merr = errors.Join(merr, fmt.Errorf("backends[%d].project_id (or PROJECT_ID) is required", i))
+			}
+		case BackendFilesystem:
+			if b.Path == "" {
+				merr = errors.Join(merr, fmt.Errorf("backends[%d].path is required", i))
+			}
+		case BackendProxy:
+			if b.URL == "" {
+				merr = errors.Join(merr, fmt.Errorf("backends[%d].url is required", i))
+			}
+		default:
+			merr = errors.Join(merr, fmt.Errorf("backends[%d].type %q is not one of %q, %q or %q",
+				i, b.Type, BackendArtifactRegistry, BackendFilesystem, BackendProxy))
+		}
+	}
+
+	if len(c.Routes) == 0 {
+		merr = errors.Join(merr, fmt.Errorf("routes requires at least one route"))
+	}
+	for i, r := range c.Routes {
+		if r.Namespace == "" {
+			merr = errors.Join(merr, fmt.Errorf("routes[%d].namespace is required", i))
+		} else if _, err := path.Match(r.Namespace, ""); err != nil {
+			merr = errors.Join(merr, fmt.Errorf("routes[%d].namespace %q is not a valid pattern: %w", i, r.Namespace, err))
+		}
+		if _, ok := names[r.Backend]; !ok {
+			merr = errors.Join(merr, fmt.Errorf("routes[%d].backend %q is not a declared backend", i, r.Backend))
+		}
+	}
+
+	for i, s := range c.Syncs {
+		for _, b := range []struct{ field, name string }{{"from", s.From}, {"to", s.To}} {
+			if _, ok := names[b.name]; !ok {
+				merr = errors.Join(merr, fmt.Errorf("syncs[%d].%s %q is not a declared backend", i, b.field, b.name))
+			}
+		}
+		if s.From == s.To {
+			merr = errors.Join(merr, fmt.Errorf("syncs[%d].from and syncs[%d].to must differ", i, i))
+		}
+		if s.Interval <= 0 {
+			merr = errors.Join(merr, fmt.Errorf("syncs[%d].interval must be positive", i))
+		}
+		if len(s.Providers) == 0 && len(s.Modules) == 0 {
+			merr = errors.Join(merr, fmt.Errorf("syncs[%d] selects no providers or modules", i))
+		}
+	}
+	return merr
+}
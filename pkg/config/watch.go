@@ -0,0 +1,125 @@
+package config
+
+import (
+	"context"
+	"os"
+	"os/signal"
+	"reflect"
+	"syscall"
+	"time"
+
+	"github.com/abcxyz/pkg/logging"
+)
+
+// Watch reloads the config when the process receives SIGHUP or, if polling is
+// enabled, when the config file's modification time changes. onReload is
+// called with every config that loads and validates; invalid configs are
+// logged and the current config is kept. Settings that require a restart are
+// compared with current, the config the process started with. Watch blocks
+// until ctx is done.
+func Watch(ctx context.Context, current *Config, onReload func(context.Context, *Config) error) {
+	logger := logging.FromContext(ctx)
+
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	defer signal.Stop(hup)
+
+	var tick <-chan time.Time
+	if current.ConfigFile != "" && current.ConfigPollInterval > 0 {
+		t := time.NewTicker(current.ConfigPollInterval)
+		defer t.Stop()
+		tick = t.C
+	}
+	modTime := fileModTime(current.ConfigFile)
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-hup:
+			logger.InfoContext(ctx, "reloading config on SIGHUP")
+		case <-tick:
+			mt := fileModTime(current.ConfigFile)
+			if mt.Equal(modTime) {
+				continue
+			}
+			modTime = mt
+			logger.InfoContext(ctx, "reloading config on file change", "file", current.ConfigFile)
+		}
+
+		next, err := Load(ctx)
+		if err != nil {
+			logger.ErrorContext(ctx, "failed to reload config, keeping the current one", "error", err)
+			continue
+		}
+		if changed := current.restartRequired(next); len(changed) > 0 {
+			logger.WarnContext(ctx, "config changes that require a restart are ignored", "settings", changed)
+		}
+		if err := onReload(ctx, next); err != nil {
+			logger.ErrorContext(ctx, "failed to apply reloaded config, keeping the current one", "error", err)
+		}
+	}
+}
+
+// restartRequired lists the settings which differ between the configs but
+// can't be changed at runtime.
+func (c *Config) restartRequired(next *Config) []string {
+	var changed []string
+	for name, pair := range map[string][2]any{
+		"config_poll_interval":       {c.ConfigPollInterval, next.ConfigPollInterval},
+		"port":                       {c.Port, next.Port},
+		"tls_cert_file":              {c.TLSCertFile, next.TLSCertFile},
+		"tls_key_file":               {c.TLSKeyFile, next.TLSKeyFile},
+		"tls_client_ca_file":         {c.TLSClientCAFile, next.TLSClientCAFile},
+		"tls_require_client_cert":    {c.TLSRequireClientCert, next.TLSRequireClientCert},
+		"rate_limit_client_rps":      {c.RateLimitClientRPS, next.RateLimitClientRPS},
+		"rate_limit_client_burst":    {c.RateLimitClientBurst, next.RateLimitClientBurst},
+		"rate_limit_namespace_rps":   {c.RateLimitNamespaceRPS, next.RateLimitNamespaceRPS},
+		"rate_limit_namespace_burst": {c.RateLimitNamespaceBurst, next.RateLimitNamespaceBurst},
+		"max_asset_streams":          {c.MaxAssetStreams, next.MaxAssetStreams},
+		"trust_forwarded_for":        {c.TrustForwardedFor, next.TrustForwardedFor},
+		"ready_timeout":              {c.ReadyTimeout, next.ReadyTimeout},
+		"ready_cache_ttl":            {c.ReadyCacheTTL, next.ReadyCacheTTL},
+		"retry_max_attempts":         {c.RetryMaxAttempts, next.RetryMaxAttempts},
+		"retry_initial_backoff":      {c.RetryInitialBackoff, next.RetryInitialBackoff},
+		"retry_max_backoff":          {c.RetryMaxBackoff, next.RetryMaxBackoff},
+		"call_timeout":               {c.CallTimeout, next.CallTimeout},
+		"syncs":                      {c.Syncs, next.Syncs},
+		"git_module_repos":           {c.GitModuleRepos, next.GitModuleRepos},
+		"git_cache_dir":              {c.GitCacheDir, next.GitCacheDir},
+		"git_refresh_interval":       {c.GitRefreshInterval, next.GitRefreshInterval},
+		"git_serve_archives":         {c.GitServeArchives, next.GitServeArchives},
+		"audit_log_file":             {c.AuditLogFile, next.AuditLogFile},
+		"audit_log_stdout":           {c.AuditLogStdout, next.AuditLogStdout},
+		"audit_webhook_url":          {c.AuditWebhookURL, next.AuditWebhookURL},
+		"audit_webhook_headers":      {c.AuditWebhookHeaders, next.AuditWebhookHeaders},
+		"stats_file":                 {c.StatsFile, next.StatsFile},
+		"stats_flush_interval":       {c.StatsFlushInterval, next.StatsFlushInterval},
+		"webhooks":                   {c.Webhooks, next.Webhooks},
+		"webhook_delivery_log":       {c.WebhookDeliveryLog, next.WebhookDeliveryLog},
+		"webhook_max_attempts":       {c.WebhookMaxAttempts, next.WebhookMaxAttempts},
+		"drain_delay":                {c.DrainDelay, next.DrainDelay},
+		"drain_timeout":              {c.DrainTimeout, next.DrainTimeout},
+	} {
+		if !reflect.DeepEqual(pair[0], pair[1]) {
+			changed = append(changed, name)
+		}
+	}
+	// Admin credentials are reloaded, but the admin API is only set up at
+	// start.
+	if c.AdminEnabled() != next.AdminEnabled() {
+		changed = append(changed, "admin_tokens", "admin_principals")
+	}
+	return changed
+}
+
+func fileModTime(path string) time.Time {
+	if path == "" {
+		return time.Time{}
+	}
+	fi, err := os.Stat(path)
+	if err != nil {
+		return time.Time{}
+	}
+	return fi.ModTime()
+}
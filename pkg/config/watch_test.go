@@ -0,0 +1,39 @@
+package config
+
+import (
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestRestartRequired(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		name   string
+		change func(c *Config)
+		want   []string
+	}{
+		{name: "unchanged", change: func(c *Config) {}},
+		{name: "port", change: func(c *Config) { c.Port = "9090" }, want: []string{"port"}},
+		{name: "call timeout", change: func(c *Config) { c.CallTimeout = time.Minute }, want: []string{"call_timeout"}},
+		{name: "rotated admin token", change: func(c *Config) { c.AdminTokens = map[string]string{"ci": "new"} }},
+		{name: "admin principal", change: func(c *Config) { c.AdminPrincipals = []string{"ops"} }},
+		{name: "admin disabled", change: func(c *Config) { c.AdminTokens = nil }, want: []string{"admin_principals", "admin_tokens"}},
+		{name: "audit sinks", change: func(c *Config) { c.AuditLogStdout, c.AuditWebhookHeaders = true, map[string]string{"X-Key": "k"} }, want: []string{"audit_log_stdout", "audit_webhook_headers"}},
+		{name: "stats", change: func(c *Config) { c.StatsFile = "stats.db" }, want: []string{"stats_file"}},
+		{name: "webhooks", change: func(c *Config) { c.Webhooks, c.WebhookMaxAttempts = []*Webhook{{URL: "https://example.com/hook"}}, 3 }, want: []string{"webhook_max_attempts", "webhooks"}},
+		{name: "drain", change: func(c *Config) { c.DrainDelay = 5 * time.Second }, want: []string{"drain_delay"}},
+	}
+	for _, tc := range cases {
+		running := &Config{Port: "8080", AdminTokens: map[string]string{"ci": "old"}}
+		next := &Config{Port: "8080", AdminTokens: map[string]string{"ci": "old"}}
+		tc.change(next)
+
+		got := running.restartRequired(next)
+		slices.Sort(got)
+		if !slices.Equal(got, tc.want) {
+			t.Errorf("%s: got %q, want %q", tc.name, got, tc.want)
+		}
+	}
+}
@@ -0,0 +1,400 @@
+package conformance
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+
+	openpgp "github.com/ProtonMail/go-crypto/openpgp/v2"
+
+	"github.com/yolocs/ar-terraform-registry/pkg/model"
+)
+
+// maxBody bounds the responses read by the checks.
+const maxBody = 64 << 20
+
+// checks run in order; service discovery goes first as it sets the protocol
+// base URLs.
+var checks = []struct {
+	name string
+	run  func(context.Context, *checker) error
+}{
+	{"service discovery", checkServiceDiscovery},
+	{"module versions", checkModuleVersions},
+	{"module download", func(ctx context.Context, c *checker) error { return c.moduleDownload(ctx, "1.0.0") }},
+	{"module prerelease version", func(ctx context.Context, c *checker) error { return c.moduleDownload(ctx, "1.1.0-rc1") }},
+	{"unknown module", checkUnknownModule},
+	{"provider versions", checkProviderVersions},
+	{"provider download", checkProviderDownload},
+	{"provider prerelease version", func(ctx context.Context, c *checker) error {
+		return c.providerDownload(ctx, "1.1.0-beta1", model.Platform{OS: "linux", Arch: "amd64"})
+	}},
+	{"unknown platform", checkUnknownPlatform},
+	{"missing SHA", checkMissingSHA},
+	{"unknown provider", checkUnknownProvider},
+}
+
+func checkServiceDiscovery(ctx context.Context, c *checker) error {
+	const path = "/.well-known/terraform.json"
+	var doc map[string]any
+	if err := c.getJSON(ctx, path, "service-discovery", &doc); err != nil {
+		return err
+	}
+	var merr error
+	for key, base := range map[string]*string{"modules.v1": &c.modulesV1, "providers.v1": &c.providersV1} {
+		s, _ := doc[key].(string)
+		u, err := c.resolve(path, s)
+		if err != nil {
+			merr = errors.Join(merr, fmt.Errorf("%s: %w", key, err))
+			continue
+		}
+		*base = u
+	}
+	return errors.Join(merr, c.wantStatus(ctx, "/.well-known/unknown.json", http.StatusNotFound))
+}
+
+type moduleVersions struct {
+	Modules []struct {
+		Versions []struct {
+			Version string `json:"version"`
+		} `json:"versions"`
+	} `json:"modules"`
+}
+
+func checkModuleVersions(ctx context.Context, c *checker) error {
+	var resp moduleVersions
+	if err := c.getJSON(ctx, c.modulePath("versions"), "module-versions", &resp); err != nil {
+		return err
+	}
+	var got []string
+	for _, m := range resp.Modules {
+		for _, v := range m.Versions {
+			got = append(got, v.Version)
+		}
+	}
+	return sameVersions(got, moduleFixtures)
+}
+
+// moduleDownload checks the download of a module version: a 204 with an
+// X-Terraform-Get location serving an archive of that version.
+func (c *checker) moduleDownload(ctx context.Context, version string) error {
+	path := c.modulePath(version, "download")
+	resp, _, err := c.get(ctx, path)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusNoContent {
+		return fmt.Errorf("GET %s: want status 204, got %d", path, resp.StatusCode)
+	}
+	location := resp.Header.Get("X-Terraform-Get")
+	if location == "" {
+		return fmt.Errorf("GET %s: missing X-Terraform-Get header", path)
+	}
+	archiveURL, err := c.resolve(path, location)
+	if err != nil {
+		return fmt.Errorf("X-Terraform-Get: %w", err)
+	}
+
+	resp, body, err := c.get(ctx, archiveURL)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("GET %s: want status 200, got %d", archiveURL, resp.StatusCode)
+	}
+	main, err := readTarGz(body, "main.tf")
+	if err != nil {
+		return fmt.Errorf("GET %s: %w", archiveURL, err)
+	}
+	if !bytes.Contains(main, []byte(version)) {
+		return fmt.Errorf("GET %s: archive isn't of version %s", archiveURL, version)
+	}
+	return nil
+}
+
+func checkUnknownModule(ctx context.Context, c *checker) error {
+	return errors.Join(
+		c.wantStatus(ctx, c.modulesV1+Namespace+"/missing/"+ModuleSystem+"/versions", http.StatusNotFound),
+		c.wantStatus(ctx, c.modulePath("9.9.9", "download"), http.StatusNotFound),
+	)
+}
+
+func checkProviderVersions(ctx context.Context, c *checker) error {
+	var resp model.ProviderVersions
+	if err := c.getJSON(ctx, c.providerPath("versions"), "provider-versions", &resp); err != nil {
+		return err
+	}
+
+	var (
+		merr error
+		got  []string
+		want []string
+	)
+	for v := range providerFixtures {
+		want = append(want, v)
+	}
+	for _, v := range resp.Versions {
+		got = append(got, v.Version)
+		platforms, ok := providerFixtures[v.Version]
+		if !ok {
+			continue
+		}
+		if !samePlatforms(v.Platforms, platforms) {
+			merr = errors.Join(merr, fmt.Errorf("version %s: want platforms %v, got %v", v.Version, platforms, v.Platforms))
+		}
+	}
+	return errors.Join(sameVersions(got, want), merr)
+}
+
+func checkProviderDownload(ctx context.Context, c *checker) error {
+	var merr error
+	for _, pl := range providerFixtures["1.0.0"] {
+		merr = errors.Join(merr, c.providerDownload(ctx, "1.0.0", pl))
+	}
+	return merr
+}
+
+// providerDownload checks a provider package the way Terraform installs it:
+// the package matches the shasum, the shasum is listed in SHA256SUMS, and
+// SHA256SUMS is signed by one of the signing keys.
+func (c *checker) providerDownload(ctx context.Context, version string, pl model.Platform) error {
+	path := c.providerPath(version, "download", pl.OS, pl.Arch)
+	var p model.Provider
+	if err := c.getJSON(ctx, path, "provider-download", &p); err != nil {
+		return err
+	}
+
+	var merr error
+	if p.OS != pl.OS || p.Arch != pl.Arch {
+		merr = errors.Join(merr, fmt.Errorf("GET %s: want platform %s_%s, got %s_%s", path, pl.OS, pl.Arch, p.OS, p.Arch))
+	}
+	if want := fmt.Sprintf("terraform-provider-%s_%s_%s_%s.zip", ProviderName, version, pl.OS, pl.Arch); p.Filename != want {
+		merr = errors.Join(merr, fmt.Errorf("GET %s: want filename %q, got %q", path, want, p.Filename))
+	}
+
+	pkg, err := c.fetch(ctx, path, p.DownloadURL)
+	if err != nil {
+		return errors.Join(merr, fmt.Errorf("download_url: %w", err))
+	}
+	if sum := sha256.Sum256(pkg); hex.EncodeToString(sum[:]) != p.SHASum {
+		merr = errors.Join(merr, fmt.Errorf("download_url: package doesn't match shasum %s", p.SHASum))
+	}
+
+	sums, err := c.fetch(ctx, path, p.SHASumsURL)
+	if err != nil {
+		return errors.Join(merr, fmt.Errorf("shasums_url: %w", err))
+	}
+	if !slices.Contains(strings.Split(string(sums), "\n"), p.SHASum+"  "+p.Filename) {
+		merr = errors.Join(merr, fmt.Errorf("shasums_url: no line for %s with shasum %s", p.Filename, p.SHASum))
+	}
+
+	sig, err := c.fetch(ctx, path, p.SHASumsSignatureURL)
+	if err != nil {
+		return errors.Join(merr, fmt.Errorf("shasums_signature_url: %w", err))
+	}
+	var keyring openpgp.EntityList
+	keyIDs := make([]string, 0, len(p.SigningKeys.GPGPublicKeys))
+	for _, k := range p.SigningKeys.GPGPublicKeys {
+		els, err := openpgp.ReadArmoredKeyRing(strings.NewReader(k.ASCIIArmor))
+		if err != nil {
+			merr = errors.Join(merr, fmt.Errorf("signing key %s: %w", k.KeyID, err))
+			continue
+		}
+		keyring = append(keyring, els...)
+		keyIDs = append(keyIDs, k.KeyID)
+	}
+	_, signer, err := openpgp.VerifyDetachedSignature(keyring, bytes.NewReader(sums), bytes.NewReader(sig), nil)
+	if err != nil {
+		return errors.Join(merr, fmt.Errorf("shasums_signature_url: signature doesn't verify with the signing keys: %w", err))
+	}
+	if id := signer.PrimaryKey.KeyIdString(); !slices.Contains(keyIDs, id) {
+		merr = errors.Join(merr, fmt.Errorf("signing_keys: key_id doesn't name the signing key %s", id))
+	} else if want := c.fx.signer.PrimaryKey.KeyIdString(); id != want {
+		merr = errors.Join(merr, fmt.Errorf("signing_keys: want the published key %s, got %s", want, id))
+	}
+	return merr
+}
+
+func checkUnknownPlatform(ctx context.Context, c *checker) error {
+	return errors.Join(
+		c.wantStatus(ctx, c.providerPath("1.0.0", "download", "plan9", "mips"), http.StatusNotFound),
+		// Published for linux_amd64 only.
+		c.wantStatus(ctx, c.providerPath("1.1.0-beta1", "download", "darwin", "arm64"), http.StatusNotFound),
+	)
+}
+
+// checkMissingSHA checks that a package without a checksum isn't offered, as
+// Terraform would refuse to install it.
+func checkMissingSHA(ctx context.Context, c *checker) error {
+	return c.wantStatus(ctx, c.providerPath(providerMissingSHA, "download", "linux", "amd64"), http.StatusNotFound)
+}
+
+func checkUnknownProvider(ctx context.Context, c *checker) error {
+	return errors.Join(
+		c.wantStatus(ctx, c.providersV1+Namespace+"/missing/versions", http.StatusNotFound),
+		c.wantStatus(ctx, c.providerPath("9.9.9", "download", "linux", "amd64"), http.StatusNotFound),
+	)
+}
+
+func (c *checker) modulePath(elem ...string) string {
+	return c.modulesV1 + strings.Join(append([]string{Namespace, ModuleName, ModuleSystem}, elem...), "/")
+}
+
+func (c *checker) providerPath(elem ...string) string {
+	return c.providersV1 + strings.Join(append([]string{Namespace, ProviderName}, elem...), "/")
+}
+
+// resolve resolves a URL found in the response to path against the
+// response's URL, as Terraform does.
+func (c *checker) resolve(path, ref string) (string, error) {
+	if ref == "" {
+		return "", fmt.Errorf("empty URL")
+	}
+	base, err := url.Parse(c.url(path))
+	if err != nil {
+		return "", err
+	}
+	u, err := url.Parse(ref)
+	if err != nil {
+		return "", fmt.Errorf("invalid URL %q: %w", ref, err)
+	}
+	return base.ResolveReference(u).String(), nil
+}
+
+// url returns the URL of a path on the registry. Absolute URLs are returned
+// as is.
+func (c *checker) url(path string) string {
+	if strings.Contains(path, "://") {
+		return path
+	}
+	return c.base + path
+}
+
+// get requests a path on the registry, or an absolute URL.
+func (c *checker) get(ctx context.Context, path string) (*http.Response, []byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.url(path), nil)
+	if err != nil {
+		return nil, nil, fmt.Errorf("GET %s: %w", path, err)
+	}
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return nil, nil, fmt.Errorf("GET %s: %w", path, err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxBody))
+	if err != nil {
+		return nil, nil, fmt.Errorf("GET %s: failed to read body: %w", path, err)
+	}
+	return resp, body, nil
+}
+
+// fetch downloads a URL found in the response to path.
+func (c *checker) fetch(ctx context.Context, path, ref string) ([]byte, error) {
+	u, err := c.resolve(path, ref)
+	if err != nil {
+		return nil, err
+	}
+	resp, body, err := c.get(ctx, u)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("GET %s: want status 200, got %d", ref, resp.StatusCode)
+	}
+	return body, nil
+}
+
+// getJSON requests path, validates the response against the named schema
+// and decodes it into v.
+func (c *checker) getJSON(ctx context.Context, path, schema string, v any) error {
+	s, err := LoadSchema(schema)
+	if err != nil {
+		return err
+	}
+	resp, body, err := c.get(ctx, path)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("GET %s: want status 200, got %d", path, resp.StatusCode)
+	}
+	if ct, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type")); ct != "application/json" {
+		return fmt.Errorf("GET %s: want Content-Type application/json, got %q", path, resp.Header.Get("Content-Type"))
+	}
+
+	var doc any
+	if err := json.Unmarshal(body, &doc); err != nil {
+		return fmt.Errorf("GET %s: invalid JSON: %w", path, err)
+	}
+	if err := s.Validate(doc); err != nil {
+		return fmt.Errorf("GET %s: doesn't match %s schema:\n%w", path, schema, err)
+	}
+	if err := json.Unmarshal(body, v); err != nil {
+		return fmt.Errorf("GET %s: %w", path, err)
+	}
+	return nil
+}
+
+func (c *checker) wantStatus(ctx context.Context, path string, want int) error {
+	resp, _, err := c.get(ctx, path)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != want {
+		return fmt.Errorf("GET %s: want status %d, got %d", path, want, resp.StatusCode)
+	}
+	return nil
+}
+
+func sameVersions(got, want []string) error {
+	got, want = slices.Sorted(slices.Values(got)), slices.Sorted(slices.Values(want))
+	if !slices.Equal(got, want) {
+		return fmt.Errorf("want versions %v, got %v", want, got)
+	}
+	return nil
+}
+
+func samePlatforms(got, want []model.Platform) bool {
+	key := func(ps []model.Platform) []string {
+		ks := make([]string, 0, len(ps))
+		for _, p := range ps {
+			ks = append(ks, p.OS+"_"+p.Arch)
+		}
+		slices.Sort(ks)
+		return ks
+	}
+	return slices.Equal(key(got), key(want))
+}
+
+// readTarGz returns the content of a file in a tar.gz archive.
+func readTarGz(b []byte, name string) ([]byte, error) {
+	gr, err := gzip.NewReader(bytes.NewReader(b))
+	if err != nil {
+		return nil, fmt.Errorf("archive isn't gzipped: %w", err)
+	}
+	tr := tar.NewReader(gr)
+	for {
+		h, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			return nil, fmt.Errorf("archive has no %s", name)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid archive: %w", err)
+		}
+		if h.Name == name {
+			return io.ReadAll(tr)
+		}
+	}
+}
@@ -0,0 +1,116 @@
+// Package conformance checks that the registry's responses match what the
+// Terraform CLI expects from the service discovery, module registry and
+// provider registry protocols. It serves a filesystem store seeded with
+// fixtures, including prerelease versions, a platform that isn't published and
+// a package missing from its SHA256SUMS, and validates every response against
+// the documented JSON schemas.
+package conformance
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+
+	"github.com/yolocs/ar-terraform-registry/pkg/server"
+	"github.com/yolocs/ar-terraform-registry/pkg/store"
+)
+
+type Config struct {
+	// Dir is the root of the seeded filesystem store. It must be empty or not
+	// exist. Defaults to a temporary directory removed after the run.
+	Dir string
+	// Logger receives the server's logs. Defaults to discarding them.
+	Logger *slog.Logger
+}
+
+// Result is the outcome of one check.
+type Result struct {
+	Name string
+	// Err lists every violation found, nil if the check passed.
+	Err error
+}
+
+type Report struct {
+	Results []*Result
+}
+
+// Failed returns the failed checks.
+func (r *Report) Failed() []*Result {
+	var failed []*Result
+	for _, res := range r.Results {
+		if res.Err != nil {
+			failed = append(failed, res)
+		}
+	}
+	return failed
+}
+
+// Run seeds the store, serves it with server.Registry in process and runs
+// every check against it. The error is only set if the registry couldn't be
+// set up; failed checks are reported in the Report.
+func Run(ctx context.Context, cfg *Config) (*Report, error) {
+	dir := cfg.Dir
+	if dir == "" {
+		tmp, err := os.MkdirTemp("", "registry-conformance-")
+		if err != nil {
+			return nil, fmt.Errorf("failed to create store directory: %w", err)
+		}
+		defer os.RemoveAll(tmp)
+		dir = tmp
+	} else if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create store directory: %w", err)
+	}
+
+	fs, err := store.NewFilesystem(&store.FilesystemConfig{Root: dir})
+	if err != nil {
+		return nil, err
+	}
+	fx, err := seed(ctx, fs)
+	if err != nil {
+		return nil, fmt.Errorf("failed to seed store: %w", err)
+	}
+
+	logger := cfg.Logger
+	if logger == nil {
+		logger = slog.New(slog.NewTextHandler(io.Discard, nil))
+	}
+	reg, err := server.New(&server.Config{
+		Providers: fs,
+		Modules:   fs,
+		Logger:    logger,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create registry: %w", err)
+	}
+	srv := httptest.NewServer(reg.Handler())
+	defer srv.Close()
+
+	c := &checker{
+		base:        srv.URL,
+		client:      srv.Client(),
+		fx:          fx,
+		modulesV1:   "/v1/modules/",
+		providersV1: "/v1/providers/",
+	}
+	report := &Report{}
+	for _, chk := range checks {
+		report.Results = append(report.Results, &Result{Name: chk.name, Err: chk.run(ctx, c)})
+	}
+	return report, nil
+}
+
+// checker holds the state shared by the checks.
+type checker struct {
+	base   string
+	client *http.Client
+	fx     *fixtures
+
+	// modulesV1 and providersV1 are the protocol base URLs, as announced by
+	// service discovery.
+	modulesV1   string
+	providersV1 string
+}
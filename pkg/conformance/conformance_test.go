@@ -0,0 +1,18 @@
+package conformance
+
+import (
+	"context"
+	"testing"
+)
+
+func TestConformance(t *testing.T) {
+	t.Parallel()
+
+	report, err := Run(context.Background(), &Config{Dir: t.TempDir()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, res := range report.Failed() {
+		t.Errorf("%s: %v", res.Name, res.Err)
+	}
+}
@@ -0,0 +1,162 @@
+package conformance
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+
+	"github.com/ProtonMail/go-crypto/openpgp/armor"
+	openpgp "github.com/ProtonMail/go-crypto/openpgp/v2"
+
+	"github.com/yolocs/ar-terraform-registry/pkg/model"
+	"github.com/yolocs/ar-terraform-registry/pkg/store"
+)
+
+// The fixtures seeded into the store.
+const (
+	Namespace    = "conformance"
+	ProviderName = "demo"
+	ModuleName   = "network"
+	ModuleSystem = "aws"
+
+	// providerMissingSHA is published with a SHA256SUMS file that doesn't
+	// list its package.
+	providerMissingSHA = "2.0.0"
+)
+
+// providerFixtures are the published provider versions and their platforms.
+var providerFixtures = map[string][]model.Platform{
+	"1.0.0":            {{OS: "linux", Arch: "amd64"}, {OS: "darwin", Arch: "arm64"}},
+	"1.1.0-beta1":      {{OS: "linux", Arch: "amd64"}},
+	providerMissingSHA: {{OS: "linux", Arch: "amd64"}},
+}
+
+// moduleFixtures are the published module versions.
+var moduleFixtures = []string{"1.0.0", "1.1.0-rc1"}
+
+// fixtures is what was seeded, for the checks to compare with.
+type fixtures struct {
+	// signer signed the SHA256SUMS of the providers.
+	signer *openpgp.Entity
+}
+
+// seed publishes the fixtures to the filesystem store.
+func seed(ctx context.Context, fs *store.Filesystem) (*fixtures, error) {
+	signer, err := openpgp.NewEntity("Conformance", "", "conformance@example.com", nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate signing key: %w", err)
+	}
+	var key bytes.Buffer
+	w, err := armor.Encode(&key, openpgp.PublicKeyType, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to armor signing key: %w", err)
+	}
+	if err := signer.Serialize(w); err != nil {
+		return nil, fmt.Errorf("failed to serialize signing key: %w", err)
+	}
+	if err := w.Close(); err != nil {
+		return nil, fmt.Errorf("failed to armor signing key: %w", err)
+	}
+
+	if err := fs.CreateNamespace(ctx, Namespace); err != nil {
+		return nil, err
+	}
+	for version, platforms := range providerFixtures {
+		if err := seedProvider(ctx, fs, signer, key.Bytes(), version, platforms); err != nil {
+			return nil, fmt.Errorf("failed to seed provider %s: %w", version, err)
+		}
+	}
+	for _, version := range moduleFixtures {
+		archive, err := moduleArchive(version)
+		if err != nil {
+			return nil, err
+		}
+		if err := fs.PutModuleArchive(ctx, Namespace, ModuleName, ModuleSystem, version, "tar.gz", "", bytes.NewReader(archive)); err != nil {
+			return nil, fmt.Errorf("failed to seed module %s: %w", version, err)
+		}
+	}
+	return &fixtures{signer: signer}, nil
+}
+
+func seedProvider(ctx context.Context, fs *store.Filesystem, signer *openpgp.Entity, key []byte, version string, platforms []model.Platform) error {
+	prefix := fmt.Sprintf("terraform-provider-%s_%s", ProviderName, version)
+
+	zips := make(map[model.Platform][]byte, len(platforms))
+	var sums bytes.Buffer
+	for _, pl := range platforms {
+		b, err := providerZip(version, pl)
+		if err != nil {
+			return err
+		}
+		zips[pl] = b
+		name := fmt.Sprintf("%s_%s_%s.zip", prefix, pl.OS, pl.Arch)
+		if version == providerMissingSHA {
+			name = "terraform-provider-other_" + version + ".zip"
+		}
+		sum := sha256.Sum256(b)
+		fmt.Fprintf(&sums, "%s  %s\n", hex.EncodeToString(sum[:]), name)
+	}
+	var sig bytes.Buffer
+	if err := openpgp.DetachSign(&sig, []*openpgp.Entity{signer}, bytes.NewReader(sums.Bytes()), nil); err != nil {
+		return fmt.Errorf("failed to sign SHA256SUMS: %w", err)
+	}
+
+	for _, pl := range platforms {
+		files := map[string][]byte{
+			fmt.Sprintf("%s_%s_%s.zip", prefix, pl.OS, pl.Arch): zips[pl],
+			prefix + "_SHA256SUMS":                              sums.Bytes(),
+			prefix + "_SHA256SUMS.sig":                          sig.Bytes(),
+			prefix + "_gpg-public-key.pem":                      key,
+		}
+		for name, b := range files {
+			if err := fs.PutProviderFile(ctx, Namespace, ProviderName, version, pl.OS, pl.Arch, name, bytes.NewReader(b)); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// providerZip returns a package holding a placeholder executable.
+func providerZip(version string, pl model.Platform) ([]byte, error) {
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	w, err := zw.Create(fmt.Sprintf("terraform-provider-%s_v%s", ProviderName, version))
+	if err != nil {
+		return nil, err
+	}
+	if _, err := fmt.Fprintf(w, "%s %s_%s\n", version, pl.OS, pl.Arch); err != nil {
+		return nil, err
+	}
+	if err := zw.Close(); err != nil {
+		return nil, fmt.Errorf("failed to create provider package: %w", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// moduleArchive returns a tar.gz archive of a module with a main.tf.
+func moduleArchive(version string) ([]byte, error) {
+	main := []byte(fmt.Sprintf("# %s %s\nvariable \"cidr\" {\n  type = string\n}\n", ModuleName, version))
+
+	var buf bytes.Buffer
+	gw := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gw)
+	if err := tw.WriteHeader(&tar.Header{Name: "main.tf", Mode: 0o644, Size: int64(len(main))}); err != nil {
+		return nil, err
+	}
+	if _, err := tw.Write(main); err != nil {
+		return nil, err
+	}
+	if err := tw.Close(); err != nil {
+		return nil, fmt.Errorf("failed to create module archive: %w", err)
+	}
+	if err := gw.Close(); err != nil {
+		return nil, fmt.Errorf("failed to create module archive: %w", err)
+	}
+	return buf.Bytes(), nil
+}
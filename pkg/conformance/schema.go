@@ -0,0 +1,150 @@
+package conformance
+
+import (
+	"embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+)
+
+// schemaFS holds the JSON schemas of the documented responses.
+//
+//go:embed schemas/*.json
+var schemaFS embed.FS
+
+// Schema is the subset of JSON Schema needed to describe the registry
+// protocols: types, required and nested properties, array items and string
+// patterns.
+type Schema struct {
+	Description string             `json:"description"`
+	Type        string             `json:"type"`
+	Required    []string           `json:"required"`
+	Properties  map[string]*Schema `json:"properties"`
+	Items       *Schema            `json:"items"`
+	MinItems    int                `json:"minItems"`
+	Pattern     string             `json:"pattern"`
+
+	pattern *regexp.Regexp
+}
+
+// LoadSchema returns the embedded schema, e.g. "provider-download".
+func LoadSchema(name string) (*Schema, error) {
+	b, err := schemaFS.ReadFile("schemas/" + name + ".json")
+	if err != nil {
+		return nil, fmt.Errorf("failed to read schema %s: %w", name, err)
+	}
+	var s Schema
+	if err := json.Unmarshal(b, &s); err != nil {
+		return nil, fmt.Errorf("failed to parse schema %s: %w", name, err)
+	}
+	if err := s.compile(); err != nil {
+		return nil, fmt.Errorf("invalid schema %s: %w", name, err)
+	}
+	return &s, nil
+}
+
+func (s *Schema) compile() error {
+	if s.Pattern != "" {
+		re, err := regexp.Compile(s.Pattern)
+		if err != nil {
+			return err
+		}
+		s.pattern = re
+	}
+	for _, p := range s.Properties {
+		if err := p.compile(); err != nil {
+			return err
+		}
+	}
+	if s.Items != nil {
+		return s.Items.compile()
+	}
+	return nil
+}
+
+// Validate reports every violation of the schema in the decoded JSON value,
+// with its path, e.g. "$.versions[0].platforms".
+func (s *Schema) Validate(v any) error {
+	return s.validate("$", v)
+}
+
+func (s *Schema) validate(path string, v any) error {
+	switch s.Type {
+	case "object":
+		obj, ok := v.(map[string]any)
+		if !ok {
+			return fmt.Errorf("%s: want object, got %s", path, jsonType(v))
+		}
+		var merr error
+		for _, name := range s.Required {
+			if _, ok := obj[name]; !ok {
+				merr = errors.Join(merr, fmt.Errorf("%s: missing required property %q", path, name))
+			}
+		}
+		names := make([]string, 0, len(s.Properties))
+		for name := range s.Properties {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			if pv, ok := obj[name]; ok {
+				merr = errors.Join(merr, s.Properties[name].validate(path+"."+name, pv))
+			}
+		}
+		return merr
+
+	case "array":
+		arr, ok := v.([]any)
+		if !ok {
+			return fmt.Errorf("%s: want array, got %s", path, jsonType(v))
+		}
+		if len(arr) < s.MinItems {
+			return fmt.Errorf("%s: want at least %d items, got %d", path, s.MinItems, len(arr))
+		}
+		var merr error
+		if s.Items != nil {
+			for i, item := range arr {
+				merr = errors.Join(merr, s.Items.validate(fmt.Sprintf("%s[%d]", path, i), item))
+			}
+		}
+		return merr
+
+	case "string":
+		str, ok := v.(string)
+		if !ok {
+			return fmt.Errorf("%s: want string, got %s", path, jsonType(v))
+		}
+		if s.pattern != nil && !s.pattern.MatchString(str) {
+			return fmt.Errorf("%s: %q doesn't match %q", path, str, s.Pattern)
+		}
+		return nil
+
+	case "":
+		return nil
+	}
+
+	if got := jsonType(v); got != s.Type {
+		return fmt.Errorf("%s: want %s, got %s", path, s.Type, got)
+	}
+	return nil
+}
+
+func jsonType(v any) string {
+	switch v.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case float64:
+		return "number"
+	case string:
+		return "string"
+	case []any:
+		return "array"
+	case map[string]any:
+		return "object"
+	}
+	return fmt.Sprintf("%T", v)
+}
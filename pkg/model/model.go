@@ -2,15 +2,28 @@ package model
 
 import (
 	"context"
+	"errors"
 	"io"
+	"time"
 )
 
+// ErrAlreadyExists is returned by writers for files that are already stored.
+// Published versions are immutable.
+var ErrAlreadyExists = errors.New("already exists")
+
+// ErrNotFound is returned by optional lookups, such as module metadata, for
+// data that was never stored.
+var ErrNotFound = errors.New("not found")
+
 type ModuleVersion struct {
 	// Version is a SemVer version string that specifies the version for a module.
 	Version string
 	// SourceURL specifies the download URL where Terraform can get the module source.
 	// https://www.terraform.io/language/modules/sources
 	SourceURL string
+	// Subdir is an optional path inside the archive where the module lives,
+	// for monorepo archives that contain several modules.
+	Subdir string
 }
 
 type ProviderVersions struct {
@@ -77,6 +90,29 @@ type ProviderManifest struct {
 type ModuleStore interface {
 	ListModuleVersions(ctx context.Context, namespace, name, system string) ([]*ModuleVersion, error)
 	GetModuleVersion(ctx context.Context, namespace, name, system, version string) (*ModuleVersion, error)
+	GetModuleArchive(ctx context.Context, namespace, fileName string) (io.ReadCloser, error)
+}
+
+// Asset is an opened provider asset or module archive with the metadata
+// needed to serve it with HTTP caching and range requests.
+type Asset struct {
+	io.ReadSeekCloser
+	Size    int64
+	ModTime time.Time
+	// SHA256 is the hex encoded digest of the content, if known.
+	SHA256 string
+}
+
+// ProviderAssetOpener is optionally implemented by provider stores that can
+// open assets with metadata and random access.
+type ProviderAssetOpener interface {
+	OpenProviderAsset(ctx context.Context, namespace, fileName string) (*Asset, error)
+}
+
+// ModuleArchiveOpener is optionally implemented by module stores that can
+// open archives with metadata and random access.
+type ModuleArchiveOpener interface {
+	OpenModuleArchive(ctx context.Context, namespace, fileName string) (*Asset, error)
 }
 
 // ProviderStore is the store implementation interface for building custom provider stores
@@ -85,3 +121,171 @@ type ProviderStore interface {
 	GetProviderVersion(ctx context.Context, namespace string, name string, version string, os string, arch string) (*Provider, error)
 	GetProviderAsset(ctx context.Context, namespace string, fileName string) (io.ReadCloser, error)
 }
+
+// ProviderHasher is optionally implemented by provider stores that can compute
+// the "h1:" hash Terraform records in lock files for a platform package.
+// Hashes are cached in the store's version metadata.
+type ProviderHasher interface {
+	ProviderPackageHash(ctx context.Context, namespace, name, version, os, arch string) (string, error)
+}
+
+// ProviderWriter is optionally implemented by provider stores that can
+// publish providers.
+type ProviderWriter interface {
+	// PutProviderFile stores one file of a provider version for a platform.
+	// fileName is the name without the store's package and version prefix,
+	// e.g. "terraform-provider-foo_1.0.0_linux_amd64.zip" or
+	// "terraform-provider-foo_1.0.0_SHA256SUMS".
+	PutProviderFile(ctx context.Context, namespace, name, version, os, arch, fileName string, r io.Reader) error
+}
+
+// ModuleWriter is optionally implemented by module stores that can publish
+// modules.
+type ModuleWriter interface {
+	// PutModuleArchive stores the archive of a module version. format is
+	// "tar.gz", "tgz" or "zip", and subdir the optional path of the module
+	// inside the archive.
+	PutModuleArchive(ctx context.Context, namespace, name, system, version, format, subdir string, r io.Reader) error
+}
+
+// ModuleMetadata describes the Terraform configuration in a module version's
+// archive. It's extracted when the version is published.
+type ModuleMetadata struct {
+	Root       *ModuleConfig   `json:"root"`
+	Submodules []*ModuleConfig `json:"submodules"`
+	Examples   []*ModuleConfig `json:"examples"`
+}
+
+// ModuleConfig describes one module directory of an archive.
+type ModuleConfig struct {
+	// Path is relative to the module's root, empty for the root itself.
+	Path string `json:"path"`
+	// Readme is the content of the directory's README.md, if any.
+	Readme string `json:"readme,omitempty"`
+	// RequiredVersion holds the required_version constraints of the terraform
+	// blocks.
+	RequiredVersion      []string                    `json:"required_version,omitempty"`
+	Inputs               []*ModuleInput              `json:"inputs"`
+	Outputs              []*ModuleOutput             `json:"outputs"`
+	Resources            []*ModuleResource           `json:"resources"`
+	Dependencies         []*ModuleDependency         `json:"dependencies"`
+	ProviderDependencies []*ModuleProviderDependency `json:"provider_dependencies"`
+}
+
+type ModuleInput struct {
+	Name        string `json:"name"`
+	Type        string `json:"type,omitempty"`
+	Description string `json:"description,omitempty"`
+	// Default is the JSON representation of the default value.
+	Default   any  `json:"default,omitempty"`
+	Required  bool `json:"required"`
+	Sensitive bool `json:"sensitive,omitempty"`
+}
+
+type ModuleOutput struct {
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+	Sensitive   bool   `json:"sensitive,omitempty"`
+}
+
+type ModuleResource struct {
+	Name string `json:"name"`
+	Type string `json:"type"`
+	// Mode is "managed" or "data".
+	Mode string `json:"mode"`
+}
+
+// ModuleDependency is a module call.
+type ModuleDependency struct {
+	Name    string `json:"name"`
+	Source  string `json:"source"`
+	Version string `json:"version,omitempty"`
+}
+
+// ModuleProviderDependency is an entry of required_providers.
+type ModuleProviderDependency struct {
+	Name      string `json:"name"`
+	Namespace string `json:"namespace"`
+	Source    string `json:"source"`
+	Version   string `json:"version,omitempty"`
+}
+
+// ModuleMetadataWriter is optionally implemented by module stores that keep
+// the metadata of published versions.
+type ModuleMetadataWriter interface {
+	PutModuleMetadata(ctx context.Context, namespace, name, system, version string, md *ModuleMetadata) error
+}
+
+// ModuleMetadataReader is optionally implemented by module stores that keep
+// the metadata of published versions. It returns ErrNotFound for versions
+// without metadata.
+type ModuleMetadataReader interface {
+	GetModuleMetadata(ctx context.Context, namespace, name, system, version string) (*ModuleMetadata, error)
+}
+
+// Package kinds.
+const (
+	KindProvider = "provider"
+	KindModule   = "module"
+)
+
+// PackageRef identifies a provider or module of a namespace.
+type PackageRef struct {
+	Kind string
+	Name string
+	// System is only set for modules.
+	System string
+}
+
+// Catalog is optionally implemented by stores that can enumerate the
+// namespaces and packages they hold.
+type Catalog interface {
+	ListNamespaces(ctx context.Context) ([]string, error)
+	ListPackages(ctx context.Context, namespace string) ([]*PackageRef, error)
+}
+
+// VersionInfo describes a stored version. A provider version covers all the
+// platforms published for it.
+type VersionInfo struct {
+	Version   string     `json:"version"`
+	Yanked    bool       `json:"yanked"`
+	Platforms []Platform `json:"platforms,omitempty"`
+}
+
+// FileInfo describes a stored file.
+type FileInfo struct {
+	// Name is the file name in the store, including the package and version
+	// prefix.
+	Name    string    `json:"name"`
+	Size    int64     `json:"size"`
+	SHA256  string    `json:"sha256,omitempty"`
+	ModTime time.Time `json:"mod_time"`
+}
+
+// Admin is optionally implemented by stores that can be managed through the
+// admin API. Provider versions are addressed without platform, so operations
+// apply to every platform of the version.
+//
+// Yanked versions are left out of ListProviderVersions and
+// ListModuleVersions, but can still be downloaded by clients that already
+// depend on them. Lookups of missing packages and versions return
+// ErrNotFound.
+type Admin interface {
+	Catalog
+	// CreateNamespace creates the repository holding the namespace. It
+	// returns ErrAlreadyExists if it already exists.
+	CreateNamespace(ctx context.Context, namespace string) error
+	// ListVersions lists all versions of a package, including yanked ones.
+	ListVersions(ctx context.Context, namespace string, ref *PackageRef) ([]*VersionInfo, error)
+	// ListVersionFiles lists the files of a version.
+	ListVersionFiles(ctx context.Context, namespace string, ref *PackageRef, version string) ([]*FileInfo, error)
+	DeletePackage(ctx context.Context, namespace string, ref *PackageRef) error
+	DeleteVersion(ctx context.Context, namespace string, ref *PackageRef, version string) error
+	SetYanked(ctx context.Context, namespace string, ref *PackageRef, version string, yanked bool) error
+}
+
+// HealthChecker is optionally implemented by stores and their dependencies to
+// report whether the backend is reachable. Implementations should be cheap.
+type HealthChecker interface {
+	CheckHealth(ctx context.Context) error
+}
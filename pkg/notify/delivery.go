@@ -0,0 +1,97 @@
+package notify
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+)
+
+// Delivery is one attempt to deliver a payload.
+type Delivery struct {
+	Time time.Time `json:"time"`
+	// ID is the payload ID.
+	ID      string `json:"id"`
+	Hook    string `json:"hook"`
+	URL     string `json:"url"`
+	Event   string `json:"event"`
+	Attempt int    `json:"attempt"`
+	// Status is the HTTP status of the response, zero if there was none.
+	Status   int    `json:"status,omitempty"`
+	Error    string `json:"error,omitempty"`
+	Duration string `json:"duration"`
+}
+
+// DeliveryLog keeps the recent delivery attempts in memory and optionally
+// appends all of them to a file as JSON lines. The zero value keeps the last
+// 100 in memory.
+type DeliveryLog struct {
+	mu     sync.Mutex
+	f      *os.File
+	size   int
+	recent []*Delivery
+	next   int
+}
+
+// NewDeliveryLog appends the deliveries to the file, creating it if needed,
+// and keeps the last size of them in memory.
+func NewDeliveryLog(path string, size int) (*DeliveryLog, error) {
+	l := &DeliveryLog{size: size}
+	if path != "" {
+		f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o600)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open webhook delivery log: %w", err)
+		}
+		l.f = f
+	}
+	return l, nil
+}
+
+// Record adds a delivery attempt.
+func (l *DeliveryLog) Record(d *Delivery) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	size := l.size
+	if size <= 0 {
+		size = defaultRecent
+	}
+	if len(l.recent) < size {
+		l.recent = append(l.recent, d)
+	} else {
+		l.recent[l.next] = d
+	}
+	l.next = (l.next + 1) % size
+
+	if l.f == nil {
+		return nil
+	}
+	b, err := json.Marshal(d)
+	if err != nil {
+		return fmt.Errorf("failed to marshal webhook delivery: %w", err)
+	}
+	if _, err := l.f.Write(append(b, '\n')); err != nil {
+		return fmt.Errorf("failed to write webhook delivery: %w", err)
+	}
+	return nil
+}
+
+// Recent returns the recent delivery attempts, newest first.
+func (l *DeliveryLog) Recent() []*Delivery {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	ds := make([]*Delivery, 0, len(l.recent))
+	for i := range len(l.recent) {
+		ds = append(ds, l.recent[(l.next-1-i+len(l.recent))%len(l.recent)])
+	}
+	return ds
+}
+
+func (l *DeliveryLog) Close() error {
+	if l.f == nil {
+		return nil
+	}
+	return l.f.Close()
+}
@@ -0,0 +1,146 @@
+package notify
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+)
+
+const (
+	// EventHeader names the event of a request.
+	EventHeader = "X-Registry-Event"
+	// DeliveryHeader is the payload ID, the same across retries.
+	DeliveryHeader = "X-Registry-Delivery"
+	// SignatureHeader is "sha256=<hex HMAC-SHA256 of the body keyed by the
+	// hook's secret>".
+	SignatureHeader = "X-Registry-Signature"
+)
+
+// Sign returns the SignatureHeader value of a body.
+func Sign(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// hookQueue delivers the payloads of one hook in order.
+type hookQueue struct {
+	n      *Notifier
+	hook   *Hook
+	client *http.Client
+	queue  chan *Payload
+}
+
+func newHookQueue(n *Notifier, h *Hook, size int, timeout time.Duration) *hookQueue {
+	return &hookQueue{
+		n:      n,
+		hook:   h,
+		client: &http.Client{Timeout: timeout},
+		queue:  make(chan *Payload, size),
+	}
+}
+
+func (q *hookQueue) run() {
+	defer q.n.wg.Done()
+	for p := range q.queue {
+		if err := q.deliver(p); err != nil {
+			q.n.logger.Error("failed to deliver webhook", "hook", q.hook.Name, "event", p.Event, "id", p.ID, "error", err)
+		}
+	}
+}
+
+// deliver sends the payload, retrying network errors and 429 and 5xx
+// responses with exponential backoff.
+func (q *hookQueue) deliver(p *Payload) error {
+	body, err := json.Marshal(p)
+	if err != nil {
+		return fmt.Errorf("failed to marshal webhook payload: %w", err)
+	}
+
+	maxAttempts := q.n.cfg.MaxAttempts
+	if maxAttempts <= 0 {
+		maxAttempts = defaultMaxAttempts
+	}
+	backoff := q.n.cfg.InitialBackoff
+	if backoff <= 0 {
+		backoff = defaultInitialBackoff
+	}
+	maxBackoff := q.n.cfg.MaxBackoff
+	if maxBackoff <= 0 {
+		maxBackoff = defaultMaxBackoff
+	}
+
+	for attempt := 1; ; attempt++ {
+		d := &Delivery{
+			Time:    time.Now().UTC(),
+			ID:      p.ID,
+			Hook:    q.hook.Name,
+			URL:     q.hook.URL,
+			Event:   p.Event,
+			Attempt: attempt,
+		}
+		retry, err := q.post(p, body, d)
+		d.Duration = time.Since(d.Time).Round(time.Millisecond).String()
+		if err != nil {
+			d.Error = err.Error()
+		}
+		if err := q.n.log.Record(d); err != nil {
+			q.n.logger.Error("failed to record webhook delivery", "hook", q.hook.Name, "error", err)
+		}
+
+		if err == nil {
+			return nil
+		}
+		if !retry || attempt >= maxAttempts {
+			return err
+		}
+		select {
+		case <-q.n.stop:
+			return err
+		case <-time.After(backoff):
+		}
+		backoff = min(backoff*2, maxBackoff)
+	}
+}
+
+// post sends the payload once, records the response status in d and reports
+// whether a failure may be retried.
+func (q *hookQueue) post(p *Payload, body []byte, d *Delivery) (bool, error) {
+	req, err := http.NewRequest(http.MethodPost, q.hook.URL, bytes.NewReader(body))
+	if err != nil {
+		return false, fmt.Errorf("failed to create request: %w", err)
+	}
+	for k, v := range q.hook.Headers {
+		req.Header.Set(k, v)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "ar-terraform-registry-webhook")
+	req.Header.Set(EventHeader, p.Event)
+	req.Header.Set(DeliveryHeader, p.ID)
+	if q.hook.Secret != "" {
+		req.Header.Set(SignatureHeader, Sign(q.hook.Secret, body))
+	}
+
+	resp, err := q.client.Do(req)
+	if err != nil {
+		return true, fmt.Errorf("failed to post webhook: %w", err)
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 1<<16))
+	d.Status = resp.StatusCode
+
+	switch {
+	case resp.StatusCode < 300:
+		return false, nil
+	case resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500:
+		return true, fmt.Errorf("webhook returned %s", resp.Status)
+	default:
+		return false, fmt.Errorf("webhook returned %s", resp.Status)
+	}
+}
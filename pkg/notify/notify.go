@@ -0,0 +1,242 @@
+// Package notify sends webhooks when providers and modules are published,
+// yanked or deleted, so consumers can react to new releases.
+package notify
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"log/slog"
+	"path"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/yolocs/ar-terraform-registry/pkg/audit"
+)
+
+// Events.
+const (
+	EventProviderPublished = "provider.published"
+	EventModulePublished   = "module.published"
+	EventVersionYanked     = "version.yanked"
+	EventVersionUnyanked   = "version.unyanked"
+	EventVersionDeleted    = "version.deleted"
+	EventPackageDeleted    = "package.deleted"
+)
+
+// Events are the events hooks can subscribe to.
+var Events = []string{
+	EventProviderPublished,
+	EventModulePublished,
+	EventVersionYanked,
+	EventVersionUnyanked,
+	EventVersionDeleted,
+	EventPackageDeleted,
+}
+
+// actionEvents maps the audited actions to the events they fire.
+var actionEvents = map[string]string{
+	audit.ActionProviderPublish: EventProviderPublished,
+	audit.ActionModulePublish:   EventModulePublished,
+	audit.ActionVersionYank:     EventVersionYanked,
+	audit.ActionVersionUnyank:   EventVersionUnyanked,
+	audit.ActionVersionDelete:   EventVersionDeleted,
+	audit.ActionPackageDelete:   EventPackageDeleted,
+}
+
+const (
+	defaultQueueSize      = 1000
+	defaultTimeout        = 10 * time.Second
+	defaultMaxAttempts    = 5
+	defaultInitialBackoff = time.Second
+	defaultMaxBackoff     = time.Minute
+	defaultRecent         = 100
+)
+
+// Hook is a subscriber URL.
+type Hook struct {
+	Name string
+	URL  string
+	// Secret signs the payloads, see SignatureHeader. Unsigned if empty.
+	Secret string
+	// Namespaces are path.Match patterns of the namespaces to notify about.
+	// Empty matches every namespace.
+	Namespaces []string
+	// Events to send. Empty sends all of them.
+	Events []string
+	// Headers are added to every request.
+	Headers map[string]string
+}
+
+func (h *Hook) matches(event, namespace string) bool {
+	if len(h.Events) > 0 && !slices.Contains(h.Events, event) {
+		return false
+	}
+	if len(h.Namespaces) == 0 {
+		return true
+	}
+	return slices.ContainsFunc(h.Namespaces, func(p string) bool {
+		ok, _ := path.Match(p, namespace)
+		return ok
+	})
+}
+
+type Config struct {
+	Hooks []*Hook
+	// MaxAttempts bounds the deliveries of each payload. Defaults to 5.
+	MaxAttempts int
+	// InitialBackoff is the wait before the first retry, doubling up to
+	// MaxBackoff. Defaults to 1s and 1m.
+	InitialBackoff time.Duration
+	MaxBackoff     time.Duration
+	// Timeout bounds each request. Defaults to 10s.
+	Timeout time.Duration
+	// QueueSize bounds the payloads waiting per hook. Payloads are dropped
+	// while the queue is full. Defaults to 1000.
+	QueueSize int
+	// DeliveryLog records every delivery attempt. Nil only keeps the recent
+	// ones in memory.
+	DeliveryLog *DeliveryLog
+	Logger      *slog.Logger
+}
+
+// Payload is the JSON body of a webhook request.
+type Payload struct {
+	// ID identifies the payload across retries.
+	ID        string    `json:"id"`
+	Event     string    `json:"event"`
+	Time      time.Time `json:"time"`
+	Namespace string    `json:"namespace"`
+	// Kind is "provider" or "module".
+	Kind    string `json:"kind"`
+	Name    string `json:"name"`
+	System  string `json:"system,omitempty"`
+	Version string `json:"version,omitempty"`
+	// OS and Arch are the platform of a published provider package.
+	OS        string `json:"os,omitempty"`
+	Arch      string `json:"arch,omitempty"`
+	Principal string `json:"principal,omitempty"`
+}
+
+// Notifier sends the payloads of successful publish, yank and delete events
+// to the subscribed hooks. It's an audit.Sink, so it sees the same events as
+// the audit log. Each hook is served by its own queue, so a failing hook
+// doesn't delay the others.
+type Notifier struct {
+	cfg    *Config
+	logger *slog.Logger
+	hooks  []*hookQueue
+	log    *DeliveryLog
+
+	// stop aborts retry backoffs on Close.
+	stop chan struct{}
+	wg   sync.WaitGroup
+
+	mu     sync.RWMutex
+	closed bool
+}
+
+var _ audit.Sink = (*Notifier)(nil)
+
+func New(cfg *Config) *Notifier {
+	n := &Notifier{
+		cfg:    cfg,
+		logger: cfg.Logger,
+		log:    cfg.DeliveryLog,
+		stop:   make(chan struct{}),
+	}
+	if n.logger == nil {
+		n.logger = slog.Default()
+	}
+	if n.log == nil {
+		n.log = &DeliveryLog{}
+	}
+	size := cfg.QueueSize
+	if size <= 0 {
+		size = defaultQueueSize
+	}
+	timeout := cfg.Timeout
+	if timeout <= 0 {
+		timeout = defaultTimeout
+	}
+	for _, h := range cfg.Hooks {
+		q := newHookQueue(n, h, size, timeout)
+		n.hooks = append(n.hooks, q)
+		n.wg.Add(1)
+		go q.run()
+	}
+	return n
+}
+
+// Write queues the payload of the event for the subscribed hooks. Failed
+// actions and other events are ignored.
+func (n *Notifier) Write(ctx context.Context, e *audit.Event) error {
+	event, ok := actionEvents[e.Action]
+	if !ok || e.Result != audit.ResultSuccess {
+		return nil
+	}
+
+	n.mu.RLock()
+	defer n.mu.RUnlock()
+	if n.closed {
+		return fmt.Errorf("webhooks are closed, dropped %s event", event)
+	}
+
+	var dropped []string
+	for _, q := range n.hooks {
+		if !q.hook.matches(event, e.Namespace) {
+			continue
+		}
+		p := &Payload{
+			ID:        newID(),
+			Event:     event,
+			Time:      e.Time,
+			Namespace: e.Namespace,
+			Kind:      e.Kind,
+			Name:      e.Name,
+			System:    e.System,
+			Version:   e.Version,
+			OS:        e.OS,
+			Arch:      e.Arch,
+			Principal: e.Principal,
+		}
+		select {
+		case q.queue <- p:
+		default:
+			dropped = append(dropped, q.hook.Name)
+		}
+	}
+	if len(dropped) > 0 {
+		return fmt.Errorf("webhook queues of %v are full, dropped %s event", dropped, event)
+	}
+	return nil
+}
+
+// Close sends the queued payloads and stops the hooks. Deliveries failing
+// while closing aren't retried.
+func (n *Notifier) Close() error {
+	n.mu.Lock()
+	if !n.closed {
+		n.closed = true
+		close(n.stop)
+		for _, q := range n.hooks {
+			close(q.queue)
+		}
+	}
+	n.mu.Unlock()
+	n.wg.Wait()
+	return n.log.Close()
+}
+
+// Deliveries returns the recent delivery attempts, newest first.
+func (n *Notifier) Deliveries() []*Delivery {
+	return n.log.Recent()
+}
+
+func newID() string {
+	b := make([]byte, 16)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
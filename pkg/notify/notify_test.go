@@ -0,0 +1,302 @@
+package notify
+
+import (
+	"bufio"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/yolocs/ar-terraform-registry/pkg/audit"
+)
+
+// receiver is a local webhook endpoint answering with the given statuses in
+// order, then 200.
+type receiver struct {
+	*httptest.Server
+
+	mu       sync.Mutex
+	statuses []int
+	requests []*received
+	got      chan struct{}
+}
+
+type received struct {
+	time   time.Time
+	header http.Header
+	body   []byte
+}
+
+func newReceiver(t *testing.T, statuses ...int) *receiver {
+	t.Helper()
+	rcv := &receiver{statuses: statuses, got: make(chan struct{}, 100)}
+	rcv.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		rcv.mu.Lock()
+		rcv.requests = append(rcv.requests, &received{time: time.Now(), header: r.Header.Clone(), body: body})
+		status := http.StatusOK
+		if len(rcv.statuses) > 0 {
+			status, rcv.statuses = rcv.statuses[0], rcv.statuses[1:]
+		}
+		rcv.mu.Unlock()
+		w.WriteHeader(status)
+		rcv.got <- struct{}{}
+	}))
+	t.Cleanup(rcv.Close)
+	return rcv
+}
+
+// wait returns the requests once n arrived.
+func (rcv *receiver) wait(t *testing.T, n int) []*received {
+	t.Helper()
+	for range n {
+		select {
+		case <-rcv.got:
+		case <-time.After(5 * time.Second):
+			t.Fatalf("timed out waiting for %d webhook requests", n)
+		}
+	}
+	rcv.mu.Lock()
+	defer rcv.mu.Unlock()
+	return append([]*received(nil), rcv.requests...)
+}
+
+func (rcv *receiver) count() int {
+	rcv.mu.Lock()
+	defer rcv.mu.Unlock()
+	return len(rcv.requests)
+}
+
+func newTestNotifier(t *testing.T, hooks ...*Hook) *Notifier {
+	t.Helper()
+	n := New(&Config{
+		Hooks:          hooks,
+		MaxAttempts:    4,
+		InitialBackoff: 20 * time.Millisecond,
+		MaxBackoff:     40 * time.Millisecond,
+		Timeout:        time.Second,
+	})
+	t.Cleanup(func() { n.Close() })
+	return n
+}
+
+func publishEvent() *audit.Event {
+	return &audit.Event{
+		Time:      time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC),
+		Action:    audit.ActionModulePublish,
+		Result:    audit.ResultSuccess,
+		Namespace: "acme",
+		Kind:      "module",
+		Name:      "network",
+		System:    "aws",
+		Version:   "1.0.0",
+		Principal: "ci",
+	}
+}
+
+func TestNotifierSignature(t *testing.T) {
+	t.Parallel()
+
+	rcv := newReceiver(t)
+	n := newTestNotifier(t, &Hook{Name: "signed", URL: rcv.URL, Secret: "s3cret", Headers: map[string]string{"X-Extra": "1"}})
+	if err := n.Write(context.Background(), publishEvent()); err != nil {
+		t.Fatal(err)
+	}
+	req := rcv.wait(t, 1)[0]
+
+	mac := hmac.New(sha256.New, []byte("s3cret"))
+	mac.Write(req.body)
+	if got, want := req.header.Get(SignatureHeader), "sha256="+hex.EncodeToString(mac.Sum(nil)); got != want {
+		t.Errorf("%s: got %q, want %q", SignatureHeader, got, want)
+	}
+	if got := req.header.Get(EventHeader); got != EventModulePublished {
+		t.Errorf("%s: got %q, want %q", EventHeader, got, EventModulePublished)
+	}
+	if got := req.header.Get("X-Extra"); got != "1" {
+		t.Errorf("X-Extra: got %q, want hook header", got)
+	}
+
+	var p Payload
+	if err := json.Unmarshal(req.body, &p); err != nil {
+		t.Fatal(err)
+	}
+	if p.ID == "" || req.header.Get(DeliveryHeader) != p.ID {
+		t.Errorf("%s: got %q, want payload ID %q", DeliveryHeader, req.header.Get(DeliveryHeader), p.ID)
+	}
+	if p.Event != EventModulePublished || p.Namespace != "acme" || p.Name != "network" || p.System != "aws" || p.Version != "1.0.0" || p.Principal != "ci" {
+		t.Errorf("payload: got %+v", p)
+	}
+}
+
+func TestNotifierRetries(t *testing.T) {
+	t.Parallel()
+
+	rcv := newReceiver(t, http.StatusServiceUnavailable, http.StatusTooManyRequests, http.StatusInternalServerError)
+	n := newTestNotifier(t, &Hook{Name: "flaky", URL: rcv.URL})
+	if err := n.Write(context.Background(), publishEvent()); err != nil {
+		t.Fatal(err)
+	}
+	reqs := rcv.wait(t, 4)
+
+	// The backoff doubles from 20ms, capped at 40ms.
+	for i, want := range []time.Duration{20 * time.Millisecond, 40 * time.Millisecond, 40 * time.Millisecond} {
+		if gap := reqs[i+1].time.Sub(reqs[i].time); gap < want {
+			t.Errorf("retry %d: sent after %v, want at least %v", i+1, gap, want)
+		}
+	}
+	if id := reqs[0].header.Get(DeliveryHeader); reqs[3].header.Get(DeliveryHeader) != id {
+		t.Errorf("retries changed the delivery ID")
+	}
+
+	// The successful attempt is recorded after the response is sent.
+	var ds []*Delivery
+	for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(10 * time.Millisecond) {
+		if ds = n.Deliveries(); len(ds) == 4 {
+			break
+		}
+	}
+	if len(ds) != 4 {
+		t.Fatalf("Deliveries: got %d, want 4", len(ds))
+	}
+	for i, want := range []struct {
+		attempt, status int
+		failed          bool
+	}{
+		{4, http.StatusOK, false},
+		{3, http.StatusInternalServerError, true},
+		{2, http.StatusTooManyRequests, true},
+		{1, http.StatusServiceUnavailable, true},
+	} {
+		d := ds[i]
+		if d.Attempt != want.attempt || d.Status != want.status || (d.Error != "") != want.failed || d.Hook != "flaky" || d.Event != EventModulePublished {
+			t.Errorf("Deliveries()[%d]: got %+v, want attempt %d with status %d", i, d, want.attempt, want.status)
+		}
+	}
+}
+
+func TestNotifierNoRetryOnClientError(t *testing.T) {
+	t.Parallel()
+
+	rcv := newReceiver(t, http.StatusBadRequest)
+	n := newTestNotifier(t, &Hook{Name: "rejecting", URL: rcv.URL})
+	if err := n.Write(context.Background(), publishEvent()); err != nil {
+		t.Fatal(err)
+	}
+	rcv.wait(t, 1)
+
+	// Several backoffs pass without a retry.
+	time.Sleep(200 * time.Millisecond)
+	if got := rcv.count(); got != 1 {
+		t.Errorf("got %d requests, want 1", got)
+	}
+	ds := n.Deliveries()
+	if len(ds) != 1 || ds[0].Status != http.StatusBadRequest || ds[0].Error == "" {
+		t.Errorf("Deliveries: got %+v, want one failed attempt with status 400", ds)
+	}
+}
+
+func TestNotifierMaxAttempts(t *testing.T) {
+	t.Parallel()
+
+	rcv := newReceiver(t, 500, 500, 500, 500, 500, 500)
+	n := newTestNotifier(t, &Hook{Name: "down", URL: rcv.URL})
+	if err := n.Write(context.Background(), publishEvent()); err != nil {
+		t.Fatal(err)
+	}
+	rcv.wait(t, 4)
+
+	time.Sleep(200 * time.Millisecond)
+	if got := rcv.count(); got != 4 {
+		t.Errorf("got %d requests, want MaxAttempts 4", got)
+	}
+}
+
+func TestNotifierFilters(t *testing.T) {
+	t.Parallel()
+
+	rcv := newReceiver(t)
+	n := newTestNotifier(t, &Hook{Name: "filtered", URL: rcv.URL, Namespaces: []string{"team-*"}, Events: []string{EventVersionYanked}})
+
+	ctx := context.Background()
+	skipped := []*audit.Event{
+		publishEvent(),
+		{Action: audit.ActionVersionYank, Result: audit.ResultSuccess, Namespace: "acme"},
+		{Action: audit.ActionVersionYank, Result: audit.ResultFailure, Namespace: "team-a"},
+		{Action: audit.ActionModuleDownload, Result: audit.ResultSuccess, Namespace: "team-a"},
+	}
+	for _, e := range skipped {
+		if err := n.Write(ctx, e); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := n.Write(ctx, &audit.Event{Action: audit.ActionVersionYank, Result: audit.ResultSuccess, Namespace: "team-a", Version: "1.0.0"}); err != nil {
+		t.Fatal(err)
+	}
+
+	// Close sends the queued payloads in order, so only the matching one
+	// arrives.
+	if err := n.Close(); err != nil {
+		t.Fatal(err)
+	}
+	reqs := rcv.wait(t, 1)
+	if len(reqs) != 1 {
+		t.Fatalf("got %d requests, want 1", len(reqs))
+	}
+	var p Payload
+	if err := json.Unmarshal(reqs[0].body, &p); err != nil {
+		t.Fatal(err)
+	}
+	if p.Event != EventVersionYanked || p.Namespace != "team-a" {
+		t.Errorf("payload: got %+v, want the team-a yank", p)
+	}
+}
+
+func TestDeliveryLog(t *testing.T) {
+	t.Parallel()
+
+	path := filepath.Join(t.TempDir(), "deliveries.jsonl")
+	l, err := NewDeliveryLog(path, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 1; i <= 3; i++ {
+		if err := l.Record(&Delivery{ID: "d", Attempt: i}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	recent := l.Recent()
+	if len(recent) != 2 || recent[0].Attempt != 3 || recent[1].Attempt != 2 {
+		t.Errorf("Recent: got %+v, want attempts 3 and 2", recent)
+	}
+	if err := l.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	var attempts []int
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		var d Delivery
+		if err := json.Unmarshal(sc.Bytes(), &d); err != nil {
+			t.Fatal(err)
+		}
+		attempts = append(attempts, d.Attempt)
+	}
+	if len(attempts) != 3 || attempts[0] != 1 || attempts[2] != 3 {
+		t.Errorf("file: got attempts %v, want all three in order", attempts)
+	}
+}
@@ -0,0 +1,279 @@
+package publish
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// maxExtractedSize bounds the total size of an unpacked module archive.
+const maxExtractedSize = 1 << 30
+
+// extractor unpacks archive entries below root. Entries that would escape the
+// root, directly or through symlinks, are reported as problems and skipped.
+type extractor struct {
+	root  string
+	p     *problems
+	size  int64
+	limit int64
+}
+
+// extractArchive unpacks a tar.gz, tgz or zip module archive into root. It
+// stops once the entries exceed limit bytes.
+func extractArchive(p *problems, archive, format, root string, limit int64) error {
+	root, err := filepath.EvalSymlinks(root)
+	if err != nil {
+		return fmt.Errorf("failed to resolve %s: %w", root, err)
+	}
+	e := &extractor{root: root, p: p, limit: limit}
+
+	switch format {
+	case "tar.gz", "tgz":
+		return e.tar(archive)
+	case "zip":
+		return e.zip(archive)
+	default:
+		p.add("unsupported archive format %q", format)
+		return nil
+	}
+}
+
+func (e *extractor) tar(archive string) error {
+	f, err := os.Open(archive)
+	if err != nil {
+		return fmt.Errorf("failed to open %s: %w", archive, err)
+	}
+	defer f.Close()
+
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		e.p.add("archive is not gzipped: %v", err)
+		return nil
+	}
+	defer gz.Close()
+
+	tr := tar.NewReader(gz)
+	for {
+		hdr, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			e.p.add("archive is corrupt: %v", err)
+			return nil
+		}
+
+		switch hdr.Typeflag {
+		case tar.TypeXGlobalHeader:
+		case tar.TypeDir:
+			e.dir(hdr.Name)
+		case tar.TypeReg:
+			if err := e.file(hdr.Name, fs.FileMode(hdr.Mode).Perm(), tr); err != nil {
+				return err
+			}
+		case tar.TypeSymlink:
+			e.symlink(hdr.Name, hdr.Linkname)
+		case tar.TypeLink:
+			e.hardlink(hdr.Name, hdr.Linkname)
+		default:
+			e.p.add("entry %q has unsupported type %q", hdr.Name, hdr.Typeflag)
+		}
+		if e.size > e.limit {
+			e.p.add("archive expands to more than %d bytes", e.limit)
+			return nil
+		}
+	}
+}
+
+func (e *extractor) zip(archive string) error {
+	zr, err := zip.OpenReader(archive)
+	if err != nil {
+		e.p.add("archive is not a valid zip: %v", err)
+		return nil
+	}
+	defer zr.Close()
+
+	for _, f := range zr.File {
+		mode := f.Mode()
+		switch {
+		case mode.IsDir():
+			e.dir(f.Name)
+		case mode&fs.ModeSymlink != 0:
+			target, err := readZipEntry(f)
+			if err != nil {
+				e.p.add("entry %q is corrupt: %v", f.Name, err)
+				continue
+			}
+			e.symlink(f.Name, target)
+		case mode.IsRegular():
+			rc, err := f.Open()
+			if err != nil {
+				e.p.add("entry %q is corrupt: %v", f.Name, err)
+				continue
+			}
+			err = e.file(f.Name, mode.Perm(), rc)
+			rc.Close()
+			if err != nil {
+				return err
+			}
+		default:
+			e.p.add("entry %q has unsupported mode %s", f.Name, mode)
+		}
+		if e.size > e.limit {
+			e.p.add("archive expands to more than %d bytes", e.limit)
+			return nil
+		}
+	}
+	return nil
+}
+
+func (e *extractor) dir(name string) {
+	if p, ok := e.target(name); ok {
+		if err := os.MkdirAll(p, 0o755); err != nil {
+			e.p.add("failed to create directory %q: %v", name, err)
+		}
+	}
+}
+
+func (e *extractor) file(name string, perm fs.FileMode, r io.Reader) error {
+	p, ok := e.target(name)
+	if !ok {
+		return nil
+	}
+	w, err := os.OpenFile(p, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o644|perm&0o111)
+	if err != nil {
+		e.p.add("failed to create %q: %v", name, err)
+		return nil
+	}
+	defer w.Close()
+
+	n, err := io.Copy(w, io.LimitReader(r, e.limit-e.size+1))
+	e.size += n
+	if err != nil {
+		e.p.add("entry %q is corrupt: %v", name, err)
+		return nil
+	}
+	if err := w.Close(); err != nil {
+		return fmt.Errorf("failed to write %s: %w", p, err)
+	}
+	return nil
+}
+
+// symlink creates links whose targets resolve inside the root. Targets must
+// be clean, so ".." can only lead the target and is applied to the link's
+// real directory before any other link is followed.
+func (e *extractor) symlink(name, linkname string) {
+	p, ok := e.target(name)
+	if !ok {
+		return
+	}
+	if path.IsAbs(linkname) || strings.Contains(linkname, `\`) || path.Clean(linkname) != linkname {
+		e.p.add("symlink %q has an invalid target %q", name, linkname)
+		return
+	}
+	if !e.within(filepath.Join(filepath.Dir(p), filepath.FromSlash(linkname))) {
+		e.p.add("symlink %q points outside the archive (%s)", name, linkname)
+		return
+	}
+	if err := os.Symlink(filepath.FromSlash(linkname), p); err != nil {
+		e.p.add("failed to create symlink %q: %v", name, err)
+	}
+}
+
+// hardlink copies the already extracted target, which must be a regular file
+// inside the root.
+func (e *extractor) hardlink(name, linkname string) {
+	src, ok := e.target(linkname)
+	if !ok {
+		return
+	}
+	fi, err := os.Lstat(src)
+	if err != nil || !fi.Mode().IsRegular() {
+		e.p.add("hard link %q points to %q, which is not a file in the archive", name, linkname)
+		return
+	}
+	r, err := os.Open(src)
+	if err != nil {
+		e.p.add("failed to read %q: %v", linkname, err)
+		return
+	}
+	defer r.Close()
+	if err := e.file(name, fi.Mode().Perm(), r); err != nil {
+		e.p.add("failed to link %q: %v", name, err)
+	}
+}
+
+// target returns the local path of an entry. It rejects names that aren't
+// clean relative paths and entries whose parent directory resolves outside
+// the root through previously extracted symlinks.
+func (e *extractor) target(name string) (string, bool) {
+	name = strings.TrimSuffix(name, "/")
+	clean := path.Clean(name)
+	switch {
+	case name == "" || clean == ".":
+		return e.root, true
+	case path.IsAbs(name), strings.Contains(name, `\`), clean == "..", strings.HasPrefix(clean, "../"):
+		e.p.add("entry %q has a path outside the archive", name)
+		return "", false
+	}
+
+	p := filepath.Join(e.root, filepath.FromSlash(clean))
+	dir := filepath.Dir(p)
+	if !e.within(dir) {
+		e.p.add("entry %q is written through a symlink outside the archive", name)
+		return "", false
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		e.p.add("failed to create directory for %q: %v", name, err)
+		return "", false
+	}
+	real, err := filepath.EvalSymlinks(dir)
+	if err != nil || !e.within(real) {
+		e.p.add("entry %q is written through a symlink outside the archive", name)
+		return "", false
+	}
+	return filepath.Join(real, filepath.Base(p)), true
+}
+
+// within reports whether p resolves inside the root. Symlinks in p are
+// resolved as far as they exist.
+func (e *extractor) within(p string) bool {
+	p = filepath.Clean(p)
+	var rest []string
+	for {
+		real, err := filepath.EvalSymlinks(p)
+		if err == nil {
+			p = filepath.Join(append([]string{real}, rest...)...)
+			break
+		}
+		if !errors.Is(err, fs.ErrNotExist) {
+			return false
+		}
+		parent := filepath.Dir(p)
+		if parent == p {
+			break
+		}
+		rest = append([]string{filepath.Base(p)}, rest...)
+		p = parent
+	}
+	rel, err := filepath.Rel(e.root, filepath.Clean(p))
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+func readZipEntry(f *zip.File) (string, error) {
+	rc, err := f.Open()
+	if err != nil {
+		return "", err
+	}
+	defer rc.Close()
+	b, err := io.ReadAll(io.LimitReader(rc, 4096))
+	return string(b), err
+}
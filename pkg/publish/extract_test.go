@@ -0,0 +1,219 @@
+package publish
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// entry is an archive entry: a directory if the name ends with a slash, a
+// symlink if link is set, and a regular file otherwise.
+type entry struct {
+	name, body, link string
+}
+
+// writeArchive packs the entries in the format and returns the archive path.
+func writeArchive(t *testing.T, format string, entries []entry) string {
+	t.Helper()
+
+	var buf bytes.Buffer
+	switch format {
+	case "tar.gz":
+		gz := gzip.NewWriter(&buf)
+		tw := tar.NewWriter(gz)
+		for _, e := range entries {
+			hdr := &tar.Header{Name: e.name, Mode: 0o644, Size: int64(len(e.body)), Typeflag: tar.TypeReg}
+			switch {
+			case e.link != "":
+				hdr.Typeflag, hdr.Linkname, hdr.Size = tar.TypeSymlink, e.link, 0
+			case strings.HasSuffix(e.name, "/"):
+				hdr.Typeflag, hdr.Mode = tar.TypeDir, 0o755
+			}
+			if err := tw.WriteHeader(hdr); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := tw.Write([]byte(e.body)); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := tw.Close(); err != nil {
+			t.Fatal(err)
+		}
+		if err := gz.Close(); err != nil {
+			t.Fatal(err)
+		}
+	case "zip":
+		zw := zip.NewWriter(&buf)
+		for _, e := range entries {
+			hdr := &zip.FileHeader{Name: e.name, Method: zip.Deflate}
+			body := e.body
+			switch {
+			case e.link != "":
+				hdr.SetMode(fs.ModeSymlink | 0o777)
+				body = e.link
+			case strings.HasSuffix(e.name, "/"):
+				hdr.SetMode(fs.ModeDir | 0o755)
+			default:
+				hdr.SetMode(0o644)
+			}
+			w, err := zw.CreateHeader(hdr)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, err := w.Write([]byte(body)); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := zw.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	p := filepath.Join(t.TempDir(), "module."+format)
+	if err := os.WriteFile(p, buf.Bytes(), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return p
+}
+
+func TestExtractArchive(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		name    string
+		entries []entry
+		limit   int64
+		want    string
+	}{
+		{
+			name: "valid",
+			entries: []entry{
+				{name: "modules/"},
+				{name: "modules/sub/main.tf", body: "# sub"},
+				{name: "main.tf", body: "# root"},
+				{name: "shared", link: "modules/sub"},
+			},
+		},
+		{
+			name:    "traversal",
+			entries: []entry{{name: "main.tf"}, {name: "../escape.tf", body: "x"}},
+			want:    `entry "../escape.tf" has a path outside the archive`,
+		},
+		{
+			name:    "nested traversal",
+			entries: []entry{{name: "modules/../../escape.tf", body: "x"}},
+			want:    "has a path outside the archive",
+		},
+		{
+			name:    "absolute path",
+			entries: []entry{{name: "/etc/escape.tf", body: "x"}},
+			want:    `entry "/etc/escape.tf" has a path outside the archive`,
+		},
+		{
+			name:    "symlink outside",
+			entries: []entry{{name: "modules/"}, {name: "modules/link", link: "../../outside"}},
+			want:    `symlink "modules/link" points outside the archive`,
+		},
+		{
+			name:    "absolute symlink",
+			entries: []entry{{name: "link", link: "/etc/passwd"}},
+			want:    `symlink "link" has an invalid target "/etc/passwd"`,
+		},
+		{
+			name:    "size limit",
+			entries: []entry{{name: "a.tf", body: strings.Repeat("a", 600)}, {name: "b.tf", body: strings.Repeat("b", 600)}},
+			limit:   1000,
+			want:    "archive expands to more than 1000 bytes",
+		},
+	}
+	for _, format := range []string{"tar.gz", "zip"} {
+		for _, tc := range cases {
+			limit := tc.limit
+			if limit == 0 {
+				limit = maxExtractedSize
+			}
+			root := t.TempDir()
+			var p problems
+			if err := extractArchive(&p, writeArchive(t, format, tc.entries), format, root, limit); err != nil {
+				t.Errorf("%s %s: %v", format, tc.name, err)
+				continue
+			}
+
+			got := strings.Join(p, "\n")
+			switch {
+			case tc.want == "" && len(p) > 0:
+				t.Errorf("%s %s: got problems %q", format, tc.name, got)
+			case tc.want != "" && !strings.Contains(got, tc.want):
+				t.Errorf("%s %s: got problems %q, want %q", format, tc.name, got, tc.want)
+			}
+
+			// Nothing lands outside the root, even when an entry is rejected.
+			if _, err := os.Lstat(filepath.Join(filepath.Dir(root), "escape.tf")); err == nil {
+				t.Errorf("%s %s: entry written outside the root", format, tc.name)
+			}
+		}
+	}
+}
+
+func TestAnalyzeModule(t *testing.T) {
+	t.Parallel()
+
+	archive := writeArchive(t, "tar.gz", []entry{
+		{name: "README.md", body: "# VPC"},
+		{name: "variables.tf", body: `
+variable "cidr" {
+  type        = string
+  description = "The VPC CIDR."
+}
+
+variable "name" {
+  default = "main"
+}
+`},
+		{name: "outputs.tf", body: `
+output "id" {
+  value       = "vpc-123"
+  description = "The VPC ID."
+}
+`},
+		{name: "modules/subnet/main.tf", body: `variable "zone" {}`},
+	})
+
+	md, err := AnalyzeModule(&ModuleRelease{Namespace: "acme", Name: "vpc", System: "aws", Version: "1.0.0", Format: "tar.gz", Archive: archive})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got := md.Root.Readme; got != "# VPC" {
+		t.Errorf("readme: got %q", got)
+	}
+	if in := md.Root.Inputs; len(in) != 2 ||
+		in[0].Name != "cidr" || !in[0].Required || in[0].Type != "string" || in[0].Description != "The VPC CIDR." ||
+		in[1].Name != "name" || in[1].Required || in[1].Default != "main" {
+		t.Errorf("inputs: got %+v", in)
+	}
+	if out := md.Root.Outputs; len(out) != 1 || out[0].Name != "id" || out[0].Description != "The VPC ID." {
+		t.Errorf("outputs: got %+v", out)
+	}
+	if sub := md.Submodules; len(sub) != 1 || sub[0].Path != "modules/subnet" || len(sub[0].Inputs) != 1 || sub[0].Inputs[0].Name != "zone" {
+		t.Errorf("submodules: got %+v", sub)
+	}
+}
+
+func TestAnalyzeModuleRejectsUnsafeArchive(t *testing.T) {
+	t.Parallel()
+
+	archive := writeArchive(t, "zip", []entry{{name: "main.tf"}, {name: "../escape.tf", body: "x"}})
+	_, err := AnalyzeModule(&ModuleRelease{Namespace: "acme", Name: "vpc", System: "aws", Version: "1.0.0", Format: "zip", Archive: archive})
+	var verr *ValidationError
+	if !errors.As(err, &verr) {
+		t.Fatalf("got error %v, want a ValidationError", err)
+	}
+}
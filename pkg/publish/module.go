@@ -0,0 +1,243 @@
+package publish
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/hashicorp/terraform-config-inspect/tfconfig"
+
+	"github.com/yolocs/ar-terraform-registry/pkg/audit"
+	"github.com/yolocs/ar-terraform-registry/pkg/model"
+)
+
+// maxReadmeSize bounds the README kept in module metadata.
+const maxReadmeSize = 1 << 20
+
+// ModuleRelease is a module version with its archive on local disk.
+type ModuleRelease struct {
+	Namespace string
+	Name      string
+	System    string
+	Version   string
+	// Format is "tar.gz", "tgz" or "zip".
+	Format string
+	// Subdir is the optional path of the module inside the archive.
+	Subdir string
+	// Archive is the local path of the archive.
+	Archive string
+}
+
+func (r *ModuleRelease) String() string {
+	return fmt.Sprintf("%s/%s/%s %s", r.Namespace, r.Name, r.System, r.Version)
+}
+
+// AnalyzeModule unpacks the archive and extracts the metadata of the module,
+// its submodules under modules/ and its examples under examples/. It rejects
+// archives with entries or symlinks outside the archive root and
+// configurations that don't parse.
+func AnalyzeModule(rel *ModuleRelease) (*model.ModuleMetadata, error) {
+	dir, err := os.MkdirTemp("", "module-analysis-*")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create temporary directory: %w", err)
+	}
+	defer os.RemoveAll(dir)
+
+	var p problems
+	if err := extractArchive(&p, rel.Archive, rel.Format, dir, maxExtractedSize); err != nil {
+		return nil, err
+	}
+	if len(p) > 0 {
+		return nil, p.err(rel.String())
+	}
+
+	subdir := path.Clean("/" + rel.Subdir)[1:]
+	if subdir != rel.Subdir && subdir+"/" != rel.Subdir {
+		p.add("subdir %q is not a clean relative path", rel.Subdir)
+		return nil, p.err(rel.String())
+	}
+	root := filepath.Join(dir, filepath.FromSlash(subdir))
+
+	md := &model.ModuleMetadata{
+		Submodules: []*model.ModuleConfig{},
+		Examples:   []*model.ModuleConfig{},
+	}
+	if !tfconfig.IsModuleDir(root) {
+		p.add("no Terraform configuration in %q", "/"+subdir)
+		return nil, p.err(rel.String())
+	}
+	md.Root = loadModule(&p, root, "")
+	for _, group := range []struct {
+		dir  string
+		into *[]*model.ModuleConfig
+	}{
+		{dir: "modules", into: &md.Submodules},
+		{dir: "examples", into: &md.Examples},
+	} {
+		entries, err := os.ReadDir(filepath.Join(root, group.dir))
+		if err != nil {
+			continue
+		}
+		for _, e := range entries {
+			d := filepath.Join(root, group.dir, e.Name())
+			if fi, err := os.Stat(d); err != nil || !fi.IsDir() || !tfconfig.IsModuleDir(d) {
+				continue
+			}
+			*group.into = append(*group.into, loadModule(&p, d, group.dir+"/"+e.Name()))
+		}
+	}
+	if err := p.err(rel.String()); err != nil {
+		return nil, err
+	}
+	return md, nil
+}
+
+// WriteModule writes the archive of a release and, if the store keeps it,
+// its metadata.
+func WriteModule(ctx context.Context, w model.ModuleWriter, rel *ModuleRelease, md *model.ModuleMetadata) error {
+	return emit(ctx, rel.event(), writeModule(ctx, w, rel, md))
+}
+
+func writeModule(ctx context.Context, w model.ModuleWriter, rel *ModuleRelease, md *model.ModuleMetadata) error {
+	err := writeFile(rel.Archive, func(r io.Reader) error {
+		return w.PutModuleArchive(ctx, rel.Namespace, rel.Name, rel.System, rel.Version, rel.Format, rel.Subdir, r)
+	})
+	if err != nil {
+		return err
+	}
+
+	mw, ok := w.(model.ModuleMetadataWriter)
+	if !ok {
+		return nil
+	}
+	err = mw.PutModuleMetadata(ctx, rel.Namespace, rel.Name, rel.System, rel.Version, md)
+	if err != nil && !errors.Is(err, errors.ErrUnsupported) && !errors.Is(err, model.ErrAlreadyExists) {
+		return fmt.Errorf("failed to write metadata: %w", err)
+	}
+	return nil
+}
+
+// Module analyzes the release and writes it with its metadata.
+func Module(ctx context.Context, w model.ModuleWriter, rel *ModuleRelease) error {
+	md, err := AnalyzeModule(rel)
+	if err != nil {
+		return emit(ctx, rel.event(), err)
+	}
+	return WriteModule(ctx, w, rel, md)
+}
+
+func (r *ModuleRelease) event() *audit.Event {
+	return &audit.Event{
+		Action:    audit.ActionModulePublish,
+		Namespace: r.Namespace,
+		Kind:      model.KindModule,
+		Name:      r.Name,
+		System:    r.System,
+		Version:   r.Version,
+	}
+}
+
+// readme returns the README of a module directory, truncated to
+// maxReadmeSize.
+func readme(dir string) string {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return ""
+	}
+	for _, e := range entries {
+		if !strings.EqualFold(e.Name(), "README.md") && !strings.EqualFold(e.Name(), "README") {
+			continue
+		}
+		f, err := os.Open(filepath.Join(dir, e.Name()))
+		if err != nil {
+			return ""
+		}
+		defer f.Close()
+		b, _ := io.ReadAll(io.LimitReader(f, maxReadmeSize))
+		return string(b)
+	}
+	return ""
+}
+
+// loadModule parses the .tf files of a directory. Parse errors are added to p.
+func loadModule(p *problems, dir, relPath string) *model.ModuleConfig {
+	mod, diags := tfconfig.LoadModule(dir)
+	for _, d := range diags {
+		if d.Severity != tfconfig.DiagError {
+			continue
+		}
+		msg := d.Summary
+		if d.Detail != "" {
+			msg += ": " + d.Detail
+		}
+		if d.Pos != nil {
+			rel, _ := filepath.Rel(dir, d.Pos.Filename)
+			msg = fmt.Sprintf("%s:%d: %s", path.Join(relPath, filepath.ToSlash(rel)), d.Pos.Line, msg)
+		}
+		p.add("%s", msg)
+	}
+
+	cfg := &model.ModuleConfig{
+		Path:                 relPath,
+		Readme:               readme(dir),
+		RequiredVersion:      mod.RequiredCore,
+		Inputs:               []*model.ModuleInput{},
+		Outputs:              []*model.ModuleOutput{},
+		Resources:            []*model.ModuleResource{},
+		Dependencies:         []*model.ModuleDependency{},
+		ProviderDependencies: []*model.ModuleProviderDependency{},
+	}
+	for _, v := range mod.Variables {
+		cfg.Inputs = append(cfg.Inputs, &model.ModuleInput{
+			Name:        v.Name,
+			Type:        v.Type,
+			Description: v.Description,
+			Default:     v.Default,
+			Required:    v.Required,
+			Sensitive:   v.Sensitive,
+		})
+	}
+	for _, o := range mod.Outputs {
+		cfg.Outputs = append(cfg.Outputs, &model.ModuleOutput{
+			Name:        o.Name,
+			Description: o.Description,
+			Sensitive:   o.Sensitive,
+		})
+	}
+	for _, rs := range []map[string]*tfconfig.Resource{mod.ManagedResources, mod.DataResources} {
+		for _, r := range rs {
+			cfg.Resources = append(cfg.Resources, &model.ModuleResource{Name: r.Name, Type: r.Type, Mode: r.Mode.String()})
+		}
+	}
+	for _, c := range mod.ModuleCalls {
+		cfg.Dependencies = append(cfg.Dependencies, &model.ModuleDependency{Name: c.Name, Source: c.Source, Version: c.Version})
+	}
+	for name, req := range mod.RequiredProviders {
+		source := req.Source
+		if source == "" {
+			source = "hashicorp/" + name
+		}
+		parts := strings.Split(source, "/")
+		cfg.ProviderDependencies = append(cfg.ProviderDependencies, &model.ModuleProviderDependency{
+			Name:      name,
+			Namespace: parts[max(0, len(parts)-2)],
+			Source:    source,
+			Version:   strings.Join(req.VersionConstraints, ", "),
+		})
+	}
+
+	slices.SortFunc(cfg.Inputs, func(a, b *model.ModuleInput) int { return strings.Compare(a.Name, b.Name) })
+	slices.SortFunc(cfg.Outputs, func(a, b *model.ModuleOutput) int { return strings.Compare(a.Name, b.Name) })
+	slices.SortFunc(cfg.Resources, func(a, b *model.ModuleResource) int {
+		return strings.Compare(a.Mode+"."+a.Type+"."+a.Name, b.Mode+"."+b.Type+"."+b.Name)
+	})
+	slices.SortFunc(cfg.Dependencies, func(a, b *model.ModuleDependency) int { return strings.Compare(a.Name, b.Name) })
+	slices.SortFunc(cfg.ProviderDependencies, func(a, b *model.ModuleProviderDependency) int { return strings.Compare(a.Name, b.Name) })
+	return cfg
+}
@@ -0,0 +1,452 @@
+package publish
+
+import (
+	"archive/zip"
+	"bufio"
+	"context"
+	"crypto/sha256"
+	"debug/elf"
+	"debug/macho"
+	"debug/pe"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"slices"
+	"strings"
+
+	"github.com/yolocs/ar-terraform-registry/pkg/audit"
+	"github.com/yolocs/ar-terraform-registry/pkg/model"
+)
+
+// ProviderRelease is one platform of a provider version with its files on
+// local disk.
+type ProviderRelease struct {
+	Namespace string
+	Name      string
+	Version   string
+	OS        string
+	Arch      string
+	// Files maps file names, without the store's package and version prefix,
+	// to local paths.
+	Files map[string]string
+}
+
+func (r *ProviderRelease) String() string {
+	return fmt.Sprintf("%s/%s %s %s_%s", r.Namespace, r.Name, r.Version, r.OS, r.Arch)
+}
+
+func (r *ProviderRelease) prefix() string {
+	return fmt.Sprintf("terraform-provider-%s_%s", r.Name, r.Version)
+}
+
+// binaryName is the name of the platform zip.
+func (r *ProviderRelease) binaryName() string {
+	return fmt.Sprintf("%s_%s_%s.zip", r.prefix(), r.OS, r.Arch)
+}
+
+// executableName is the name of the provider executable inside the zip.
+func (r *ProviderRelease) executableName() string {
+	n := fmt.Sprintf("terraform-provider-%s_v%s", r.Name, r.Version)
+	if r.OS == "windows" {
+		n += ".exe"
+	}
+	return n
+}
+
+// ValidateProvider checks the release has a zip, SHA256SUMS listing it and a
+// signature; that the zip holds exactly one provider executable named
+// terraform-provider-<name>_v<version>; and that the executable is built for
+// the declared os and arch.
+func ValidateProvider(rel *ProviderRelease) error {
+	var p problems
+	binary, sums := rel.binaryName(), rel.prefix()+"_SHA256SUMS"
+	for _, name := range []string{binary, sums, sums + ".sig"} {
+		if _, ok := rel.Files[name]; !ok {
+			p.add("%s is missing", name)
+		}
+	}
+	for name := range rel.Files {
+		if !strings.HasPrefix(name, rel.prefix()+"_") {
+			p.add("%s doesn't belong to the release", name)
+		}
+	}
+	if len(p) > 0 {
+		return p.err(rel.String())
+	}
+
+	sum, err := fileSHA256(rel.Files[binary])
+	if err != nil {
+		return err
+	}
+	listed, err := listedSum(rel.Files[sums], binary)
+	if err != nil {
+		return err
+	}
+	switch listed {
+	case "":
+		p.add("%s is not listed in %s", binary, sums)
+	case sum:
+	default:
+		p.add("%s is listed in %s with checksum %s, but its checksum is %s", binary, sums, listed, sum)
+	}
+
+	if err := checkZip(&p, rel, rel.Files[binary]); err != nil {
+		return err
+	}
+	return p.err(rel.String())
+}
+
+// WriteProvider writes the files of a validated release, binary first.
+// Files that already exist are skipped; model.ErrAlreadyExists is only
+// returned if all of them exist.
+func WriteProvider(ctx context.Context, w model.ProviderWriter, rel *ProviderRelease) error {
+	return emit(ctx, rel.event(), writeProvider(ctx, w, rel))
+}
+
+func writeProvider(ctx context.Context, w model.ProviderWriter, rel *ProviderRelease) error {
+	names := make([]string, 0, len(rel.Files))
+	for name := range rel.Files {
+		names = append(names, name)
+	}
+	binary := rel.binaryName()
+	slices.SortFunc(names, func(a, b string) int {
+		switch {
+		case a == binary:
+			return -1
+		case b == binary:
+			return 1
+		}
+		return strings.Compare(a, b)
+	})
+
+	existing := 0
+	for _, name := range names {
+		err := writeFile(rel.Files[name], func(r io.Reader) error {
+			return w.PutProviderFile(ctx, rel.Namespace, rel.Name, rel.Version, rel.OS, rel.Arch, name, r)
+		})
+		if errors.Is(err, model.ErrAlreadyExists) {
+			existing++
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("failed to write %s: %w", name, err)
+		}
+	}
+	if existing == len(names) {
+		return fmt.Errorf("%s: %w", rel, model.ErrAlreadyExists)
+	}
+	return nil
+}
+
+// Provider validates the release and writes it.
+func Provider(ctx context.Context, w model.ProviderWriter, rel *ProviderRelease) error {
+	if err := ValidateProvider(rel); err != nil {
+		return emit(ctx, rel.event(), err)
+	}
+	return WriteProvider(ctx, w, rel)
+}
+
+func (r *ProviderRelease) event() *audit.Event {
+	return &audit.Event{
+		Action:    audit.ActionProviderPublish,
+		Namespace: r.Namespace,
+		Kind:      model.KindProvider,
+		Name:      r.Name,
+		Version:   r.Version,
+		OS:        r.OS,
+		Arch:      r.Arch,
+	}
+}
+
+// checkZip inspects the entries of the provider zip.
+func checkZip(p *problems, rel *ProviderRelease, zipPath string) error {
+	zr, err := zip.OpenReader(zipPath)
+	if err != nil {
+		p.add("%s is not a valid zip: %v", rel.binaryName(), err)
+		return nil
+	}
+	defer zr.Close()
+
+	want := rel.executableName()
+	var found *zip.File
+	for _, f := range zr.File {
+		// Directory entries end with a slash.
+		name := strings.TrimSuffix(f.Name, "/")
+		if name != path.Clean(name) || path.IsAbs(name) || name == ".." || strings.HasPrefix(name, "../") || strings.Contains(name, `\`) {
+			p.add("zip entry %q has an unsafe path", f.Name)
+			continue
+		}
+		if f.FileInfo().IsDir() {
+			continue
+		}
+		if !f.Mode().IsRegular() {
+			p.add("zip entry %q is not a regular file", f.Name)
+			continue
+		}
+
+		if f.Name == want {
+			found = f
+			continue
+		}
+		head, err := readHead(f)
+		if err != nil {
+			return err
+		}
+		if executableFormat(head) != "" {
+			p.add("zip entry %q is an unexpected executable", f.Name)
+		} else if strings.HasPrefix(path.Base(f.Name), "terraform-provider-") {
+			p.add("zip entry %q looks like a misnamed provider executable; want %q", f.Name, want)
+		}
+	}
+	if found == nil {
+		p.add("zip doesn't contain the executable %q", want)
+		return nil
+	}
+	return checkExecutable(p, rel, found)
+}
+
+// checkExecutable verifies the executable's header matches the platform.
+func checkExecutable(p *problems, rel *ProviderRelease, f *zip.File) error {
+	// The debug parsers need random access.
+	tmp, err := os.CreateTemp("", "provider-executable-*")
+	if err != nil {
+		return fmt.Errorf("failed to create temporary file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	rc, err := f.Open()
+	if err != nil {
+		p.add("failed to read %q: %v", f.Name, err)
+		return nil
+	}
+	_, err = io.Copy(tmp, rc)
+	rc.Close()
+	if err != nil {
+		p.add("failed to read %q: %v", f.Name, err)
+		return nil
+	}
+
+	head := make([]byte, 4)
+	if _, err := tmp.ReadAt(head, 0); err != nil {
+		p.add("%q is not an executable", f.Name)
+		return nil
+	}
+	format := executableFormat(head)
+
+	var platforms []string
+	switch format {
+	case "ELF":
+		platforms, err = elfPlatforms(tmp)
+	case "Mach-O":
+		platforms, err = machoPlatforms(tmp)
+	case "PE":
+		platforms, err = pePlatforms(tmp)
+	default:
+		p.add("%q is not an ELF, Mach-O or PE executable", f.Name)
+		return nil
+	}
+	if err != nil {
+		p.add("%q has an invalid %s header: %v", f.Name, format, err)
+		return nil
+	}
+
+	for _, pl := range platforms {
+		goos, arch, _ := strings.Cut(pl, "_")
+		if arch == rel.Arch && (goos == rel.OS || (goos == "" && elfOS(rel.OS))) {
+			return nil
+		}
+	}
+	for i, pl := range platforms {
+		platforms[i] = strings.TrimPrefix(pl, "_")
+	}
+	p.add("%q is a %s executable for %s, but the release is for %s_%s", f.Name, format, strings.Join(platforms, ", "), rel.OS, rel.Arch)
+	return nil
+}
+
+func readHead(f *zip.File) ([]byte, error) {
+	rc, err := f.Open()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read zip entry %q: %w", f.Name, err)
+	}
+	defer rc.Close()
+	head := make([]byte, 4)
+	n, _ := io.ReadFull(rc, head)
+	return head[:n], nil
+}
+
+// executableFormat identifies ELF, Mach-O (including universal) and PE files
+// by their magic numbers.
+func executableFormat(head []byte) string {
+	if len(head) < 4 {
+		return ""
+	}
+	switch {
+	case string(head) == "\x7fELF":
+		return "ELF"
+	case slices.Contains([]string{"\xfe\xed\xfa\xce", "\xce\xfa\xed\xfe", "\xfe\xed\xfa\xcf", "\xcf\xfa\xed\xfe", "\xca\xfe\xba\xbe"}, string(head)):
+		return "Mach-O"
+	case string(head[:2]) == "MZ":
+		return "PE"
+	}
+	return ""
+}
+
+// elfOS reports whether the os uses ELF executables.
+func elfOS(goos string) bool {
+	return slices.Contains([]string{"linux", "freebsd", "openbsd", "netbsd", "dragonfly", "solaris", "illumos", "android"}, goos)
+}
+
+// elfPlatforms returns the platform of an ELF executable. The os is empty
+// unless the header names one; most, including Linux, leave it unset.
+func elfPlatforms(r io.ReaderAt) ([]string, error) {
+	f, err := elf.NewFile(r)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var arch string
+	switch f.Machine {
+	case elf.EM_X86_64:
+		arch = "amd64"
+	case elf.EM_386:
+		arch = "386"
+	case elf.EM_AARCH64:
+		arch = "arm64"
+	case elf.EM_ARM:
+		arch = "arm"
+	case elf.EM_PPC64:
+		arch = "ppc64"
+		if f.ByteOrder.String() == "LittleEndian" {
+			arch = "ppc64le"
+		}
+	case elf.EM_S390:
+		arch = "s390x"
+	case elf.EM_RISCV:
+		arch = "riscv64"
+	case elf.EM_MIPS:
+		arch = "mips"
+		if f.Class == elf.ELFCLASS64 {
+			arch = "mips64"
+		}
+		if f.ByteOrder.String() == "LittleEndian" {
+			arch += "le"
+		}
+	default:
+		arch = strings.ToLower(strings.TrimPrefix(f.Machine.String(), "EM_"))
+	}
+
+	var os string
+	switch f.OSABI {
+	case elf.ELFOSABI_LINUX:
+		os = "linux"
+	case elf.ELFOSABI_FREEBSD:
+		os = "freebsd"
+	case elf.ELFOSABI_OPENBSD:
+		os = "openbsd"
+	case elf.ELFOSABI_NETBSD:
+		os = "netbsd"
+	case elf.ELFOSABI_SOLARIS:
+		os = "solaris"
+	}
+	return []string{os + "_" + arch}, nil
+}
+
+func machoPlatforms(r io.ReaderAt) ([]string, error) {
+	var cpus []macho.Cpu
+	if ff, err := macho.NewFatFile(r); err == nil {
+		defer ff.Close()
+		for _, a := range ff.Arches {
+			cpus = append(cpus, a.Cpu)
+		}
+	} else {
+		f, err := macho.NewFile(r)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		cpus = append(cpus, f.Cpu)
+	}
+
+	var platforms []string
+	for _, cpu := range cpus {
+		arch := strings.ToLower(strings.TrimPrefix(cpu.String(), "Cpu"))
+		switch cpu {
+		case macho.CpuAmd64:
+			arch = "amd64"
+		case macho.CpuArm64:
+			arch = "arm64"
+		case macho.Cpu386:
+			arch = "386"
+		}
+		platforms = append(platforms, "darwin_"+arch)
+	}
+	return platforms, nil
+}
+
+func pePlatforms(r io.ReaderAt) ([]string, error) {
+	f, err := pe.NewFile(r)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var arch string
+	switch f.Machine {
+	case pe.IMAGE_FILE_MACHINE_AMD64:
+		arch = "amd64"
+	case pe.IMAGE_FILE_MACHINE_I386:
+		arch = "386"
+	case pe.IMAGE_FILE_MACHINE_ARM64:
+		arch = "arm64"
+	case pe.IMAGE_FILE_MACHINE_ARMNT:
+		arch = "arm"
+	default:
+		arch = fmt.Sprintf("machine-%#x", f.Machine)
+	}
+	return []string{"windows_" + arch}, nil
+}
+
+func fileSHA256(p string) (string, error) {
+	f, err := os.Open(p)
+	if err != nil {
+		return "", fmt.Errorf("failed to open %s: %w", p, err)
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", fmt.Errorf("failed to read %s: %w", p, err)
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// listedSum returns the checksum of fileName in a SHA256SUMS file.
+func listedSum(sumsPath, fileName string) (string, error) {
+	f, err := os.Open(sumsPath)
+	if err != nil {
+		return "", fmt.Errorf("failed to open %s: %w", sumsPath, err)
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		parts := strings.Fields(scanner.Text())
+		if len(parts) == 2 && strings.TrimPrefix(parts[1], "*") == fileName {
+			return parts[0], nil
+		}
+	}
+	return "", scanner.Err()
+}
+
+func writeFile(p string, put func(io.Reader) error) error {
+	f, err := os.Open(p)
+	if err != nil {
+		return fmt.Errorf("failed to open %s: %w", p, err)
+	}
+	defer f.Close()
+	return put(f)
+}
@@ -0,0 +1,224 @@
+package publish
+
+import (
+	"archive/zip"
+	"bytes"
+	"crypto/sha256"
+	"debug/elf"
+	"debug/macho"
+	"debug/pe"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// elfExecutable is a bare ELF header for the machine.
+func elfExecutable(t *testing.T, machine elf.Machine) []byte {
+	t.Helper()
+	h := elf.Header64{
+		Type:    uint16(elf.ET_EXEC),
+		Machine: uint16(machine),
+		Version: uint32(elf.EV_CURRENT),
+		Ehsize:  64,
+	}
+	copy(h.Ident[:], elf.ELFMAG)
+	h.Ident[elf.EI_CLASS] = byte(elf.ELFCLASS64)
+	h.Ident[elf.EI_DATA] = byte(elf.ELFDATA2LSB)
+	h.Ident[elf.EI_VERSION] = byte(elf.EV_CURRENT)
+	var buf bytes.Buffer
+	if err := binary.Write(&buf, binary.LittleEndian, h); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// machoExecutable is a bare 64-bit Mach-O header for the cpu.
+func machoExecutable(t *testing.T, cpu macho.Cpu) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	h := macho.FileHeader{Magic: macho.Magic64, Cpu: cpu, Type: macho.TypeExec}
+	if err := binary.Write(&buf, binary.LittleEndian, h); err != nil {
+		t.Fatal(err)
+	}
+	buf.Write(make([]byte, 4))
+	return buf.Bytes()
+}
+
+// peExecutable is a bare PE header for the machine.
+func peExecutable(t *testing.T, machine uint16) []byte {
+	t.Helper()
+	b := make([]byte, 0x80)
+	copy(b, "MZ")
+	binary.LittleEndian.PutUint32(b[0x3c:], 0x80)
+	buf := bytes.NewBuffer(b)
+	buf.WriteString("PE\x00\x00")
+	if err := binary.Write(buf, binary.LittleEndian, pe.FileHeader{Machine: machine}); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// providerFiles writes the release files of terraform-provider-demo 1.0.0 for
+// the platform. The zip holds the given entries; sums, if not nil, replaces
+// the generated SHA256SUMS.
+func providerFiles(t *testing.T, goos, arch string, entries map[string][]byte, sums []byte) *ProviderRelease {
+	t.Helper()
+	dir := t.TempDir()
+	rel := &ProviderRelease{Namespace: "acme", Name: "demo", Version: "1.0.0", OS: goos, Arch: arch, Files: make(map[string]string)}
+
+	var zbuf bytes.Buffer
+	zw := zip.NewWriter(&zbuf)
+	for name, b := range entries {
+		w, err := zw.CreateHeader(&zip.FileHeader{Name: name, Method: zip.Deflate})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := w.Write(b); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if sums == nil {
+		sum := sha256.Sum256(zbuf.Bytes())
+		sums = []byte(fmt.Sprintf("%s  %s\n", hex.EncodeToString(sum[:]), rel.binaryName()))
+	}
+
+	for name, b := range map[string][]byte{
+		rel.binaryName():                     zbuf.Bytes(),
+		rel.prefix() + "_SHA256SUMS":         sums,
+		rel.prefix() + "_SHA256SUMS.sig":     []byte("sig"),
+		rel.prefix() + "_gpg-public-key.pem": []byte("key"),
+	} {
+		p := filepath.Join(dir, name)
+		if err := os.WriteFile(p, b, 0o600); err != nil {
+			t.Fatal(err)
+		}
+		rel.Files[name] = p
+	}
+	return rel
+}
+
+func TestValidateProvider(t *testing.T) {
+	t.Parallel()
+
+	const exe = "terraform-provider-demo_v1.0.0"
+	linux := elfExecutable(t, elf.EM_X86_64)
+
+	cases := []struct {
+		name     string
+		os, arch string
+		entries  map[string][]byte
+		sums     []byte
+		wantErr  string
+	}{
+		{
+			name:    "linux",
+			os:      "linux",
+			arch:    "amd64",
+			entries: map[string][]byte{exe: linux, "LICENSE": []byte("MPL"), "docs/": nil},
+		},
+		{
+			name:    "darwin",
+			os:      "darwin",
+			arch:    "arm64",
+			entries: map[string][]byte{exe: machoExecutable(t, macho.CpuArm64)},
+		},
+		{
+			name:    "windows",
+			os:      "windows",
+			arch:    "amd64",
+			entries: map[string][]byte{exe + ".exe": peExecutable(t, pe.IMAGE_FILE_MACHINE_AMD64)},
+		},
+		{
+			name:    "not in SHA256SUMS",
+			os:      "linux",
+			arch:    "amd64",
+			entries: map[string][]byte{exe: linux},
+			sums:    []byte(strings.Repeat("0", 64) + "  terraform-provider-demo_1.0.0_darwin_arm64.zip\n"),
+			wantErr: "is not listed in terraform-provider-demo_1.0.0_SHA256SUMS",
+		},
+		{
+			name:    "checksum mismatch",
+			os:      "linux",
+			arch:    "amd64",
+			entries: map[string][]byte{exe: linux},
+			sums:    []byte(strings.Repeat("0", 64) + "  terraform-provider-demo_1.0.0_linux_amd64.zip\n"),
+			wantErr: "is listed in terraform-provider-demo_1.0.0_SHA256SUMS with checksum " + strings.Repeat("0", 64),
+		},
+		{
+			name:    "no executable",
+			os:      "linux",
+			arch:    "amd64",
+			entries: map[string][]byte{"README.md": []byte("demo")},
+			wantErr: `zip doesn't contain the executable "terraform-provider-demo_v1.0.0"`,
+		},
+		{
+			name:    "misnamed executable",
+			os:      "linux",
+			arch:    "amd64",
+			entries: map[string][]byte{"terraform-provider-demo": linux},
+			wantErr: "is an unexpected executable",
+		},
+		{
+			name:    "wrong format for os",
+			os:      "windows",
+			arch:    "amd64",
+			entries: map[string][]byte{exe + ".exe": linux},
+			wantErr: "is a ELF executable for amd64, but the release is for windows_amd64",
+		},
+		{
+			name:    "wrong arch",
+			os:      "linux",
+			arch:    "amd64",
+			entries: map[string][]byte{exe: elfExecutable(t, elf.EM_AARCH64)},
+			wantErr: "is a ELF executable for arm64, but the release is for linux_amd64",
+		},
+		{
+			name:    "not an executable",
+			os:      "linux",
+			arch:    "amd64",
+			entries: map[string][]byte{exe: []byte("#!/bin/sh\n")},
+			wantErr: "is not an ELF, Mach-O or PE executable",
+		},
+		{
+			name:    "unsafe path",
+			os:      "linux",
+			arch:    "amd64",
+			entries: map[string][]byte{exe: linux, "../escape": []byte("x")},
+			wantErr: `zip entry "../escape" has an unsafe path`,
+		},
+	}
+	for _, tc := range cases {
+		err := ValidateProvider(providerFiles(t, tc.os, tc.arch, tc.entries, tc.sums))
+		switch {
+		case tc.wantErr == "" && err != nil:
+			t.Errorf("%s: %v", tc.name, err)
+		case tc.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tc.wantErr)):
+			t.Errorf("%s: got error %v, want %q", tc.name, err, tc.wantErr)
+		}
+	}
+}
+
+func TestValidateProviderMissingFiles(t *testing.T) {
+	t.Parallel()
+
+	rel := providerFiles(t, "linux", "amd64", map[string][]byte{"terraform-provider-demo_v1.0.0": elfExecutable(t, elf.EM_X86_64)}, nil)
+	delete(rel.Files, rel.prefix()+"_SHA256SUMS.sig")
+	rel.Files["terraform-provider-other_1.0.0_SHA256SUMS"] = rel.Files[rel.prefix()+"_SHA256SUMS"]
+
+	err := ValidateProvider(rel)
+	if err == nil {
+		t.Fatal("got no error")
+	}
+	for _, want := range []string{"terraform-provider-demo_1.0.0_SHA256SUMS.sig is missing", "terraform-provider-other_1.0.0_SHA256SUMS doesn't belong to the release"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("got error %v, want %q", err, want)
+		}
+	}
+}
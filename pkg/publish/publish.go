@@ -0,0 +1,53 @@
+// Package publish validates releases and writes them to stores. Every path
+// that adds versions to a store goes through it, so malformed releases are
+// rejected before any file is written, and publishing is audited with the
+// audit logger and principal of the context.
+package publish
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/yolocs/ar-terraform-registry/pkg/audit"
+	"github.com/yolocs/ar-terraform-registry/pkg/model"
+)
+
+// ValidationError reports every problem found in a release.
+type ValidationError struct {
+	Release  string
+	Problems []string
+}
+
+func (e *ValidationError) Error() string {
+	return fmt.Sprintf("invalid release %s:\n  - %s", e.Release, strings.Join(e.Problems, "\n  - "))
+}
+
+// problems collects validation failures.
+type problems []string
+
+func (p *problems) add(format string, args ...any) {
+	*p = append(*p, fmt.Sprintf(format, args...))
+}
+
+func (p problems) err(release string) error {
+	if len(p) == 0 {
+		return nil
+	}
+	return &ValidationError{Release: release, Problems: p}
+}
+
+// emit audits a publish attempt, except for releases that already exist.
+func emit(ctx context.Context, e *audit.Event, err error) error {
+	if errors.Is(err, model.ErrAlreadyExists) {
+		return err
+	}
+	e.Principal = audit.PrincipalFromContext(ctx)
+	e.Result = audit.Result(err)
+	if err != nil {
+		e.Error = err.Error()
+	}
+	audit.FromContext(ctx).Emit(ctx, e)
+	return err
+}
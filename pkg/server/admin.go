@@ -0,0 +1,297 @@
+package server
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/abcxyz/pkg/logging"
+
+	"github.com/yolocs/ar-terraform-registry/pkg/model"
+	"github.com/yolocs/ar-terraform-registry/pkg/notify"
+)
+
+// AdminConfig enables the admin API under /admin/v1. Callers authenticate
+// with one of the bearer tokens or an allowed client certificate.
+type AdminConfig struct {
+	Store model.Admin
+	// Tokens maps caller names to bearer tokens. The name is the principal of
+	// requests using the token.
+	Tokens map[string]string
+	// Principals are the client certificate principals allowed to call the
+	// API.
+	Principals []string
+}
+
+// validNamespace matches the namespaces that can be created. Stores may be
+// stricter.
+var validNamespace = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9_-]{0,62}$`)
+
+type AdminNamespacesResponse struct {
+	Namespaces []string `json:"namespaces"`
+}
+
+type AdminCreateNamespaceRequest struct {
+	Namespace string `json:"namespace"`
+}
+
+type AdminPackagesResponse struct {
+	Packages []*AdminPackage `json:"packages"`
+}
+
+type AdminPackage struct {
+	Kind   string `json:"kind"`
+	Name   string `json:"name"`
+	System string `json:"system,omitempty"`
+}
+
+type AdminVersionsResponse struct {
+	Versions []*model.VersionInfo `json:"versions"`
+}
+
+type AdminFilesResponse struct {
+	Files []*model.FileInfo `json:"files"`
+}
+
+type AdminDeliveriesResponse struct {
+	Deliveries []*notify.Delivery `json:"deliveries"`
+}
+
+type AdminErrorResponse struct {
+	Error string `json:"error"`
+}
+
+func (reg *Registry) AdminListNamespaces(w http.ResponseWriter, r *http.Request) {
+	ctx := logging.WithLogger(r.Context(), reg.logger)
+
+	namespaces, err := reg.cfg.Admin.Store.ListNamespaces(ctx)
+	if err != nil {
+		reg.adminError(ctx, w, "ListNamespaces", err)
+		return
+	}
+	reg.adminJSON(ctx, w, http.StatusOK, AdminNamespacesResponse{Namespaces: append([]string{}, namespaces...)})
+}
+
+func (reg *Registry) AdminCreateNamespace(w http.ResponseWriter, r *http.Request) {
+	ctx := logging.WithLogger(r.Context(), reg.logger)
+
+	var req AdminCreateNamespaceRequest
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1<<16)).Decode(&req); err != nil {
+		reg.adminJSON(ctx, w, http.StatusBadRequest, AdminErrorResponse{Error: fmt.Sprintf("invalid request: %v", err)})
+		return
+	}
+	if !validNamespace.MatchString(req.Namespace) {
+		reg.adminJSON(ctx, w, http.StatusBadRequest, AdminErrorResponse{Error: fmt.Sprintf("invalid namespace %q", req.Namespace)})
+		return
+	}
+
+	if e := auditEventFrom(ctx); e != nil {
+		e.Namespace = req.Namespace
+	}
+	if err := reg.cfg.Admin.Store.CreateNamespace(ctx, req.Namespace); err != nil {
+		reg.adminError(ctx, w, "CreateNamespace", err)
+		return
+	}
+	reg.adminJSON(ctx, w, http.StatusCreated, req)
+}
+
+func (reg *Registry) AdminListPackages(w http.ResponseWriter, r *http.Request) {
+	namespace := r.PathValue("namespace")
+	ctx := logging.WithLogger(r.Context(), reg.logger)
+
+	refs, err := reg.cfg.Admin.Store.ListPackages(ctx, namespace)
+	if err != nil {
+		reg.adminError(ctx, w, "ListPackages", err)
+		return
+	}
+	resp := AdminPackagesResponse{Packages: make([]*AdminPackage, 0, len(refs))}
+	for _, ref := range refs {
+		resp.Packages = append(resp.Packages, &AdminPackage{Kind: ref.Kind, Name: ref.Name, System: ref.System})
+	}
+	reg.adminJSON(ctx, w, http.StatusOK, resp)
+}
+
+func (reg *Registry) AdminDeletePackage(w http.ResponseWriter, r *http.Request) {
+	namespace, ref := r.PathValue("namespace"), adminPackageRef(r)
+	ctx := logging.WithLogger(r.Context(), reg.logger)
+
+	if err := reg.cfg.Admin.Store.DeletePackage(ctx, namespace, ref); err != nil {
+		reg.adminError(ctx, w, "DeletePackage", err)
+		return
+	}
+	reg.forgetCached(namespace, ref, "")
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (reg *Registry) AdminListVersions(w http.ResponseWriter, r *http.Request) {
+	namespace, ref := r.PathValue("namespace"), adminPackageRef(r)
+	ctx := logging.WithLogger(r.Context(), reg.logger)
+
+	versions, err := reg.cfg.Admin.Store.ListVersions(ctx, namespace, ref)
+	if err != nil {
+		reg.adminError(ctx, w, "ListVersions", err)
+		return
+	}
+	reg.adminJSON(ctx, w, http.StatusOK, AdminVersionsResponse{Versions: append([]*model.VersionInfo{}, versions...)})
+}
+
+func (reg *Registry) AdminDeleteVersion(w http.ResponseWriter, r *http.Request) {
+	namespace, ref, version := r.PathValue("namespace"), adminPackageRef(r), r.PathValue("version")
+	ctx := logging.WithLogger(r.Context(), reg.logger)
+
+	if err := reg.cfg.Admin.Store.DeleteVersion(ctx, namespace, ref, version); err != nil {
+		reg.adminError(ctx, w, "DeleteVersion", err)
+		return
+	}
+	reg.forgetCached(namespace, ref, version)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (reg *Registry) AdminVersionFiles(w http.ResponseWriter, r *http.Request) {
+	namespace, ref, version := r.PathValue("namespace"), adminPackageRef(r), r.PathValue("version")
+	ctx := logging.WithLogger(r.Context(), reg.logger)
+
+	files, err := reg.cfg.Admin.Store.ListVersionFiles(ctx, namespace, ref, version)
+	if err != nil {
+		reg.adminError(ctx, w, "ListVersionFiles", err)
+		return
+	}
+	reg.adminJSON(ctx, w, http.StatusOK, AdminFilesResponse{Files: append([]*model.FileInfo{}, files...)})
+}
+
+func (reg *Registry) AdminYank(w http.ResponseWriter, r *http.Request) {
+	reg.setYanked(w, r, true)
+}
+
+func (reg *Registry) AdminUnyank(w http.ResponseWriter, r *http.Request) {
+	reg.setYanked(w, r, false)
+}
+
+func (reg *Registry) setYanked(w http.ResponseWriter, r *http.Request, yanked bool) {
+	namespace, ref, version := r.PathValue("namespace"), adminPackageRef(r), r.PathValue("version")
+	ctx := logging.WithLogger(r.Context(), reg.logger)
+
+	if err := reg.cfg.Admin.Store.SetYanked(ctx, namespace, ref, version, yanked); err != nil {
+		reg.adminError(ctx, w, "SetYanked", err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// AdminWebhookDeliveries lists the recent webhook delivery attempts, newest
+// first.
+func (reg *Registry) AdminWebhookDeliveries(w http.ResponseWriter, r *http.Request) {
+	ctx := logging.WithLogger(r.Context(), reg.logger)
+	reg.adminJSON(ctx, w, http.StatusOK, AdminDeliveriesResponse{Deliveries: reg.cfg.Webhooks.Deliveries()})
+}
+
+// SetAdminCredentials replaces the bearer tokens and client certificate
+// principals accepted by the admin API, e.g. after the config was reloaded.
+// It has no effect if the admin API is disabled.
+func (reg *Registry) SetAdminCredentials(tokens map[string]string, principals []string) {
+	cur := reg.admin.Load()
+	if cur == nil {
+		return
+	}
+	next := *cur
+	next.Tokens, next.Principals = tokens, principals
+	reg.admin.Store(&next)
+}
+
+// adminAuth admits callers presenting one of the configured bearer tokens, or
+// a client certificate of an allowed principal.
+func (reg *Registry) adminAuth(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		admin := reg.admin.Load()
+
+		p := PrincipalFromContext(ctx)
+		if token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer "); ok {
+			p = nil
+			for name, t := range admin.Tokens {
+				if t != "" && subtle.ConstantTimeCompare([]byte(token), []byte(t)) == 1 {
+					p = &Principal{Name: name, Source: "token"}
+					ctx = WithPrincipal(ctx, p)
+					if e := auditEventFrom(ctx); e != nil {
+						e.Principal, e.Auth = p.Name, p.Source
+					}
+					break
+				}
+			}
+		} else if p != nil && !slices.Contains(admin.Principals, p.Name) {
+			reg.logger.WarnContext(ctx, "admin request denied", "principal", p.Name, "method", r.Method, "path", r.URL.Path)
+			reg.adminJSON(ctx, w, http.StatusForbidden, AdminErrorResponse{Error: http.StatusText(http.StatusForbidden)})
+			return
+		}
+		if p == nil {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="admin"`)
+			reg.adminJSON(ctx, w, http.StatusUnauthorized, AdminErrorResponse{Error: http.StatusText(http.StatusUnauthorized)})
+			return
+		}
+
+		reg.logger.InfoContext(ctx, "admin request", "principal", p.Name, "method", r.Method, "path", r.URL.Path)
+		next(w, r.WithContext(ctx))
+	}
+}
+
+// adminPackageRef returns the package addressed by the request path.
+func adminPackageRef(r *http.Request) *model.PackageRef {
+	if system := r.PathValue("system"); system != "" {
+		return &model.PackageRef{Kind: model.KindModule, Name: r.PathValue("name"), System: system}
+	}
+	return &model.PackageRef{Kind: model.KindProvider, Name: r.PathValue("name")}
+}
+
+// forgetCached drops the cached hashes and metadata of a version, or of every
+// version of the package if version is empty, so republished versions aren't
+// served stale data.
+func (reg *Registry) forgetCached(namespace string, ref *model.PackageRef, version string) {
+	cache, prefix := &reg.packageHashes, []string{namespace, ref.Name}
+	if ref.Kind == model.KindModule {
+		cache, prefix = &reg.moduleMetadataCache, []string{namespace, ref.Name, ref.System}
+	}
+	if version != "" {
+		prefix = append(prefix, version)
+	}
+	p := strings.Join(prefix, "/")
+	cache.Range(func(key, _ any) bool {
+		if k := key.(string); k == p || strings.HasPrefix(k, p+"/") {
+			cache.Delete(key)
+		}
+		return true
+	})
+}
+
+// adminError maps store errors to status codes. Admin callers are trusted,
+// so the error is returned to them.
+func (reg *Registry) adminError(ctx context.Context, w http.ResponseWriter, op string, err error) {
+	code := http.StatusInternalServerError
+	switch {
+	case errors.Is(err, model.ErrNotFound):
+		code = http.StatusNotFound
+	case errors.Is(err, model.ErrAlreadyExists):
+		code = http.StatusConflict
+	case errors.Is(err, errors.ErrUnsupported):
+		code = http.StatusNotImplemented
+	default:
+		reg.logger.ErrorContext(ctx, op, "error", err)
+	}
+	if e := auditEventFrom(ctx); e != nil {
+		e.Error = err.Error()
+	}
+	reg.adminJSON(ctx, w, code, AdminErrorResponse{Error: err.Error()})
+}
+
+func (reg *Registry) adminJSON(ctx context.Context, w http.ResponseWriter, code int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		reg.logger.ErrorContext(ctx, "adminJSON", "error", err)
+	}
+}
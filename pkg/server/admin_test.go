@@ -0,0 +1,39 @@
+package server
+
+import (
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestSetAdminCredentials(t *testing.T) {
+	t.Parallel()
+
+	reg, err := New(&Config{
+		Logger: slog.New(slog.NewTextHandler(io.Discard, nil)),
+		Admin:  &AdminConfig{Tokens: map[string]string{"ci": "old"}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	status := func(token string) int {
+		r := httptest.NewRequest(http.MethodGet, "/debug/vars", nil)
+		r.Header.Set("Authorization", "Bearer "+token)
+		w := httptest.NewRecorder()
+		reg.Handler().ServeHTTP(w, r)
+		return w.Code
+	}
+
+	if got := status("old"); got != http.StatusOK {
+		t.Errorf("old token before rotation: got %d, want %d", got, http.StatusOK)
+	}
+	reg.SetAdminCredentials(map[string]string{"ci": "new"}, nil)
+	if got := status("old"); got != http.StatusUnauthorized {
+		t.Errorf("old token after rotation: got %d, want %d", got, http.StatusUnauthorized)
+	}
+	if got := status("new"); got != http.StatusOK {
+		t.Errorf("new token after rotation: got %d, want %d", got, http.StatusOK)
+	}
+}
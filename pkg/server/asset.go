@@ -0,0 +1,102 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"mime"
+	"net/http"
+	"path"
+	"strings"
+
+	"github.com/yolocs/ar-terraform-registry/pkg/model"
+)
+
+// immutableCacheControl is sent with assets; published versions never change.
+const immutableCacheControl = "private, max-age=31536000, immutable"
+
+// setAssetHeaders sets the headers shared by all asset responses.
+func setAssetHeaders(w http.ResponseWriter, name, contentType string) {
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": name}))
+	w.Header().Set("Cache-Control", immutableCacheControl)
+}
+
+// serveAsset serves an opened asset with Content-Length, ETag, Last-Modified,
+// HEAD, conditional and Range request support. Like streamAsset, it aborts
+// the connection if reading fails once the body has started.
+func serveAsset(ctx context.Context, logger *slog.Logger, w http.ResponseWriter, r *http.Request, asset *model.Asset, name, contentType string) {
+	setAssetHeaders(w, name, contentType)
+	w.Header().Set("ETag", assetETag(asset))
+
+	// ServeContent stops silently when reading fails mid-stream, which would
+	// end a truncated response normally; remember the error to abort it.
+	er := &errReader{ReadSeeker: asset}
+	http.ServeContent(w, r, name, asset.ModTime, er)
+	if er.err != nil {
+		logger.ErrorContext(ctx, "Serve asset", "asset", name, "error", er.err)
+		if e := auditEventFrom(ctx); e != nil {
+			e.Error = er.err.Error()
+		}
+		panic(http.ErrAbortHandler)
+	}
+}
+
+// streamAsset copies an asset without metadata. Once the body has started,
+// errors can't be reported with a status code, so the connection is aborted
+// to signal the client that the download is incomplete.
+func streamAsset(ctx context.Context, logger *slog.Logger, w http.ResponseWriter, r *http.Request, rc io.Reader, name, contentType string) {
+	setAssetHeaders(w, name, contentType)
+	if r.Method == http.MethodHead {
+		return
+	}
+
+	written, err := io.Copy(w, rc)
+	if err != nil {
+		logger.ErrorContext(ctx, "Copy asset", "asset", name, "written", written, "error", err)
+		if e := auditEventFrom(ctx); e != nil {
+			e.Error = err.Error()
+		}
+		panic(http.ErrAbortHandler)
+	}
+	logger.DebugContext(ctx, "Copy asset", "asset", name, "written", written)
+}
+
+// assetETag is the content hash if the store knows it, else a weak tag
+// derived from the size and modification time.
+func assetETag(asset *model.Asset) string {
+	if asset.SHA256 != "" {
+		return fmt.Sprintf("%q", asset.SHA256)
+	}
+	return fmt.Sprintf("W/\"%x-%x\"", asset.Size, asset.ModTime.UnixNano())
+}
+
+// providerAssetContentType guesses the content type from the file name.
+func providerAssetContentType(name string) string {
+	switch {
+	case strings.HasSuffix(name, "_SHA256SUMS"):
+		return "text/plain; charset=utf-8"
+	case strings.HasSuffix(name, "_SHA256SUMS.sig"):
+		return "application/pgp-signature"
+	}
+	if ct := mime.TypeByExtension(path.Ext(name)); ct != "" {
+		return ct
+	}
+	return "application/octet-stream"
+}
+
+// errReader records the first read error other than io.EOF.
+type errReader struct {
+	io.ReadSeeker
+	err error
+}
+
+func (r *errReader) Read(p []byte) (int, error) {
+	n, err := r.ReadSeeker.Read(p)
+	if err != nil && !errors.Is(err, io.EOF) && r.err == nil {
+		r.err = err
+	}
+	return n, err
+}
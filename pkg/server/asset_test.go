@@ -0,0 +1,86 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/yolocs/ar-terraform-registry/pkg/audit"
+	"github.com/yolocs/ar-terraform-registry/pkg/model"
+)
+
+// eventSink passes audit events to a channel.
+type eventSink chan *audit.Event
+
+func (s eventSink) Write(ctx context.Context, e *audit.Event) error {
+	s <- e
+	return nil
+}
+
+func (s eventSink) Close() error { return nil }
+
+// failingReader fails every read from offset failAt on.
+type failingReader struct {
+	*bytes.Reader
+	failAt int64
+}
+
+func (r *failingReader) Read(p []byte) (int, error) {
+	pos, _ := r.Seek(0, io.SeekCurrent)
+	if pos >= r.failAt {
+		return 0, errors.New("disk failed")
+	}
+	if rem := r.failAt - pos; int64(len(p)) > rem {
+		p = p[:rem]
+	}
+	return r.Reader.Read(p)
+}
+
+func (r *failingReader) Close() error { return nil }
+
+func TestServeAssetAbortsOnReadError(t *testing.T) {
+	t.Parallel()
+
+	events := make(eventSink, 1)
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	reg, err := New(&Config{Logger: logger, Audit: audit.New(events)})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	content := bytes.Repeat([]byte("x"), 1<<16)
+	srv := httptest.NewServer(reg.audited(audit.ActionProviderDownload, func(w http.ResponseWriter, r *http.Request) {
+		asset := &model.Asset{
+			ReadSeekCloser: &failingReader{Reader: bytes.NewReader(content), failAt: 1 << 15},
+			Size:           int64(len(content)),
+			ModTime:        time.Now(),
+		}
+		serveAsset(r.Context(), logger, w, r, asset, "terraform-provider-demo_1.0.0_linux_amd64.zip", "application/zip")
+	}))
+	t.Cleanup(srv.Close)
+
+	resp, err := http.Get(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err == nil {
+		t.Errorf("got a complete response of %d bytes, want the download aborted", len(body))
+	}
+
+	select {
+	case e := <-events:
+		if e.Result != audit.ResultFailure || e.Error != "disk failed" {
+			t.Errorf("audit event: got result %q with error %q, want a failure with the read error", e.Result, e.Error)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for the audit event")
+	}
+}
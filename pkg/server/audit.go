@@ -0,0 +1,124 @@
+package server
+
+import (
+	"context"
+	"net/http"
+	"strings"
+
+	"github.com/yolocs/ar-terraform-registry/pkg/audit"
+	"github.com/yolocs/ar-terraform-registry/pkg/model"
+)
+
+type auditEventKey struct{}
+
+// auditEventFrom returns the audit event of the request, so handlers can
+// complete it, or nil if the request isn't audited.
+func auditEventFrom(ctx context.Context) *audit.Event {
+	e, _ := ctx.Value(auditEventKey{}).(*audit.Event)
+	return e
+}
+
+// audited emits an audit event for the request once it's handled. The event
+// is filled from the path values and the response status. Handlers aborting
+// the response, like interrupted downloads, are audited as failures.
+func (reg *Registry) audited(action string, next http.HandlerFunc) http.HandlerFunc {
+	if reg.audit == nil {
+		return next
+	}
+	return func(w http.ResponseWriter, r *http.Request) {
+		e := &audit.Event{
+			Action:    action,
+			Namespace: r.PathValue("namespace"),
+			Name:      r.PathValue("name"),
+			System:    r.PathValue("system"),
+			Version:   r.PathValue("version"),
+			OS:        r.PathValue("os"),
+			Arch:      r.PathValue("arch"),
+			File:      r.PathValue("assetName"),
+			ClientIP:  clientIP(r, reg.cfg.RateLimit != nil && reg.cfg.RateLimit.TrustForwardedFor),
+			UserAgent: r.UserAgent(),
+		}
+		switch {
+		case strings.HasPrefix(action, "module.") || e.System != "":
+			e.Kind = model.KindModule
+		case strings.HasPrefix(action, "provider.") || e.Name != "":
+			e.Kind = model.KindProvider
+		}
+		if e.File != "" {
+			e.Version, e.OS, e.Arch = assetVersion(e.Kind, e.File)
+		}
+		if p := PrincipalFromContext(r.Context()); p != nil {
+			e.Principal, e.Auth = p.Name, p.Source
+		}
+
+		rec := &statusRecorder{ResponseWriter: w}
+		defer func() {
+			aborted := recover()
+
+			e.Status = rec.status
+			if e.Status == 0 {
+				e.Status = http.StatusOK
+			}
+			switch {
+			case aborted != nil:
+				e.Result = audit.ResultFailure
+				if e.Error == "" {
+					e.Error = "response aborted"
+				}
+			case e.Status == http.StatusUnauthorized || e.Status == http.StatusForbidden:
+				e.Result = audit.ResultDenied
+			case e.Status >= 400:
+				e.Result = audit.ResultFailure
+			default:
+				e.Result = audit.ResultSuccess
+			}
+			reg.audit.Emit(r.Context(), e)
+
+			if aborted != nil {
+				panic(aborted)
+			}
+		}()
+		next(rec, r.WithContext(context.WithValue(r.Context(), auditEventKey{}, e)))
+	}
+}
+
+// assetVersion returns the version, and for providers the platform, encoded
+// in a "<package>:<version>:<name>" file name.
+func assetVersion(kind, fileName string) (string, string, string) {
+	parts := strings.SplitN(fileName, ":", 3)
+	if len(parts) != 3 {
+		return "", "", ""
+	}
+	if kind == model.KindProvider {
+		// Versions may contain dashes, os and arch don't.
+		if v := strings.Split(parts[1], "-"); len(v) >= 3 {
+			return strings.Join(v[:len(v)-2], "-"), v[len(v)-2], v[len(v)-1]
+		}
+	}
+	return parts[1], "", ""
+}
+
+// statusRecorder records the response status.
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (rec *statusRecorder) WriteHeader(code int) {
+	if rec.status == 0 {
+		rec.status = code
+	}
+	rec.ResponseWriter.WriteHeader(code)
+}
+
+func (rec *statusRecorder) Write(b []byte) (int, error) {
+	if rec.status == 0 {
+		rec.status = http.StatusOK
+	}
+	return rec.ResponseWriter.Write(b)
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer.
+func (rec *statusRecorder) Unwrap() http.ResponseWriter {
+	return rec.ResponseWriter
+}
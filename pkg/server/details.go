@@ -0,0 +1,277 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/abcxyz/pkg/logging"
+
+	"github.com/yolocs/ar-terraform-registry/pkg/model"
+	"github.com/yolocs/ar-terraform-registry/pkg/publish"
+)
+
+// ModuleDetailsResponse describes a module version in the shape of the public
+// registry's module details.
+type ModuleDetailsResponse struct {
+	ID         string                 `json:"id"`
+	Namespace  string                 `json:"namespace"`
+	Name       string                 `json:"name"`
+	Provider   string                 `json:"provider"`
+	Version    string                 `json:"version"`
+	Root       *ModuleDetailsConfig   `json:"root"`
+	Submodules []*ModuleDetailsConfig `json:"submodules"`
+	Examples   []*ModuleDetailsConfig `json:"examples"`
+	Providers  []string               `json:"providers"`
+	Versions   []string               `json:"versions"`
+}
+
+type ModuleDetailsConfig struct {
+	Path                 string                            `json:"path"`
+	Readme               string                            `json:"readme"`
+	Empty                bool                              `json:"empty"`
+	RequiredVersion      []string                          `json:"required_version,omitempty"`
+	Inputs               []*ModuleDetailsInput             `json:"inputs"`
+	Outputs              []*ModuleDetailsOutput            `json:"outputs"`
+	Dependencies         []*model.ModuleDependency         `json:"dependencies"`
+	ProviderDependencies []*model.ModuleProviderDependency `json:"provider_dependencies"`
+	Resources            []*ModuleDetailsResource          `json:"resources"`
+}
+
+type ModuleDetailsInput struct {
+	Name        string `json:"name"`
+	Type        string `json:"type"`
+	Description string `json:"description"`
+	// Default is the JSON encoded default value, empty for required inputs.
+	Default  string `json:"default"`
+	Required bool   `json:"required"`
+}
+
+type ModuleDetailsOutput struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+}
+
+type ModuleDetailsResource struct {
+	Name string `json:"name"`
+	Type string `json:"type"`
+}
+
+func (reg *Registry) ModuleDetails(w http.ResponseWriter, r *http.Request) {
+	var (
+		namespace = r.PathValue("namespace")
+		name      = r.PathValue("name")
+		system    = r.PathValue("system")
+		version   = r.PathValue("version")
+	)
+	ctx := logging.WithLogger(r.Context(), reg.logger)
+
+	versions, err := reg.ms.ListModuleVersions(ctx, namespace, name, system)
+	if err != nil {
+		http.Error(w, http.StatusText(http.StatusNotFound), http.StatusNotFound)
+		reg.logger.ErrorContext(ctx, "ListModuleVersions", "error", err)
+		return
+	}
+	resp := ModuleDetailsResponse{
+		ID:        fmt.Sprintf("%s/%s/%s/%s", namespace, name, system, version),
+		Namespace: namespace,
+		Name:      name,
+		Provider:  system,
+		Version:   version,
+		Providers: []string{system},
+		Versions:  []string{},
+	}
+	var v *model.ModuleVersion
+	for _, mv := range versions {
+		resp.Versions = append(resp.Versions, mv.Version)
+		if mv.Version == version {
+			v = mv
+		}
+	}
+	if v == nil {
+		http.Error(w, http.StatusText(http.StatusNotFound), http.StatusNotFound)
+		return
+	}
+
+	md, err := reg.moduleMetadata(ctx, namespace, name, system, v)
+	if err != nil {
+		http.Error(w, http.StatusText(http.StatusNotFound), http.StatusNotFound)
+		reg.logger.ErrorContext(ctx, "ModuleDetails", "error", err)
+		return
+	}
+	resp.Root = moduleDetailsConfig(md.Root)
+	resp.Submodules = make([]*ModuleDetailsConfig, 0, len(md.Submodules))
+	for _, c := range md.Submodules {
+		resp.Submodules = append(resp.Submodules, moduleDetailsConfig(c))
+	}
+	resp.Examples = make([]*ModuleDetailsConfig, 0, len(md.Examples))
+	for _, c := range md.Examples {
+		resp.Examples = append(resp.Examples, moduleDetailsConfig(c))
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(resp); err != nil {
+		reg.logger.ErrorContext(ctx, "ModuleDetails", "error", err)
+	}
+}
+
+// metadataFailureTTL is how long a failure to load module metadata is
+// returned without trying again.
+const metadataFailureTTL = 5 * time.Minute
+
+// metadataFailure is cached for versions whose metadata failed to load.
+type metadataFailure struct {
+	err   error
+	until time.Time
+}
+
+// moduleMetadata returns the metadata stored with the version. Versions
+// without it, such as those published before metadata was extracted or built
+// from git, are analyzed from their archive. Results and failures are cached,
+// and results written back to stores that keep metadata.
+func (reg *Registry) moduleMetadata(ctx context.Context, namespace, name, system string, v *model.ModuleVersion) (*model.ModuleMetadata, error) {
+	key := strings.Join([]string{namespace, name, system, v.Version}, "/")
+	if cached, ok := reg.moduleMetadataCache.Load(key); ok {
+		switch c := cached.(type) {
+		case *model.ModuleMetadata:
+			return c, nil
+		case *metadataFailure:
+			if time.Now().Before(c.until) {
+				return nil, c.err
+			}
+		}
+	}
+
+	// Analyzing may download and extract a large archive, so concurrent
+	// requests for a version share one load. It isn't canceled when the
+	// caller that started it goes away.
+	ch := reg.moduleMetadataCalls.DoChan(key, func() (any, error) {
+		md, err := reg.loadModuleMetadata(context.WithoutCancel(ctx), key, namespace, name, system, v)
+		if err != nil {
+			reg.moduleMetadataCache.Store(key, &metadataFailure{err: err, until: time.Now().Add(metadataFailureTTL)})
+			return nil, err
+		}
+		reg.moduleMetadataCache.Store(key, md)
+		return md, nil
+	})
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case res := <-ch:
+		if res.Err != nil {
+			return nil, res.Err
+		}
+		return res.Val.(*model.ModuleMetadata), nil
+	}
+}
+
+func (reg *Registry) loadModuleMetadata(ctx context.Context, key, namespace, name, system string, v *model.ModuleVersion) (*model.ModuleMetadata, error) {
+	if mr, ok := reg.ms.(model.ModuleMetadataReader); ok {
+		md, err := mr.GetModuleMetadata(ctx, namespace, name, system, v.Version)
+		if err == nil {
+			return md, nil
+		}
+		if !errors.Is(err, model.ErrNotFound) && !errors.Is(err, errors.ErrUnsupported) {
+			return nil, err
+		}
+	}
+
+	md, err := reg.analyzeModuleArchive(ctx, namespace, name, system, v)
+	if err != nil {
+		return nil, err
+	}
+	if mw, ok := reg.ms.(model.ModuleMetadataWriter); ok {
+		err := mw.PutModuleMetadata(ctx, namespace, name, system, v.Version, md)
+		if err != nil && !errors.Is(err, errors.ErrUnsupported) && !errors.Is(err, model.ErrAlreadyExists) {
+			reg.logger.WarnContext(ctx, "failed to store module metadata", "module", key, "error", err)
+		}
+	}
+	return md, nil
+}
+
+func (reg *Registry) analyzeModuleArchive(ctx context.Context, namespace, name, system string, v *model.ModuleVersion) (*model.ModuleMetadata, error) {
+	u, err := url.Parse(v.SourceURL)
+	if err != nil || u.IsAbs() || !strings.HasPrefix(u.Path, "/download/module/") {
+		return nil, fmt.Errorf("version %s is not served by the registry (%q)", v.Version, v.SourceURL)
+	}
+
+	rc, err := reg.ms.GetModuleArchive(ctx, namespace, path.Base(u.Path))
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+
+	f, err := os.CreateTemp("", "module-archive-*")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create temporary file: %w", err)
+	}
+	defer os.Remove(f.Name())
+	defer f.Close()
+	if _, err := io.Copy(f, rc); err != nil {
+		return nil, fmt.Errorf("failed to download archive: %w", err)
+	}
+	if err := f.Close(); err != nil {
+		return nil, fmt.Errorf("failed to download archive: %w", err)
+	}
+
+	return publish.AnalyzeModule(&publish.ModuleRelease{
+		Namespace: namespace,
+		Name:      name,
+		System:    system,
+		Version:   v.Version,
+		Format:    u.Query().Get("archive"),
+		Subdir:    v.Subdir,
+		Archive:   f.Name(),
+	})
+}
+
+func moduleDetailsConfig(c *model.ModuleConfig) *ModuleDetailsConfig {
+	d := &ModuleDetailsConfig{
+		Path:                 c.Path,
+		Readme:               c.Readme,
+		RequiredVersion:      c.RequiredVersion,
+		Inputs:               make([]*ModuleDetailsInput, 0, len(c.Inputs)),
+		Outputs:              make([]*ModuleDetailsOutput, 0, len(c.Outputs)),
+		Dependencies:         c.Dependencies,
+		ProviderDependencies: c.ProviderDependencies,
+		Resources:            []*ModuleDetailsResource{},
+	}
+	for _, in := range c.Inputs {
+		var def string
+		if in.Default != nil {
+			b, _ := json.Marshal(in.Default)
+			def = string(b)
+		}
+		d.Inputs = append(d.Inputs, &ModuleDetailsInput{
+			Name:        in.Name,
+			Type:        in.Type,
+			Description: in.Description,
+			Default:     def,
+			Required:    in.Required,
+		})
+	}
+	for _, out := range c.Outputs {
+		d.Outputs = append(d.Outputs, &ModuleDetailsOutput{Name: out.Name, Description: out.Description})
+	}
+	for _, res := range c.Resources {
+		if res.Mode == "managed" {
+			d.Resources = append(d.Resources, &ModuleDetailsResource{Name: res.Name, Type: res.Type})
+		}
+	}
+	if d.Dependencies == nil {
+		d.Dependencies = []*model.ModuleDependency{}
+	}
+	if d.ProviderDependencies == nil {
+		d.ProviderDependencies = []*model.ModuleProviderDependency{}
+	}
+	d.Empty = len(d.Inputs) == 0 && len(d.Outputs) == 0 && len(d.Resources) == 0 && len(d.Dependencies) == 0
+	return d
+}
@@ -0,0 +1,176 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"expvar"
+	"fmt"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const defaultDrainTimeout = 30 * time.Second
+
+var drainMetrics = expvar.NewMap("drain")
+
+// drain shuts the server down without cutting off in-flight downloads: it
+// reports not-ready, keeps serving for DrainDelay, then stops accepting
+// connections and waits up to DrainTimeout for in-flight requests. Streams
+// still running at the deadline are logged and interrupted.
+func (reg *Registry) drain(ctx context.Context, srv *http.Server) error {
+	// ctx is done, keep its values only.
+	ctx = context.WithoutCancel(ctx)
+	timeout := reg.cfg.DrainTimeout
+	if timeout <= 0 {
+		timeout = defaultDrainTimeout
+	}
+
+	reg.draining.Store(true)
+	drainMetrics.Set("draining", expvarInt(1))
+	reg.logger.InfoContext(ctx, "server is draining",
+		"in_flight_streams", reg.streams.count(),
+		"delay", reg.cfg.DrainDelay.String(),
+		"timeout", timeout.String())
+	if reg.cfg.DrainDelay > 0 {
+		time.Sleep(reg.cfg.DrainDelay)
+	}
+
+	start := time.Now()
+	shutdownCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	err := srv.Shutdown(shutdownCtx)
+	if err == nil {
+		reg.logger.InfoContext(ctx, "server drained", "duration", time.Since(start).Round(time.Millisecond).String())
+		return nil
+	}
+	if !errors.Is(err, context.DeadlineExceeded) {
+		return fmt.Errorf("failed to shutdown server: %w", err)
+	}
+
+	interrupted := reg.streams.active()
+	for _, s := range interrupted {
+		s.interrupt()
+		reg.logger.WarnContext(ctx, "interrupting asset download",
+			"file", s.file,
+			"client", s.client,
+			"bytes_sent", s.written.Load(),
+			"duration", time.Since(s.started).Round(time.Millisecond).String())
+	}
+	reg.logger.WarnContext(ctx, "drain timeout exceeded, closing connections", "interrupted_streams", len(interrupted))
+	if err := srv.Close(); err != nil {
+		return fmt.Errorf("failed to close server: %w", err)
+	}
+	return nil
+}
+
+// tracked records the asset download as in flight until it completes, so
+// downloads interrupted by shutdown can be reported. Downloads may take longer
+// than the server's write timeout, so it's lifted for them; downloads aborted
+// for any reason are counted as interrupted.
+func (reg *Registry) tracked(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if err := http.NewResponseController(w).SetWriteDeadline(time.Time{}); err != nil {
+			reg.logger.WarnContext(r.Context(), "failed to lift write deadline of asset download", "error", err)
+		}
+
+		s := &activeStream{
+			file:    r.PathValue("assetName"),
+			client:  clientIP(r, reg.cfg.RateLimit != nil && reg.cfg.RateLimit.TrustForwardedFor),
+			started: time.Now(),
+		}
+		if p := PrincipalFromContext(r.Context()); p != nil {
+			s.client = p.Name
+		}
+		reg.streams.add(s)
+		defer func() {
+			reg.streams.remove(s)
+			if aborted := recover(); aborted != nil {
+				s.interrupt()
+				panic(aborted)
+			}
+			if reg.draining.Load() {
+				drainMetrics.Add("completed_streams", 1)
+			}
+		}()
+		next(&countingWriter{ResponseWriter: w, n: &s.written}, r)
+	}
+}
+
+type activeStream struct {
+	file        string
+	client      string
+	started     time.Time
+	written     atomic.Int64
+	interrupted atomic.Bool
+}
+
+// interrupt counts the stream as interrupted, once.
+func (s *activeStream) interrupt() {
+	if s.interrupted.CompareAndSwap(false, true) {
+		drainMetrics.Add("interrupted_streams", 1)
+	}
+}
+
+// streamTracker holds the in-flight asset downloads.
+type streamTracker struct {
+	mu      sync.Mutex
+	streams map[*activeStream]struct{}
+}
+
+func (t *streamTracker) add(s *activeStream) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.streams == nil {
+		t.streams = make(map[*activeStream]struct{})
+	}
+	t.streams[s] = struct{}{}
+	drainMetrics.Set("in_flight_streams", expvarInt(int64(len(t.streams))))
+}
+
+func (t *streamTracker) remove(s *activeStream) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	delete(t.streams, s)
+	drainMetrics.Set("in_flight_streams", expvarInt(int64(len(t.streams))))
+}
+
+func (t *streamTracker) count() int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return len(t.streams)
+}
+
+func (t *streamTracker) active() []*activeStream {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	streams := make([]*activeStream, 0, len(t.streams))
+	for s := range t.streams {
+		streams = append(streams, s)
+	}
+	return streams
+}
+
+// countingWriter counts the bytes written to the response.
+type countingWriter struct {
+	http.ResponseWriter
+	n *atomic.Int64
+}
+
+func (w *countingWriter) Write(b []byte) (int, error) {
+	n, err := w.ResponseWriter.Write(b)
+	w.n.Add(int64(n))
+	return n, err
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer.
+func (w *countingWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+func expvarInt(n int64) *expvar.Int {
+	v := new(expvar.Int)
+	v.Set(n)
+	return v
+}
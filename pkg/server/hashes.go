@@ -0,0 +1,195 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/abcxyz/pkg/logging"
+	"golang.org/x/sync/errgroup"
+
+	"github.com/yolocs/ar-terraform-registry/pkg/model"
+)
+
+// ProviderHashesResponse lists the hashes of every platform package of a
+// provider version, in the formats Terraform records in lock files.
+type ProviderHashesResponse struct {
+	Version string `json:"version"`
+	// Hashes are the hashes of all platforms, sorted, as they appear in a
+	// lock file.
+	Hashes    []string                  `json:"hashes"`
+	Platforms []*ProviderPlatformHashes `json:"platforms"`
+}
+
+type ProviderPlatformHashes struct {
+	OS       string   `json:"os"`
+	Arch     string   `json:"arch"`
+	Filename string   `json:"filename"`
+	Hashes   []string `json:"hashes"`
+
+	url string
+}
+
+// MirrorIndexResponse is the provider network mirror index.json.
+type MirrorIndexResponse struct {
+	Versions map[string]struct{} `json:"versions"`
+}
+
+// MirrorVersionResponse is the provider network mirror <version>.json.
+type MirrorVersionResponse struct {
+	Archives map[string]MirrorArchive `json:"archives"`
+}
+
+type MirrorArchive struct {
+	URL    string   `json:"url"`
+	Hashes []string `json:"hashes"`
+}
+
+func (reg *Registry) ProviderHashes(w http.ResponseWriter, r *http.Request) {
+	reg.logger.DebugContext(r.Context(), "ProviderHashes", "headers", r.Header)
+
+	var (
+		namespace = r.PathValue("namespace")
+		name      = r.PathValue("name")
+		version   = r.PathValue("version")
+	)
+	ctx := logging.WithLogger(r.Context(), reg.logger)
+
+	platforms, err := reg.versionHashes(ctx, namespace, name, version)
+	if err != nil {
+		http.Error(w, http.StatusText(http.StatusNotFound), http.StatusNotFound)
+		reg.logger.ErrorContext(ctx, "ProviderHashes", "error", err)
+		return
+	}
+
+	resp := ProviderHashesResponse{Version: version, Hashes: []string{}, Platforms: platforms}
+	for _, p := range platforms {
+		resp.Hashes = append(resp.Hashes, p.Hashes...)
+	}
+	slices.Sort(resp.Hashes)
+	resp.Hashes = slices.Compact(resp.Hashes)
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(resp); err != nil {
+		reg.logger.ErrorContext(ctx, "ProviderHashes", "error", err)
+	}
+}
+
+// ProviderMirror implements the provider network mirror protocol, so the
+// registry can be used as a network_mirror in the CLI configuration. The
+// origin hostname in the path is ignored.
+func (reg *Registry) ProviderMirror(w http.ResponseWriter, r *http.Request) {
+	reg.logger.DebugContext(r.Context(), "ProviderMirror", "headers", r.Header)
+
+	var (
+		namespace = r.PathValue("namespace")
+		name      = r.PathValue("type")
+		file      = r.PathValue("file")
+	)
+	ctx := logging.WithLogger(r.Context(), reg.logger)
+
+	version, ok := strings.CutSuffix(file, ".json")
+	if !ok {
+		http.Error(w, http.StatusText(http.StatusNotFound), http.StatusNotFound)
+		return
+	}
+
+	var resp any
+	if version == "index" {
+		vs, err := reg.ps.ListProviderVersions(ctx, namespace, name)
+		if err != nil {
+			http.Error(w, http.StatusText(http.StatusNotFound), http.StatusNotFound)
+			reg.logger.ErrorContext(ctx, "ListProviderVersions", "error", err)
+			return
+		}
+		index := MirrorIndexResponse{Versions: make(map[string]struct{}, len(vs.Versions))}
+		for _, v := range vs.Versions {
+			index.Versions[v.Version] = struct{}{}
+		}
+		resp = index
+	} else {
+		platforms, err := reg.versionHashes(ctx, namespace, name, version)
+		if err != nil {
+			http.Error(w, http.StatusText(http.StatusNotFound), http.StatusNotFound)
+			reg.logger.ErrorContext(ctx, "ProviderMirror", "error", err)
+			return
+		}
+		archives := MirrorVersionResponse{Archives: make(map[string]MirrorArchive, len(platforms))}
+		for _, p := range platforms {
+			archives.Archives[p.OS+"_"+p.Arch] = MirrorArchive{URL: p.url, Hashes: p.Hashes}
+		}
+		resp = archives
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(resp); err != nil {
+		reg.logger.ErrorContext(ctx, "ProviderMirror", "error", err)
+	}
+}
+
+// maxHashConcurrency bounds the platforms resolved at once by versionHashes,
+// as each may hash a full package.
+const maxHashConcurrency = 4
+
+// versionHashes returns the hashes of every platform package of the version,
+// resolving platforms concurrently.
+func (reg *Registry) versionHashes(ctx context.Context, namespace, name, version string) ([]*ProviderPlatformHashes, error) {
+	vs, err := reg.ps.ListProviderVersions(ctx, namespace, name)
+	if err != nil {
+		return nil, err
+	}
+	i := slices.IndexFunc(vs.Versions, func(v model.ProviderVersion) bool { return v.Version == version })
+	if i < 0 {
+		return nil, fmt.Errorf("version %q of %s/%s not found", version, namespace, name)
+	}
+	platforms := vs.Versions[i].Platforms
+
+	g, gctx := errgroup.WithContext(ctx)
+	g.SetLimit(maxHashConcurrency)
+	hashes := make([]*ProviderPlatformHashes, len(platforms))
+	for i, pl := range platforms {
+		g.Go(func() error {
+			h, err := reg.platformHashes(gctx, namespace, name, version, pl)
+			hashes[i] = h
+			return err
+		})
+	}
+	if err := g.Wait(); err != nil {
+		return nil, err
+	}
+
+	slices.SortFunc(hashes, func(a, b *ProviderPlatformHashes) int {
+		return strings.Compare(a.OS+"_"+a.Arch, b.OS+"_"+b.Arch)
+	})
+	return hashes, nil
+}
+
+// platformHashes returns the "h1:" hash, if the store can compute it, and the
+// "zh:" hash (the SHA256 of the zip) of a platform package.
+func (reg *Registry) platformHashes(ctx context.Context, namespace, name, version string, pl model.Platform) (*ProviderPlatformHashes, error) {
+	p, err := reg.ps.GetProviderVersion(ctx, namespace, name, version, pl.OS, pl.Arch)
+	if err != nil {
+		return nil, err
+	}
+	ph := &ProviderPlatformHashes{OS: pl.OS, Arch: pl.Arch, Filename: p.Filename, url: p.DownloadURL}
+
+	key := strings.Join([]string{namespace, name, version, pl.OS, pl.Arch}, "/")
+	if h, ok := reg.packageHashes.Load(key); ok {
+		ph.Hashes = append(ph.Hashes, h.(string))
+	} else if hasher, ok := reg.ps.(model.ProviderHasher); ok {
+		h, err := hasher.ProviderPackageHash(ctx, namespace, name, version, pl.OS, pl.Arch)
+		switch {
+		case err == nil:
+			reg.packageHashes.Store(key, h)
+			ph.Hashes = append(ph.Hashes, h)
+		case !errors.Is(err, errors.ErrUnsupported):
+			return nil, fmt.Errorf("failed to hash %s: %w", p.Filename, err)
+		}
+	}
+	ph.Hashes = append(ph.Hashes, "zh:"+p.SHASum)
+	return ph, nil
+}
@@ -0,0 +1,25 @@
+package server
+
+import "context"
+
+// Principal identifies the authenticated caller of a request.
+type Principal struct {
+	// Name is the identity, e.g. a SPIFFE ID, email or host name.
+	Name string
+	// Source is how the principal was authenticated, e.g. "mtls".
+	Source string
+}
+
+type principalKey struct{}
+
+// WithPrincipal returns a context carrying the principal.
+func WithPrincipal(ctx context.Context, p *Principal) context.Context {
+	return context.WithValue(ctx, principalKey{}, p)
+}
+
+// PrincipalFromContext returns the authenticated principal of the request, or
+// nil for anonymous requests.
+func PrincipalFromContext(ctx context.Context) *Principal {
+	p, _ := ctx.Value(principalKey{}).(*Principal)
+	return p
+}
@@ -0,0 +1,211 @@
+package server
+
+import (
+	"expvar"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+const (
+	// limiterIdleTTL is how long an unused per-key limiter is kept.
+	limiterIdleTTL = 10 * time.Minute
+	// limiterSweepInterval is how often idle limiters are evicted.
+	limiterSweepInterval = time.Minute
+)
+
+// limiterMetrics are exposed on /debug/vars.
+var limiterMetrics = expvar.NewMap("ratelimit")
+
+type RateLimitConfig struct {
+	// ClientRPS and ClientBurst limit each principal, or client IP for
+	// anonymous requests. Zero disables the limit.
+	ClientRPS   float64
+	ClientBurst int
+	// NamespaceRPS and NamespaceBurst limit each namespace across all clients.
+	// Zero disables the limit.
+	NamespaceRPS   float64
+	NamespaceBurst int
+	// MaxAssetStreams caps the number of concurrent asset downloads. Zero
+	// disables the cap.
+	MaxAssetStreams int
+	// TrustForwardedFor identifies anonymous clients by the last
+	// X-Forwarded-For address, the one appended by the proxy, instead of the
+	// peer address. Only enable it behind a single proxy that appends to the
+	// header; earlier entries are set by the client.
+	TrustForwardedFor bool
+}
+
+// keyedLimiter holds one token bucket per key.
+type keyedLimiter struct {
+	limit rate.Limit
+	burst int
+
+	mu       sync.Mutex
+	buckets  map[string]*bucket
+	sweptAt  time.Time
+	disabled bool
+}
+
+type bucket struct {
+	lim      *rate.Limiter
+	lastSeen time.Time
+}
+
+func newKeyedLimiter(rps float64, burst int) *keyedLimiter {
+	if burst <= 0 {
+		burst = int(math.Max(1, math.Ceil(rps)))
+	}
+	return &keyedLimiter{
+		limit:    rate.Limit(rps),
+		burst:    burst,
+		buckets:  make(map[string]*bucket),
+		disabled: rps <= 0,
+	}
+}
+
+// reserve takes a token for the key. If none is available it returns how long
+// the caller should wait before retrying. The reservation is nil if the limit
+// is disabled; otherwise it can be canceled to return the token.
+func (kl *keyedLimiter) reserve(key string, now time.Time) (*rate.Reservation, time.Duration) {
+	if kl.disabled {
+		return nil, 0
+	}
+
+	kl.mu.Lock()
+	if now.Sub(kl.sweptAt) > limiterSweepInterval {
+		for k, b := range kl.buckets {
+			if now.Sub(b.lastSeen) > limiterIdleTTL {
+				delete(kl.buckets, k)
+			}
+		}
+		kl.sweptAt = now
+	}
+	b, ok := kl.buckets[key]
+	if !ok {
+		b = &bucket{lim: rate.NewLimiter(kl.limit, kl.burst)}
+		kl.buckets[key] = b
+	}
+	b.lastSeen = now
+	kl.mu.Unlock()
+
+	res := b.lim.ReserveN(now, 1)
+	if !res.OK() {
+		return nil, time.Second
+	}
+	if d := res.DelayFrom(now); d > 0 {
+		res.CancelAt(now)
+		return nil, d
+	}
+	return res, 0
+}
+
+type rateLimiter struct {
+	cfg     RateLimitConfig
+	clients *keyedLimiter
+	ns      *keyedLimiter
+	streams chan struct{}
+}
+
+func newRateLimiter(cfg *RateLimitConfig) *rateLimiter {
+	if cfg == nil {
+		cfg = &RateLimitConfig{}
+	}
+	rl := &rateLimiter{
+		cfg:     *cfg,
+		clients: newKeyedLimiter(cfg.ClientRPS, cfg.ClientBurst),
+		ns:      newKeyedLimiter(cfg.NamespaceRPS, cfg.NamespaceBurst),
+	}
+	if cfg.MaxAssetStreams > 0 {
+		rl.streams = make(chan struct{}, cfg.MaxAssetStreams)
+	}
+	return rl
+}
+
+// limit applies the client and namespace rate limits to a route handler. A
+// request rejected by the namespace limit doesn't use up a client token.
+func (rl *rateLimiter) limit(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		now := time.Now()
+		client, wait := rl.clients.reserve(rl.clientKey(r), now)
+		if wait > 0 {
+			limiterMetrics.Add("rejected_client", 1)
+			tooManyRequests(w, wait)
+			return
+		}
+		if ns := r.PathValue("namespace"); ns != "" {
+			if _, wait := rl.ns.reserve(ns, now); wait > 0 {
+				if client != nil {
+					client.CancelAt(now)
+				}
+				limiterMetrics.Add("rejected_namespace", 1)
+				tooManyRequests(w, wait)
+				return
+			}
+		}
+		limiterMetrics.Add("allowed", 1)
+		next(w, r)
+	}
+}
+
+// stream caps the number of concurrent asset downloads.
+func (rl *rateLimiter) stream(next http.HandlerFunc) http.HandlerFunc {
+	if rl.streams == nil {
+		return next
+	}
+	return func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case rl.streams <- struct{}{}:
+		default:
+			limiterMetrics.Add("rejected_streams", 1)
+			tooManyRequests(w, time.Second)
+			return
+		}
+		limiterMetrics.Add("active_streams", 1)
+		defer func() {
+			limiterMetrics.Add("active_streams", -1)
+			<-rl.streams
+		}()
+		next(w, r)
+	}
+}
+
+func (rl *rateLimiter) clientKey(r *http.Request) string {
+	if p := PrincipalFromContext(r.Context()); p != nil {
+		return "principal:" + p.Name
+	}
+	return "ip:" + clientIP(r, rl.cfg.TrustForwardedFor)
+}
+
+// clientIP returns the address of the client, optionally taken from the last
+// X-Forwarded-For entry. Only the last one is appended by the trusted proxy;
+// the client controls the others.
+func clientIP(r *http.Request, trustForwardedFor bool) string {
+	if trustForwardedFor {
+		if xff := r.Header.Values("X-Forwarded-For"); len(xff) > 0 {
+			last := xff[len(xff)-1]
+			if i := strings.LastIndex(last, ","); i >= 0 {
+				last = last[i+1:]
+			}
+			if ip := strings.TrimSpace(last); ip != "" {
+				return ip
+			}
+		}
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+func tooManyRequests(w http.ResponseWriter, wait time.Duration) {
+	w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+	http.Error(w, http.StatusText(http.StatusTooManyRequests), http.StatusTooManyRequests)
+}
@@ -0,0 +1,68 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestClientIP(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		name    string
+		xff     []string
+		trusted bool
+		want    string
+	}{
+		{name: "peer", want: "192.0.2.1"},
+		{name: "untrusted header", xff: []string{"203.0.113.9"}, want: "192.0.2.1"},
+		{name: "single entry", xff: []string{"203.0.113.9"}, trusted: true, want: "203.0.113.9"},
+		{name: "multiple entries", xff: []string{"198.51.100.7, 203.0.113.9"}, trusted: true, want: "203.0.113.9"},
+		{name: "multiple headers", xff: []string{"198.51.100.7", "203.0.113.9"}, trusted: true, want: "203.0.113.9"},
+		// The client sent a forged entry; the proxy appended the real address.
+		{name: "spoofed entry", xff: []string{"10.0.0.1,198.51.100.1, 203.0.113.9"}, trusted: true, want: "203.0.113.9"},
+		{name: "empty entry", xff: []string{"203.0.113.9, "}, trusted: true, want: "192.0.2.1"},
+	}
+	for _, tc := range cases {
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		r.RemoteAddr = "192.0.2.1:1234"
+		for _, v := range tc.xff {
+			r.Header.Add("X-Forwarded-For", v)
+		}
+		if got := clientIP(r, tc.trusted); got != tc.want {
+			t.Errorf("%s: got %q, want %q", tc.name, got, tc.want)
+		}
+	}
+}
+
+func TestRateLimiterNamespaceRejectionKeepsClientToken(t *testing.T) {
+	t.Parallel()
+
+	rl := newRateLimiter(&RateLimitConfig{ClientRPS: 0.001, ClientBurst: 1, NamespaceRPS: 0.001, NamespaceBurst: 1})
+	mux := http.NewServeMux()
+	mux.HandleFunc("/v1/{namespace}", rl.limit(func(w http.ResponseWriter, r *http.Request) {}))
+
+	get := func(ns, ip string) int {
+		r := httptest.NewRequest(http.MethodGet, "/v1/"+ns, nil)
+		r.RemoteAddr = ip + ":1234"
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, r)
+		return w.Code
+	}
+
+	// a spends the namespace token of busy.
+	if got := get("busy", "192.0.2.1"); got != http.StatusOK {
+		t.Fatalf("first request: got %d, want 200", got)
+	}
+	// b is rejected by the namespace limit, which must not spend its token.
+	if got := get("busy", "192.0.2.2"); got != http.StatusTooManyRequests {
+		t.Fatalf("namespace limited request: got %d, want 429", got)
+	}
+	if got := get("idle", "192.0.2.2"); got != http.StatusOK {
+		t.Errorf("request to another namespace: got %d, want 200", got)
+	}
+	if got := get("idle", "192.0.2.2"); got != http.StatusTooManyRequests {
+		t.Errorf("client over its limit: got %d, want 429", got)
+	}
+}
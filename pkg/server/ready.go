@@ -0,0 +1,146 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/yolocs/ar-terraform-registry/pkg/model"
+)
+
+const (
+	defaultReadyTimeout  = 5 * time.Second
+	defaultReadyCacheTTL = 10 * time.Second
+)
+
+type ReadyResponse struct {
+	Status string                        `json:"status"`
+	Checks map[string]ReadyResponseCheck `json:"checks"`
+}
+
+type ReadyResponseCheck struct {
+	Status    string `json:"status"`
+	Error     string `json:"error,omitempty"`
+	LatencyMS int64  `json:"latency_ms"`
+}
+
+// readiness runs the configured health checks and caches the result so that
+// frequent load balancer probes don't translate into backend calls.
+type readiness struct {
+	timeout time.Duration
+	ttl     time.Duration
+
+	mu        sync.Mutex
+	checkedAt time.Time
+	last      *ReadyResponse
+}
+
+func (rd *readiness) check(ctx context.Context, checkers map[string]healthCheckFunc) *ReadyResponse {
+	rd.mu.Lock()
+	defer rd.mu.Unlock()
+
+	if rd.last != nil && time.Since(rd.checkedAt) < rd.ttl {
+		return rd.last
+	}
+
+	// Detach from the request so a client hanging up doesn't poison the cache.
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), rd.timeout)
+	defer cancel()
+
+	resp := &ReadyResponse{
+		Status: "OK",
+		Checks: make(map[string]ReadyResponseCheck, len(checkers)),
+	}
+
+	var (
+		wg    sync.WaitGroup
+		resMu sync.Mutex
+	)
+	for name, fn := range checkers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			start := time.Now()
+			err := fn(ctx)
+			c := ReadyResponseCheck{
+				Status:    "OK",
+				LatencyMS: time.Since(start).Milliseconds(),
+			}
+			if err != nil {
+				c.Status = "FAILED"
+				c.Error = err.Error()
+			}
+
+			resMu.Lock()
+			defer resMu.Unlock()
+			resp.Checks[name] = c
+			if err != nil {
+				resp.Status = "FAILED"
+			}
+		}()
+	}
+	wg.Wait()
+
+	rd.last = resp
+	rd.checkedAt = time.Now()
+	return resp
+}
+
+type healthCheckFunc func(ctx context.Context) error
+
+func (reg *Registry) healthChecks() map[string]healthCheckFunc {
+	checkers := *reg.checkers.Load()
+	checks := make(map[string]healthCheckFunc, len(checkers))
+	for name, c := range checkers {
+		checks[name] = c.CheckHealth
+	}
+	return checks
+}
+
+// SetHealthCheckers replaces the dependencies probed by the readiness
+// endpoint, e.g. after the backends were reloaded. The cached result is
+// dropped.
+func (reg *Registry) SetHealthCheckers(checkers map[string]model.HealthChecker) {
+	reg.checkers.Store(&checkers)
+
+	reg.ready.mu.Lock()
+	defer reg.ready.mu.Unlock()
+	reg.ready.last = nil
+}
+
+func (reg *Registry) Ready(w http.ResponseWriter, r *http.Request) {
+	var resp *ReadyResponse
+	if reg.draining.Load() {
+		// Shutting down, no need to probe the backends.
+		resp = &ReadyResponse{Status: "DRAINING", Checks: map[string]ReadyResponseCheck{}}
+	} else {
+		resp = reg.ready.check(r.Context(), reg.healthChecks())
+	}
+
+	code := http.StatusOK
+	if resp.Status == "DRAINING" {
+		code = http.StatusServiceUnavailable
+	} else if resp.Status != "OK" {
+		code = http.StatusServiceUnavailable
+
+		failed := make([]string, 0, len(resp.Checks))
+		for name, c := range resp.Checks {
+			if c.Status != "OK" {
+				failed = append(failed, name)
+			}
+		}
+		sort.Strings(failed)
+		reg.logger.WarnContext(r.Context(), "Ready", "failed", failed)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(code)
+	if err := json.NewEncoder(w).Encode(resp); err != nil {
+		reg.logger.ErrorContext(r.Context(), "Ready", "error", err)
+	}
+}
@@ -2,15 +2,26 @@ package server
 
 import (
 	"context"
+	"crypto/tls"
 	"encoding/json"
+	"errors"
+	"expvar"
 	"fmt"
-	"io"
 	"log/slog"
+	"net"
 	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/abcxyz/pkg/logging"
-	"github.com/abcxyz/pkg/serving"
+	"golang.org/x/sync/singleflight"
+
+	"github.com/yolocs/ar-terraform-registry/pkg/audit"
 	"github.com/yolocs/ar-terraform-registry/pkg/model"
+	"github.com/yolocs/ar-terraform-registry/pkg/notify"
+	"github.com/yolocs/ar-terraform-registry/pkg/stats"
 )
 
 type Config struct {
@@ -18,6 +29,47 @@ type Config struct {
 	Providers model.ProviderStore
 	Modules   model.ModuleStore
 	Logger    *slog.Logger
+
+	// HealthCheckers are the dependencies probed by the readiness endpoint,
+	// keyed by the name reported in the response.
+	HealthCheckers map[string]model.HealthChecker
+	// ReadyTimeout bounds how long all readiness probes may take.
+	ReadyTimeout time.Duration
+	// ReadyCacheTTL is how long a readiness result is reused.
+	ReadyCacheTTL time.Duration
+
+	// TLS enables serving HTTPS directly. Terraform requires HTTPS for
+	// registry hosts, so without it the server must sit behind a TLS
+	// terminating proxy.
+	TLS *TLSConfig
+
+	// RateLimit configures per-client and per-namespace rate limits and the
+	// cap on concurrent asset downloads. Nil disables all limits.
+	RateLimit *RateLimitConfig
+
+	// Admin enables the admin API. Nil disables it.
+	Admin *AdminConfig
+
+	// Audit receives events for downloads and admin API calls. Nil disables
+	// auditing.
+	Audit *audit.Logger
+
+	// Stats counts downloads and enables the downloads summary and report.
+	// Nil disables them.
+	Stats *stats.Store
+
+	// Webhooks lists its recent deliveries in the admin API. Nil disables
+	// the listing.
+	Webhooks *notify.Notifier
+
+	// DrainDelay is how long the server keeps accepting requests while
+	// reporting not-ready after shutdown begins, so load balancers stop
+	// routing to it first.
+	DrainDelay time.Duration
+	// DrainTimeout bounds how long in-flight requests, such as asset
+	// downloads, may take to complete once the server stops accepting
+	// connections. Defaults to 30s.
+	DrainTimeout time.Duration
 }
 
 type Registry struct {
@@ -26,6 +78,25 @@ type Registry struct {
 	ps     model.ProviderStore
 	ms     model.ModuleStore
 	logger *slog.Logger
+	ready  *readiness
+	limits *rateLimiter
+	audit  *audit.Logger
+
+	checkers atomic.Pointer[map[string]model.HealthChecker]
+	// admin holds the admin API credentials, which can be replaced at
+	// runtime.
+	admin atomic.Pointer[AdminConfig]
+	// packageHashes caches "h1:" hashes by platform package; published
+	// packages never change.
+	packageHashes sync.Map
+	// moduleMetadataCache caches module metadata, or the failure to load it,
+	// by version.
+	moduleMetadataCache sync.Map
+	moduleMetadataCalls singleflight.Group
+
+	// draining is set once shutdown begins.
+	draining atomic.Bool
+	streams  streamTracker
 }
 
 func New(cfg *Config) (*Registry, error) {
@@ -35,37 +106,101 @@ func New(cfg *Config) (*Registry, error) {
 		ms:     cfg.Modules,
 		logger: cfg.Logger,
 		mux:    http.NewServeMux(),
+		limits: newRateLimiter(cfg.RateLimit),
+		audit:  cfg.Audit,
+		ready: &readiness{
+			timeout: cfg.ReadyTimeout,
+			ttl:     cfg.ReadyCacheTTL,
+		},
+	}
+	reg.checkers.Store(&cfg.HealthCheckers)
+	reg.admin.Store(cfg.Admin)
+	if reg.ready.timeout <= 0 {
+		reg.ready.timeout = defaultReadyTimeout
+	}
+	if reg.ready.ttl <= 0 {
+		reg.ready.ttl = defaultReadyCacheTTL
 	}
 	reg.setupRoutes()
 	return reg, nil
 }
 
-// Start starsts the reigstry server. This will be a block call.
+// Start starsts the reigstry server. This will be a block call. When ctx is
+// done, the server drains, see drain.
 func (reg *Registry) Start(ctx context.Context) error {
-	server, err := serving.New(reg.cfg.Port)
+	listener, err := reg.newListener()
 	if err != nil {
 		return fmt.Errorf("failed to create serving infrastructure: %w", err)
 	}
 
-	if err := server.StartHTTPHandler(ctx, reg.mux); err != nil {
-		return fmt.Errorf("failed to start HTTP handler: %w", err)
+	srv := &http.Server{
+		// Allow custom responses to OPTIONS.
+		DisableGeneralOptionsHandler: true,
+
+		ReadTimeout:       30 * time.Second,
+		ReadHeaderTimeout: 5 * time.Second,
+		WriteTimeout:      30 * time.Second,
+
+		Handler: reg.Handler(),
+	}
+
+	errCh := make(chan error, 1)
+	go func() {
+		reg.logger.InfoContext(ctx, "server is starting", "addr", listener.Addr().String())
+		errCh <- srv.Serve(listener)
+	}()
+
+	select {
+	case err := <-errCh:
+		return fmt.Errorf("failed to serve: %w", err)
+	case <-ctx.Done():
 	}
 
+	if err := reg.drain(ctx, srv); err != nil {
+		return err
+	}
+	if err := <-errCh; err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return fmt.Errorf("failed to serve: %w", err)
+	}
+	reg.logger.InfoContext(ctx, "server is stopped")
 	return nil
 }
 
-// Route handlers
-func (reg *Registry) Index(w http.ResponseWriter, r *http.Request) {
-	if _, err := w.Write([]byte("Terraform Registry based on GCP Artifact Registry\n")); err != nil {
-		reg.logger.ErrorContext(r.Context(), "Index", "error", err)
+func (reg *Registry) newListener() (net.Listener, error) {
+	listener, err := net.Listen("tcp", ":"+reg.cfg.Port)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create listener on :%s: %w", reg.cfg.Port, err)
+	}
+	if reg.cfg.TLS == nil {
+		return listener, nil
 	}
+
+	tlsConfig, err := newTLSConfig(reg.cfg.TLS)
+	if err != nil {
+		listener.Close()
+		return nil, err
+	}
+	return tls.NewListener(listener, tlsConfig), nil
+}
+
+// Handler returns the routes wrapped with the middlewares, for serving the
+// registry in process.
+func (reg *Registry) Handler() http.Handler {
+	return withClientCertPrincipal(reg.mux)
 }
 
+// Route handlers
+
 type HealthResponse struct {
 	Status string `json:"status"`
 }
 
 func (reg *Registry) Health(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Query().Has("deep") {
+		reg.Ready(w, r)
+		return
+	}
+
 	resp := HealthResponse{
 		Status: "OK",
 	}
@@ -164,10 +299,89 @@ func (reg *Registry) ModuleDownload(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	w.Header().Set("X-Terraform-Get", v.SourceURL)
+	w.Header().Set("X-Terraform-Get", withSubdir(v.SourceURL, v.Subdir))
 	w.WriteHeader(http.StatusNoContent)
 }
 
+// withSubdir appends the subdirectory to the source URL in go-getter syntax,
+// i.e. "<url>//<subdir>?<query>".
+func withSubdir(sourceURL, subdir string) string {
+	subdir = strings.Trim(subdir, "/")
+	if subdir == "" {
+		return sourceURL
+	}
+	base, query, found := strings.Cut(sourceURL, "?")
+	if !found {
+		return base + "//" + subdir
+	}
+	return base + "//" + subdir + "?" + query
+}
+
+// moduleArchiveFormats maps the archive hint go-getter understands to the file
+// suffix and content type of the stored archive.
+var moduleArchiveFormats = map[string]struct {
+	suffix      string
+	contentType string
+}{
+	"tar.gz": {suffix: ".tar.gz", contentType: "application/gzip"},
+	"tgz":    {suffix: ".tgz", contentType: "application/gzip"},
+	"zip":    {suffix: ".zip", contentType: "application/zip"},
+}
+
+func (reg *Registry) ModuleArchiveDownload(w http.ResponseWriter, r *http.Request) {
+	reg.logger.DebugContext(r.Context(), "ModuleArchiveDownload", "headers", r.Header)
+
+	var (
+		namespace = r.PathValue("namespace")
+		assetName = r.PathValue("assetName")
+		hint      = r.URL.Query().Get("archive")
+	)
+	ctx := logging.WithLogger(r.Context(), reg.logger)
+
+	format := ""
+	for f, v := range moduleArchiveFormats {
+		if strings.HasSuffix(assetName, v.suffix) {
+			format = f
+			break
+		}
+	}
+	if format == "" {
+		http.Error(w, http.StatusText(http.StatusNotFound), http.StatusNotFound)
+		reg.logger.ErrorContext(ctx, "ModuleArchiveDownload", "error", fmt.Errorf("%q is not a module archive", assetName))
+		return
+	}
+	if hint != "" && hint != format {
+		http.Error(w, fmt.Sprintf("archive %q is not of type %q", assetName, hint), http.StatusBadRequest)
+		return
+	}
+
+	contentType := moduleArchiveFormats[format].contentType
+	if opener, ok := reg.ms.(model.ModuleArchiveOpener); ok {
+		asset, err := opener.OpenModuleArchive(ctx, namespace, assetName)
+		switch {
+		case err == nil:
+			defer asset.Close()
+			serveAsset(ctx, reg.logger, w, r, asset, assetName, contentType)
+			return
+		case !errors.Is(err, errors.ErrUnsupported):
+			http.Error(w, http.StatusText(http.StatusNotFound), http.StatusNotFound)
+			reg.logger.ErrorContext(ctx, "OpenModuleArchive", "error", err)
+			return
+		}
+		// Fall through to streaming the archive.
+	}
+
+	fr, err := reg.ms.GetModuleArchive(ctx, namespace, assetName)
+	if err != nil {
+		http.Error(w, http.StatusText(http.StatusNotFound), http.StatusNotFound)
+		reg.logger.ErrorContext(ctx, "GetModuleArchive", "error", err)
+		return
+	}
+	defer fr.Close()
+
+	streamAsset(ctx, reg.logger, w, r, fr, assetName, contentType)
+}
+
 func (reg *Registry) ProviderVersions(w http.ResponseWriter, r *http.Request) {
 	reg.logger.DebugContext(r.Context(), "ProviderVersions", "headers", r.Header)
 
@@ -228,6 +442,22 @@ func (reg *Registry) ProviderAssetDownload(w http.ResponseWriter, r *http.Reques
 	)
 	ctx := logging.WithLogger(r.Context(), reg.logger)
 
+	contentType := providerAssetContentType(assetName)
+	if opener, ok := reg.ps.(model.ProviderAssetOpener); ok {
+		asset, err := opener.OpenProviderAsset(ctx, namespace, assetName)
+		switch {
+		case err == nil:
+			defer asset.Close()
+			serveAsset(ctx, reg.logger, w, r, asset, assetName, contentType)
+			return
+		case !errors.Is(err, errors.ErrUnsupported):
+			http.Error(w, http.StatusText(http.StatusNotFound), http.StatusNotFound)
+			reg.logger.ErrorContext(ctx, "OpenProviderAsset", "error", err)
+			return
+		}
+		// Fall through to streaming the asset.
+	}
+
 	fr, err := reg.ps.GetProviderAsset(ctx, namespace, assetName)
 	if err != nil {
 		http.Error(w, http.StatusText(http.StatusNotFound), http.StatusNotFound)
@@ -236,24 +466,71 @@ func (reg *Registry) ProviderAssetDownload(w http.ResponseWriter, r *http.Reques
 	}
 	defer fr.Close()
 
-	written, err := io.Copy(w, fr)
-	if err != nil {
-		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
-		reg.logger.ErrorContext(ctx, "Copy asset", "error", err)
-		return
-	}
-
-	reg.logger.DebugContext(ctx, "ProviderAssetDownload", "written", written)
+	streamAsset(ctx, reg.logger, w, r, fr, assetName, contentType)
 }
 
 func (reg *Registry) setupRoutes() {
-	reg.mux.HandleFunc("/", reg.Index)
+	limit, audited, counted := reg.limits.limit, reg.audited, reg.counted
+	stream := func(next http.HandlerFunc) http.HandlerFunc {
+		return reg.limits.stream(reg.tracked(next))
+	}
+
+	reg.mux.HandleFunc("/", limit(reg.Index))
+	reg.mux.Handle("/static/", uiStaticHandler())
+	reg.mux.HandleFunc("/ui/{namespace}", limit(reg.UINamespace))
+	reg.mux.HandleFunc("/ui/{namespace}/providers/{name}", limit(reg.UIProvider))
+	reg.mux.HandleFunc("/ui/{namespace}/providers/{name}/{version}", limit(reg.UIProvider))
+	reg.mux.HandleFunc("/ui/{namespace}/modules/{name}/{system}", limit(reg.UIModule))
+	reg.mux.HandleFunc("/ui/{namespace}/modules/{name}/{system}/{version}", limit(reg.UIModule))
 	reg.mux.HandleFunc("/health", reg.Health)
-	reg.mux.HandleFunc("/.well-known/{name}", reg.ServiceDiscovery)
-	reg.mux.HandleFunc("/v1/modules/{namespace}/{name}/{system}/versions", reg.ModuleVersions)
-	reg.mux.HandleFunc("/v1/modules/{namespace}/{name}/{system}/{version}/download", reg.ModuleDownload)
-	reg.mux.HandleFunc("/download/module/{namespace}/asset/{assetName}", reg.ProviderAssetDownload)
-	reg.mux.HandleFunc("/v1/providers/{namespace}/{name}/versions", reg.ProviderVersions)
-	reg.mux.HandleFunc("/v1/providers/{namespace}/{name}/{version}/download/{os}/{arch}", reg.ProviderDownload)
-	reg.mux.HandleFunc("/download/provider/{namespace}/asset/{assetName}", reg.ProviderAssetDownload)
+	reg.mux.HandleFunc("/ready", reg.Ready)
+	reg.mux.HandleFunc("/.well-known/{name}", limit(reg.ServiceDiscovery))
+	reg.mux.HandleFunc("/v1/modules/{namespace}/{name}/{system}/versions", limit(reg.ModuleVersions))
+	reg.mux.HandleFunc("/v1/modules/{namespace}/{name}/{system}/{version}", limit(reg.ModuleDetails))
+	reg.mux.HandleFunc("/v1/modules/{namespace}/{name}/{system}/{version}/download", limit(audited(audit.ActionModuleDownload, counted(model.KindModule, reg.ModuleDownload))))
+	reg.mux.HandleFunc("/download/module/{namespace}/archive/{assetName}", limit(audited(audit.ActionModuleArchiveDownload, stream(reg.ModuleArchiveDownload))))
+	// Kept for clients holding X-Terraform-Get values from older releases.
+	reg.mux.HandleFunc("/download/module/{namespace}/asset/{assetName}", limit(audited(audit.ActionModuleArchiveDownload, stream(reg.ModuleArchiveDownload))))
+	reg.mux.HandleFunc("/v1/providers/{namespace}/{name}/versions", limit(reg.ProviderVersions))
+	reg.mux.HandleFunc("/v1/providers/{namespace}/{name}/{version}/download/{os}/{arch}", limit(audited(audit.ActionProviderDownload, counted(model.KindProvider, reg.ProviderDownload))))
+	reg.mux.HandleFunc("/v1/providers/{namespace}/{name}/{version}/hashes", limit(reg.ProviderHashes))
+	reg.mux.HandleFunc("/v1/mirror/{hostname}/{namespace}/{type}/{file}", limit(reg.ProviderMirror))
+	reg.mux.HandleFunc("/download/provider/{namespace}/asset/{assetName}", limit(audited(audit.ActionProviderAssetDownload, stream(reg.ProviderAssetDownload))))
+	if reg.cfg.Stats != nil {
+		reg.mux.HandleFunc("/v1/modules/{namespace}/{name}/{system}/downloads/summary", limit(reg.ModuleDownloadsSummary))
+	}
+
+	if reg.cfg.Admin != nil {
+		reg.setupAdminRoutes()
+	}
+}
+
+func (reg *Registry) setupAdminRoutes() {
+	// Denied requests are audited too.
+	auth := func(action string, next http.HandlerFunc) http.HandlerFunc {
+		return reg.audited(action, reg.adminAuth(next))
+	}
+
+	// Not audited, metrics are scraped often.
+	reg.mux.HandleFunc("GET /debug/vars", reg.adminAuth(expvar.Handler().ServeHTTP))
+	reg.mux.HandleFunc("GET /admin/v1/namespaces", auth(audit.ActionNamespaceList, reg.AdminListNamespaces))
+	reg.mux.HandleFunc("POST /admin/v1/namespaces", auth(audit.ActionNamespaceCreate, reg.AdminCreateNamespace))
+	reg.mux.HandleFunc("GET /admin/v1/namespaces/{namespace}/packages", auth(audit.ActionPackageList, reg.AdminListPackages))
+	for _, pkg := range []string{
+		"/admin/v1/namespaces/{namespace}/providers/{name}",
+		"/admin/v1/namespaces/{namespace}/modules/{name}/{system}",
+	} {
+		reg.mux.HandleFunc("DELETE "+pkg, auth(audit.ActionPackageDelete, reg.AdminDeletePackage))
+		reg.mux.HandleFunc("GET "+pkg+"/versions", auth(audit.ActionVersionList, reg.AdminListVersions))
+		reg.mux.HandleFunc("DELETE "+pkg+"/versions/{version}", auth(audit.ActionVersionDelete, reg.AdminDeleteVersion))
+		reg.mux.HandleFunc("GET "+pkg+"/versions/{version}/files", auth(audit.ActionVersionFiles, reg.AdminVersionFiles))
+		reg.mux.HandleFunc("POST "+pkg+"/versions/{version}/yank", auth(audit.ActionVersionYank, reg.AdminYank))
+		reg.mux.HandleFunc("POST "+pkg+"/versions/{version}/unyank", auth(audit.ActionVersionUnyank, reg.AdminUnyank))
+	}
+	if reg.cfg.Stats != nil {
+		reg.mux.HandleFunc("GET /admin/v1/reports/downloads", auth(audit.ActionReportDownloads, reg.AdminDownloadsReport))
+	}
+	if reg.cfg.Webhooks != nil {
+		reg.mux.HandleFunc("GET /admin/v1/webhooks/deliveries", auth(audit.ActionWebhookDeliveries, reg.AdminWebhookDeliveries))
+	}
 }
@@ -0,0 +1,232 @@
+package server
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/abcxyz/pkg/logging"
+
+	"github.com/yolocs/ar-terraform-registry/pkg/model"
+	"github.com/yolocs/ar-terraform-registry/pkg/stats"
+)
+
+const (
+	defaultReportDays  = 90
+	defaultReportLimit = 50
+)
+
+// counted records successful downloads in the stats store.
+func (reg *Registry) counted(kind string, next http.HandlerFunc) http.HandlerFunc {
+	if reg.cfg.Stats == nil {
+		return next
+	}
+	return func(w http.ResponseWriter, r *http.Request) {
+		rec := &statusRecorder{ResponseWriter: w}
+		next(rec, r)
+		if rec.status >= 400 {
+			return
+		}
+
+		d := &stats.Download{
+			Kind:      kind,
+			Namespace: r.PathValue("namespace"),
+			Name:      r.PathValue("name"),
+			System:    r.PathValue("system"),
+			Version:   r.PathValue("version"),
+			OS:        r.PathValue("os"),
+			Arch:      r.PathValue("arch"),
+		}
+		if p := PrincipalFromContext(r.Context()); p != nil {
+			d.Principal = p.Name
+		}
+		reg.cfg.Stats.Record(d)
+	}
+}
+
+type ModuleDownloadsSummaryResponse struct {
+	Data ModuleDownloadsSummaryData `json:"data"`
+}
+
+type ModuleDownloadsSummaryData struct {
+	Type       string         `json:"type"`
+	ID         string         `json:"id"`
+	Attributes *stats.Summary `json:"attributes"`
+}
+
+// ModuleDownloadsSummary counts the downloads of all versions of a module,
+// in the shape of the public registry's downloads summary.
+func (reg *Registry) ModuleDownloadsSummary(w http.ResponseWriter, r *http.Request) {
+	var (
+		namespace = r.PathValue("namespace")
+		name      = r.PathValue("name")
+		system    = r.PathValue("system")
+	)
+	ctx := logging.WithLogger(r.Context(), reg.logger)
+
+	sum, err := reg.cfg.Stats.Summary(ctx, &stats.Filter{
+		Kind:      model.KindModule,
+		Namespace: namespace,
+		Name:      name,
+		System:    system,
+	}, time.Now())
+	if err != nil {
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		reg.logger.ErrorContext(ctx, "Summary", "error", err)
+		return
+	}
+
+	resp := ModuleDownloadsSummaryResponse{Data: ModuleDownloadsSummaryData{
+		Type:       "module-downloads-summary",
+		ID:         strings.Join([]string{namespace, name, system}, "/"),
+		Attributes: sum,
+	}}
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(resp); err != nil {
+		reg.logger.ErrorContext(ctx, "ModuleDownloadsSummary", "error", err)
+	}
+}
+
+type AdminDownloadsReport struct {
+	Since    string               `json:"since"`
+	Order    string               `json:"order"`
+	Versions []*AdminVersionUsage `json:"versions"`
+}
+
+type AdminVersionUsage struct {
+	*stats.VersionStats
+	Yanked bool `json:"yanked,omitempty"`
+}
+
+// AdminDownloadsReport lists versions by their downloads over the last days,
+// least used first unless order=most. With a namespace, stored versions that
+// weren't downloaded are included.
+func (reg *Registry) AdminDownloadsReport(w http.ResponseWriter, r *http.Request) {
+	ctx := logging.WithLogger(r.Context(), reg.logger)
+	q := r.URL.Query()
+
+	f := &stats.Filter{
+		Kind:      q.Get("kind"),
+		Namespace: q.Get("namespace"),
+		Name:      q.Get("name"),
+		System:    q.Get("system"),
+	}
+	if f.Kind != "" && f.Kind != model.KindProvider && f.Kind != model.KindModule {
+		reg.adminJSON(ctx, w, http.StatusBadRequest, AdminErrorResponse{Error: fmt.Sprintf("invalid kind %q", f.Kind)})
+		return
+	}
+	days, err := queryInt(q.Get("days"), defaultReportDays)
+	if err != nil {
+		reg.adminJSON(ctx, w, http.StatusBadRequest, AdminErrorResponse{Error: fmt.Sprintf("invalid days: %v", err)})
+		return
+	}
+	limit, err := queryInt(q.Get("limit"), defaultReportLimit)
+	if err != nil {
+		reg.adminJSON(ctx, w, http.StatusBadRequest, AdminErrorResponse{Error: fmt.Sprintf("invalid limit: %v", err)})
+		return
+	}
+	order := cmp.Or(q.Get("order"), "least")
+	if order != "least" && order != "most" {
+		reg.adminJSON(ctx, w, http.StatusBadRequest, AdminErrorResponse{Error: fmt.Sprintf("invalid order %q", order)})
+		return
+	}
+	f.Since = time.Now().UTC().AddDate(0, 0, 1-days)
+
+	counted, err := reg.cfg.Stats.Versions(ctx, f)
+	if err != nil {
+		reg.adminError(ctx, w, "Versions", err)
+		return
+	}
+	usage := make(map[string]*AdminVersionUsage, len(counted))
+	for _, v := range counted {
+		usage[versionKey(v)] = &AdminVersionUsage{VersionStats: v}
+	}
+	if f.Namespace != "" && reg.cfg.Admin != nil {
+		if err := reg.addStoredVersions(ctx, f, usage); err != nil {
+			reg.adminError(ctx, w, "ListVersions", err)
+			return
+		}
+	}
+
+	versions := make([]*AdminVersionUsage, 0, len(usage))
+	for _, v := range usage {
+		versions = append(versions, v)
+	}
+	slices.SortFunc(versions, func(a, b *AdminVersionUsage) int {
+		c := cmp.Compare(a.Downloads, b.Downloads)
+		if order == "most" {
+			c = -c
+		}
+		return cmp.Or(c, cmp.Compare(a.LastDownload, b.LastDownload), strings.Compare(versionKey(a.VersionStats), versionKey(b.VersionStats)))
+	})
+	if len(versions) > limit {
+		versions = versions[:limit]
+	}
+
+	reg.adminJSON(ctx, w, http.StatusOK, AdminDownloadsReport{
+		Since:    f.Since.Format(time.DateOnly),
+		Order:    order,
+		Versions: versions,
+	})
+}
+
+// addStoredVersions adds the stored versions of the filtered packages that
+// have no downloads. Backends without admin support are skipped.
+func (reg *Registry) addStoredVersions(ctx context.Context, f *stats.Filter, usage map[string]*AdminVersionUsage) error {
+	refs, err := reg.cfg.Admin.Store.ListPackages(ctx, f.Namespace)
+	if err != nil {
+		if errors.Is(err, model.ErrNotFound) || errors.Is(err, errors.ErrUnsupported) {
+			return nil
+		}
+		return err
+	}
+	for _, ref := range refs {
+		if (f.Kind != "" && f.Kind != ref.Kind) || (f.Name != "" && f.Name != ref.Name) || (f.System != "" && f.System != ref.System) {
+			continue
+		}
+		versions, err := reg.cfg.Admin.Store.ListVersions(ctx, f.Namespace, ref)
+		if errors.Is(err, errors.ErrUnsupported) {
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("failed to list versions of %s: %w", ref.Name, err)
+		}
+		for _, v := range versions {
+			vs := &stats.VersionStats{Kind: ref.Kind, Namespace: f.Namespace, Name: ref.Name, System: ref.System, Version: v.Version}
+			u, ok := usage[versionKey(vs)]
+			if !ok {
+				vs.Principals = []*stats.PrincipalStats{}
+				u = &AdminVersionUsage{VersionStats: vs}
+				usage[versionKey(vs)] = u
+			}
+			u.Yanked = v.Yanked
+		}
+	}
+	return nil
+}
+
+func versionKey(v *stats.VersionStats) string {
+	return strings.Join([]string{v.Kind, v.Namespace, v.Name, v.System, v.Version}, "/")
+}
+
+// queryInt parses a positive integer query parameter.
+func queryInt(s string, def int) (int, error) {
+	if s == "" {
+		return def, nil
+	}
+	n, err := strconv.Atoi(s)
+	if err != nil {
+		return 0, err
+	}
+	if n <= 0 {
+		return 0, fmt.Errorf("must be positive, got %d", n)
+	}
+	return n, nil
+}
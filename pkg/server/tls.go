@@ -0,0 +1,152 @@
+package server
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+)
+
+// certCheckInterval bounds how often the TLS files are checked for rotation.
+const certCheckInterval = 10 * time.Second
+
+type TLSConfig struct {
+	CertFile string
+	KeyFile  string
+	// ClientCAFile is a PEM bundle of CAs that client certificates are verified
+	// against. Without it, client certificates are not requested.
+	ClientCAFile string
+	// RequireClientCert rejects connections without a valid client
+	// certificate. Otherwise clients may connect without one.
+	RequireClientCert bool
+}
+
+// tlsFiles serves the certificate, key and client CA bundle from disk and
+// reloads them when their modification times change, so rotated certificates
+// are picked up without a restart.
+type tlsFiles struct {
+	cfg *TLSConfig
+
+	mu        sync.Mutex
+	checkedAt time.Time
+	modTimes  [3]time.Time
+	cert      *tls.Certificate
+	clientCAs *x509.CertPool
+}
+
+func newTLSConfig(cfg *TLSConfig) (*tls.Config, error) {
+	f := &tlsFiles{cfg: cfg}
+	if err := f.load(); err != nil {
+		return nil, err
+	}
+
+	base := &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		NextProtos: []string{"h2", "http/1.1"},
+	}
+	if cfg.ClientCAFile != "" {
+		base.ClientAuth = tls.VerifyClientCertIfGiven
+		if cfg.RequireClientCert {
+			base.ClientAuth = tls.RequireAndVerifyClientCert
+		}
+	}
+
+	c := base.Clone()
+	c.GetConfigForClient = func(*tls.ClientHelloInfo) (*tls.Config, error) {
+		cert, clientCAs := f.get()
+		hc := base.Clone()
+		hc.Certificates = []tls.Certificate{*cert}
+		hc.ClientCAs = clientCAs
+		return hc, nil
+	}
+	return c, nil
+}
+
+func (f *tlsFiles) get() (*tls.Certificate, *x509.CertPool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if time.Since(f.checkedAt) >= certCheckInterval {
+		f.checkedAt = time.Now()
+		if f.modTimes != f.currentModTimes() {
+			// Keep serving the previous files if the new ones are broken, e.g.
+			// because only the certificate has been replaced so far.
+			_ = f.loadLocked()
+		}
+	}
+	return f.cert, f.clientCAs
+}
+
+func (f *tlsFiles) load() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.loadLocked()
+}
+
+func (f *tlsFiles) loadLocked() error {
+	modTimes := f.currentModTimes()
+
+	cert, err := tls.LoadX509KeyPair(f.cfg.CertFile, f.cfg.KeyFile)
+	if err != nil {
+		return fmt.Errorf("failed to load TLS key pair: %w", err)
+	}
+
+	var clientCAs *x509.CertPool
+	if f.cfg.ClientCAFile != "" {
+		pem, err := os.ReadFile(f.cfg.ClientCAFile)
+		if err != nil {
+			return fmt.Errorf("failed to read client CA bundle: %w", err)
+		}
+		clientCAs = x509.NewCertPool()
+		if !clientCAs.AppendCertsFromPEM(pem) {
+			return fmt.Errorf("client CA bundle %s contains no certificates", f.cfg.ClientCAFile)
+		}
+	}
+
+	f.cert, f.clientCAs, f.modTimes = &cert, clientCAs, modTimes
+	return nil
+}
+
+func (f *tlsFiles) currentModTimes() [3]time.Time {
+	var mt [3]time.Time
+	for i, p := range []string{f.cfg.CertFile, f.cfg.KeyFile, f.cfg.ClientCAFile} {
+		if p == "" {
+			continue
+		}
+		if fi, err := os.Stat(p); err == nil {
+			mt[i] = fi.ModTime()
+		}
+	}
+	return mt
+}
+
+// withClientCertPrincipal attaches the principal of a verified client
+// certificate to the request context.
+func withClientCertPrincipal(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.TLS != nil && len(r.TLS.VerifiedChains) > 0 && len(r.TLS.VerifiedChains[0]) > 0 {
+			if name := certPrincipal(r.TLS.VerifiedChains[0][0]); name != "" {
+				r = r.WithContext(WithPrincipal(r.Context(), &Principal{Name: name, Source: "mtls"}))
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// certPrincipal names a client certificate by its first URI SAN (e.g. a
+// SPIFFE ID), email SAN, DNS SAN or else its subject common name.
+func certPrincipal(cert *x509.Certificate) string {
+	switch {
+	case len(cert.URIs) > 0:
+		return cert.URIs[0].String()
+	case len(cert.EmailAddresses) > 0:
+		return cert.EmailAddresses[0]
+	case len(cert.DNSNames) > 0:
+		return cert.DNSNames[0]
+	default:
+		return cert.Subject.CommonName
+	}
+}
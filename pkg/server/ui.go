@@ -0,0 +1,284 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html/template"
+	"io/fs"
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/abcxyz/pkg/logging"
+	"github.com/yuin/goldmark"
+	"golang.org/x/mod/semver"
+
+	"github.com/yolocs/ar-terraform-registry/pkg/model"
+)
+
+//go:embed ui/templates/*.html
+var uiTemplates embed.FS
+
+//go:embed ui/static
+var uiStatic embed.FS
+
+var uiFuncs = template.FuncMap{
+	"join": strings.Join,
+	"jsonValue": func(v any) string {
+		b, _ := json.Marshal(v)
+		return string(b)
+	},
+}
+
+// uiPages are the page templates, each parsed with the base layout.
+var uiPages = func() map[string]*template.Template {
+	pages := make(map[string]*template.Template)
+	for _, name := range []string{"namespaces", "packages", "provider", "module"} {
+		pages[name] = template.Must(template.New(name).Funcs(uiFuncs).ParseFS(uiTemplates, "ui/templates/base.html", "ui/templates/"+name+".html"))
+	}
+	return pages
+}()
+
+type breadcrumb struct {
+	Name string
+	URL  string
+}
+
+type uiPage struct {
+	Breadcrumbs []breadcrumb
+	Host        string
+}
+
+// Index renders the list of namespaces.
+func (reg *Registry) Index(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/" {
+		http.NotFound(w, r)
+		return
+	}
+	ctx := logging.WithLogger(r.Context(), reg.logger)
+
+	namespaces, err := reg.listNamespaces(ctx)
+	if err != nil {
+		reg.logger.ErrorContext(ctx, "ListNamespaces", "error", err)
+	}
+	reg.render(ctx, w, "namespaces", struct {
+		uiPage
+		Namespaces []string
+	}{Namespaces: namespaces})
+}
+
+func (reg *Registry) UINamespace(w http.ResponseWriter, r *http.Request) {
+	namespace := r.PathValue("namespace")
+	ctx := logging.WithLogger(r.Context(), reg.logger)
+
+	data := struct {
+		uiPage
+		Namespace string
+		Providers []*model.PackageRef
+		Modules   []*model.PackageRef
+	}{
+		uiPage:    uiPage{Breadcrumbs: []breadcrumb{{Name: namespace, URL: "/ui/" + namespace}}},
+		Namespace: namespace,
+	}
+	var found bool
+	for _, c := range []struct {
+		store any
+		kind  string
+		into  *[]*model.PackageRef
+	}{
+		{store: reg.ps, kind: model.KindProvider, into: &data.Providers},
+		{store: reg.ms, kind: model.KindModule, into: &data.Modules},
+	} {
+		cat, ok := c.store.(model.Catalog)
+		if !ok {
+			continue
+		}
+		refs, err := cat.ListPackages(ctx, namespace)
+		if err != nil {
+			reg.logger.DebugContext(ctx, "ListPackages", "kind", c.kind, "error", err)
+			continue
+		}
+		found = true
+		for _, ref := range refs {
+			if ref.Kind == c.kind {
+				*c.into = append(*c.into, ref)
+			}
+		}
+	}
+	if !found {
+		http.Error(w, http.StatusText(http.StatusNotFound), http.StatusNotFound)
+		return
+	}
+	reg.render(ctx, w, "packages", data)
+}
+
+func (reg *Registry) UIProvider(w http.ResponseWriter, r *http.Request) {
+	var (
+		namespace = r.PathValue("namespace")
+		name      = r.PathValue("name")
+		version   = r.PathValue("version")
+	)
+	ctx := logging.WithLogger(r.Context(), reg.logger)
+
+	vs, err := reg.ps.ListProviderVersions(ctx, namespace, name)
+	if err != nil {
+		http.Error(w, http.StatusText(http.StatusNotFound), http.StatusNotFound)
+		reg.logger.ErrorContext(ctx, "ListProviderVersions", "error", err)
+		return
+	}
+	versions := slices.Clone(vs.Versions)
+	slices.SortFunc(versions, func(a, b model.ProviderVersion) int {
+		return semver.Compare("v"+b.Version, "v"+a.Version)
+	})
+
+	data := struct {
+		uiPage
+		Namespace string
+		Name      string
+		Versions  []model.ProviderVersion
+		Selected  *model.ProviderVersion
+	}{
+		uiPage: uiPage{
+			Host: r.Host,
+			Breadcrumbs: []breadcrumb{
+				{Name: namespace, URL: "/ui/" + namespace},
+				{Name: name, URL: fmt.Sprintf("/ui/%s/providers/%s", namespace, name)},
+			},
+		},
+		Namespace: namespace,
+		Name:      name,
+		Versions:  versions,
+	}
+	for i := range versions {
+		if version == "" || versions[i].Version == version {
+			data.Selected = &versions[i]
+			break
+		}
+	}
+	if data.Selected == nil && (version != "" || len(versions) > 0) {
+		http.Error(w, http.StatusText(http.StatusNotFound), http.StatusNotFound)
+		return
+	}
+	if data.Selected == nil {
+		data.Selected = &model.ProviderVersion{}
+	}
+	reg.render(ctx, w, "provider", data)
+}
+
+func (reg *Registry) UIModule(w http.ResponseWriter, r *http.Request) {
+	var (
+		namespace = r.PathValue("namespace")
+		name      = r.PathValue("name")
+		system    = r.PathValue("system")
+		version   = r.PathValue("version")
+	)
+	ctx := logging.WithLogger(r.Context(), reg.logger)
+
+	mvs, err := reg.ms.ListModuleVersions(ctx, namespace, name, system)
+	if err != nil || len(mvs) == 0 {
+		http.Error(w, http.StatusText(http.StatusNotFound), http.StatusNotFound)
+		reg.logger.ErrorContext(ctx, "ListModuleVersions", "error", err)
+		return
+	}
+	slices.SortFunc(mvs, func(a, b *model.ModuleVersion) int {
+		return semver.Compare("v"+b.Version, "v"+a.Version)
+	})
+
+	var selected *model.ModuleVersion
+	versions := make([]string, 0, len(mvs))
+	for _, v := range mvs {
+		versions = append(versions, v.Version)
+		if selected == nil && (version == "" || v.Version == version) {
+			selected = v
+		}
+	}
+	if selected == nil {
+		http.Error(w, http.StatusText(http.StatusNotFound), http.StatusNotFound)
+		return
+	}
+
+	data := struct {
+		uiPage
+		Namespace string
+		Name      string
+		System    string
+		Version   string
+		Versions  []string
+		Metadata  *model.ModuleMetadata
+		Readme    template.HTML
+		Error     string
+	}{
+		uiPage: uiPage{
+			Host: r.Host,
+			Breadcrumbs: []breadcrumb{
+				{Name: namespace, URL: "/ui/" + namespace},
+				{Name: name + "/" + system, URL: fmt.Sprintf("/ui/%s/modules/%s/%s", namespace, name, system)},
+			},
+		},
+		Namespace: namespace,
+		Name:      name,
+		System:    system,
+		Version:   selected.Version,
+		Versions:  versions,
+	}
+
+	md, err := reg.moduleMetadata(ctx, namespace, name, system, selected)
+	if err != nil {
+		reg.logger.ErrorContext(ctx, "UIModule", "error", err)
+		data.Error = "the archive couldn't be analyzed"
+	} else {
+		data.Metadata = md
+		var buf bytes.Buffer
+		// goldmark omits raw HTML and unsafe links by default.
+		if err := goldmark.Convert([]byte(md.Root.Readme), &buf); err == nil {
+			data.Readme = template.HTML(buf.String())
+		}
+	}
+	reg.render(ctx, w, "module", data)
+}
+
+// uiStaticHandler serves the embedded stylesheet and scripts.
+func uiStaticHandler() http.Handler {
+	sub, err := fs.Sub(uiStatic, "ui/static")
+	if err != nil {
+		panic(err)
+	}
+	return http.StripPrefix("/static/", http.FileServer(http.FS(sub)))
+}
+
+func (reg *Registry) render(ctx context.Context, w http.ResponseWriter, page string, data any) {
+	var buf bytes.Buffer
+	if err := uiPages[page].ExecuteTemplate(&buf, "base", data); err != nil {
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		reg.logger.ErrorContext(ctx, "render", "page", page, "error", err)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if _, err := buf.WriteTo(w); err != nil {
+		reg.logger.ErrorContext(ctx, "render", "page", page, "error", err)
+	}
+}
+
+// listNamespaces merges the namespaces of the provider and module stores.
+func (reg *Registry) listNamespaces(ctx context.Context) ([]string, error) {
+	var namespaces []string
+	var merr error
+	for _, s := range []any{reg.ps, reg.ms} {
+		c, ok := s.(model.Catalog)
+		if !ok {
+			continue
+		}
+		ns, err := c.ListNamespaces(ctx)
+		if err != nil {
+			merr = errors.Join(merr, err)
+			continue
+		}
+		namespaces = append(namespaces, ns...)
+	}
+	slices.Sort(namespaces)
+	return slices.Compact(namespaces), merr
+}
@@ -0,0 +1,9 @@
+document.addEventListener("click", (e) => {
+  const button = e.target.closest("[data-copy]");
+  if (!button) return;
+  const code = button.parentElement.querySelector("pre");
+  navigator.clipboard.writeText(code.innerText).then(() => {
+    button.textContent = "Copied";
+    setTimeout(() => { button.textContent = "Copy"; }, 1500);
+  });
+});
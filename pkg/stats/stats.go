@@ -0,0 +1,386 @@
+// Package stats counts provider and module downloads in an embedded bbolt
+// database.
+package stats
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"log/slog"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+const defaultFlushInterval = 10 * time.Second
+
+// countsBucket maps download keys to big endian uint64 counts.
+var countsBucket = []byte("downloads")
+
+// dayFormat is the granularity of the counts.
+const dayFormat = "2006-01-02"
+
+// Anonymous is the principal of unauthenticated downloads.
+const Anonymous = "anonymous"
+
+// Download is a counted download of a version.
+type Download struct {
+	// Kind is "provider" or "module".
+	Kind      string
+	Namespace string
+	Name      string
+	// System is only set for modules.
+	System  string
+	Version string
+	// OS and Arch are only set for providers.
+	OS        string
+	Arch      string
+	Principal string
+	Time      time.Time
+}
+
+type Config struct {
+	// Path is the database file. It's created if it doesn't exist.
+	Path string
+	// FlushInterval is how often recorded downloads are written. Defaults to
+	// 10s.
+	FlushInterval time.Duration
+	Logger        *slog.Logger
+}
+
+// Store counts downloads per version, platform, principal and day. Downloads
+// are aggregated in memory and written periodically, so recording doesn't
+// wait for the disk.
+type Store struct {
+	db     *bolt.DB
+	logger *slog.Logger
+
+	mu      sync.Mutex
+	pending map[string]uint64
+
+	stop chan struct{}
+	done chan struct{}
+}
+
+func Open(cfg *Config) (*Store, error) {
+	db, err := bolt.Open(cfg.Path, 0o600, &bolt.Options{Timeout: time.Second})
+	if err != nil {
+		return nil, fmt.Errorf("failed to open stats database %s: %w", cfg.Path, err)
+	}
+	if err := db.Update(func(tx *bolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists(countsBucket)
+		return err
+	}); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to initialize stats database: %w", err)
+	}
+
+	s := &Store{
+		db:      db,
+		logger:  cfg.Logger,
+		pending: make(map[string]uint64),
+		stop:    make(chan struct{}),
+		done:    make(chan struct{}),
+	}
+	if s.logger == nil {
+		s.logger = slog.Default()
+	}
+	interval := cfg.FlushInterval
+	if interval <= 0 {
+		interval = defaultFlushInterval
+	}
+	go s.run(interval)
+	return s, nil
+}
+
+// Record counts a download.
+func (s *Store) Record(d *Download) {
+	t := d.Time
+	if t.IsZero() {
+		t = time.Now()
+	}
+	principal := d.Principal
+	if principal == "" {
+		principal = Anonymous
+	}
+	k := encodeKey(d.Kind, d.Namespace, d.Name, d.System, d.Version, d.OS, d.Arch, principal, t.UTC().Format(dayFormat))
+
+	s.mu.Lock()
+	s.pending[k]++
+	s.mu.Unlock()
+}
+
+// Close writes the pending downloads and closes the database.
+func (s *Store) Close() error {
+	close(s.stop)
+	<-s.done
+	return errors.Join(s.Flush(), s.db.Close())
+}
+
+// Flush writes the pending downloads.
+func (s *Store) Flush() error {
+	s.mu.Lock()
+	pending := s.pending
+	s.pending = make(map[string]uint64)
+	s.mu.Unlock()
+	if len(pending) == 0 {
+		return nil
+	}
+
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(countsBucket)
+		for k, n := range pending {
+			var buf [8]byte
+			binary.BigEndian.PutUint64(buf[:], decodeCount(b.Get([]byte(k)))+n)
+			if err := b.Put([]byte(k), buf[:]); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		// Keep the counts for the next flush.
+		s.mu.Lock()
+		for k, n := range pending {
+			s.pending[k] += n
+		}
+		s.mu.Unlock()
+		return fmt.Errorf("failed to write download counts: %w", err)
+	}
+	return nil
+}
+
+func (s *Store) run(interval time.Duration) {
+	defer close(s.done)
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-s.stop:
+			return
+		case <-t.C:
+			if err := s.Flush(); err != nil {
+				s.logger.Error("failed to flush download counts", "error", err)
+			}
+		}
+	}
+}
+
+// Filter selects the counted downloads. Empty fields match everything.
+type Filter struct {
+	Kind      string
+	Namespace string
+	Name      string
+	System    string
+	// Since drops the downloads of earlier days.
+	Since time.Time
+}
+
+// VersionStats are the downloads of a version.
+type VersionStats struct {
+	Kind         string            `json:"kind"`
+	Namespace    string            `json:"namespace"`
+	Name         string            `json:"name"`
+	System       string            `json:"system,omitempty"`
+	Version      string            `json:"version"`
+	Downloads    uint64            `json:"downloads"`
+	LastDownload string            `json:"last_download,omitempty"`
+	Platforms    []*PlatformStats  `json:"platforms,omitempty"`
+	Principals   []*PrincipalStats `json:"principals"`
+}
+
+type PlatformStats struct {
+	OS        string `json:"os"`
+	Arch      string `json:"arch"`
+	Downloads uint64 `json:"downloads"`
+}
+
+type PrincipalStats struct {
+	Principal    string `json:"principal"`
+	Downloads    uint64 `json:"downloads"`
+	LastDownload string `json:"last_download"`
+}
+
+// Versions aggregates the downloads matching the filter by version, ordered
+// by package and version.
+func (s *Store) Versions(ctx context.Context, f *Filter) ([]*VersionStats, error) {
+	if err := s.Flush(); err != nil {
+		return nil, err
+	}
+
+	since := ""
+	if !f.Since.IsZero() {
+		since = f.Since.UTC().Format(dayFormat)
+	}
+	byVersion := make(map[string]*VersionStats)
+	err := s.scan(f, func(k *key, n uint64) {
+		if k.day < since {
+			return
+		}
+		id := encodeKey(k.kind, k.namespace, k.name, k.system, k.version)
+		v, ok := byVersion[id]
+		if !ok {
+			v = &VersionStats{Kind: k.kind, Namespace: k.namespace, Name: k.name, System: k.system, Version: k.version}
+			byVersion[id] = v
+		}
+		v.Downloads += n
+		v.LastDownload = max(v.LastDownload, k.day)
+
+		if k.os != "" || k.arch != "" {
+			i := slices.IndexFunc(v.Platforms, func(p *PlatformStats) bool { return p.OS == k.os && p.Arch == k.arch })
+			if i < 0 {
+				v.Platforms = append(v.Platforms, &PlatformStats{OS: k.os, Arch: k.arch})
+				i = len(v.Platforms) - 1
+			}
+			v.Platforms[i].Downloads += n
+		}
+
+		i := slices.IndexFunc(v.Principals, func(p *PrincipalStats) bool { return p.Principal == k.principal })
+		if i < 0 {
+			v.Principals = append(v.Principals, &PrincipalStats{Principal: k.principal})
+			i = len(v.Principals) - 1
+		}
+		v.Principals[i].Downloads += n
+		v.Principals[i].LastDownload = max(v.Principals[i].LastDownload, k.day)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	vs := make([]*VersionStats, 0, len(byVersion))
+	for _, v := range byVersion {
+		slices.SortFunc(v.Platforms, func(a, b *PlatformStats) int {
+			return strings.Compare(a.OS+"_"+a.Arch, b.OS+"_"+b.Arch)
+		})
+		slices.SortFunc(v.Principals, func(a, b *PrincipalStats) int {
+			if a.Downloads != b.Downloads {
+				return compareDesc(a.Downloads, b.Downloads)
+			}
+			return strings.Compare(a.Principal, b.Principal)
+		})
+		vs = append(vs, v)
+	}
+	slices.SortFunc(vs, func(a, b *VersionStats) int {
+		return strings.Compare(
+			encodeKey(a.Kind, a.Namespace, a.Name, a.System, a.Version),
+			encodeKey(b.Kind, b.Namespace, b.Name, b.System, b.Version))
+	})
+	return vs, nil
+}
+
+// Summary counts the downloads of a package over the last week, month and
+// year, and in total.
+type Summary struct {
+	Week  uint64 `json:"week"`
+	Month uint64 `json:"month"`
+	Year  uint64 `json:"year"`
+	Total uint64 `json:"total"`
+}
+
+// Summary counts the downloads of the packages matching the filter, with the
+// windows ending at now. Filter.Since is ignored.
+func (s *Store) Summary(ctx context.Context, f *Filter, now time.Time) (*Summary, error) {
+	if err := s.Flush(); err != nil {
+		return nil, err
+	}
+
+	now = now.UTC()
+	week := now.AddDate(0, 0, -6).Format(dayFormat)
+	month := now.AddDate(0, -1, 1).Format(dayFormat)
+	year := now.AddDate(-1, 0, 1).Format(dayFormat)
+
+	sum := &Summary{}
+	err := s.scan(f, func(k *key, n uint64) {
+		sum.Total += n
+		if k.day >= year {
+			sum.Year += n
+		}
+		if k.day >= month {
+			sum.Month += n
+		}
+		if k.day >= week {
+			sum.Week += n
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+	return sum, nil
+}
+
+// scan calls fn with the counts matching the filter. Keys start with the
+// package fields, so leading filter fields narrow the scan to a prefix.
+func (s *Store) scan(f *Filter, fn func(*key, uint64)) error {
+	var prefix []string
+	for _, field := range []string{f.Kind, f.Namespace, f.Name, f.System} {
+		if field == "" {
+			break
+		}
+		prefix = append(prefix, field)
+	}
+	p := []byte("")
+	if len(prefix) > 0 {
+		p = []byte(encodeKey(prefix...) + keySeparator)
+	}
+
+	return s.db.View(func(tx *bolt.Tx) error {
+		c := tx.Bucket(countsBucket).Cursor()
+		for kb, vb := c.Seek(p); kb != nil && strings.HasPrefix(string(kb), string(p)); kb, vb = c.Next() {
+			k, ok := decodeKey(string(kb))
+			if !ok || !f.matches(k) {
+				continue
+			}
+			fn(k, decodeCount(vb))
+		}
+		return nil
+	})
+}
+
+func (f *Filter) matches(k *key) bool {
+	for _, m := range [][2]string{{f.Kind, k.kind}, {f.Namespace, k.namespace}, {f.Name, k.name}, {f.System, k.system}} {
+		if m[0] != "" && m[0] != m[1] {
+			return false
+		}
+	}
+	return true
+}
+
+// keySeparator can't appear in namespaces, names, versions or principals.
+const keySeparator = "\x00"
+
+type key struct {
+	kind, namespace, name, system, version, os, arch, principal, day string
+}
+
+func encodeKey(fields ...string) string {
+	return strings.Join(fields, keySeparator)
+}
+
+func decodeKey(s string) (*key, bool) {
+	f := strings.Split(s, keySeparator)
+	if len(f) != 9 {
+		return nil, false
+	}
+	return &key{kind: f[0], namespace: f[1], name: f[2], system: f[3], version: f[4], os: f[5], arch: f[6], principal: f[7], day: f[8]}, true
+}
+
+func decodeCount(b []byte) uint64 {
+	if len(b) != 8 {
+		return 0
+	}
+	return binary.BigEndian.Uint64(b)
+}
+
+func compareDesc(a, b uint64) int {
+	switch {
+	case a > b:
+		return -1
+	case a < b:
+		return 1
+	}
+	return 0
+}
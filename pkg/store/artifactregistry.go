@@ -6,16 +6,27 @@ import (
 	"bufio"
 	"bytes"
 	"context"
+	"encoding/hex"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
+	"maps"
+	"net/http"
 	"path"
+	"slices"
 	"strings"
+	"sync"
 
 	ar "cloud.google.com/go/artifactregistry/apiv1"
 	arpb "cloud.google.com/go/artifactregistry/apiv1/artifactregistrypb"
 	openpgp "github.com/ProtonMail/go-crypto/openpgp/v2"
 	"github.com/abcxyz/pkg/logging"
+	"golang.org/x/mod/semver"
+	"google.golang.org/api/iterator"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/fieldmaskpb"
 
 	"github.com/yolocs/ar-terraform-registry/pkg/model"
 )
@@ -25,34 +36,58 @@ type Config struct {
 	Location               string
 	ArtifactRegistryClient *ar.Client
 	Downloader             *Downloader
+	// Uploader enables publishing. Without it the store is read-only.
+	Uploader *Uploader
+	Mapping  *Mapping
 }
 
 type ArtifactRegistryGeneric struct {
 	client     *ar.Client
 	downloader *Downloader
+	uploader   *Uploader
+	mapping    *Mapping
 	scope      string
 }
 
 func NewArtifactRegistryGeneric(cfg *Config) (*ArtifactRegistryGeneric, error) {
+	if err := cfg.Mapping.Validate(); err != nil {
+		return nil, err
+	}
 	return &ArtifactRegistryGeneric{
 		client:     cfg.ArtifactRegistryClient,
 		downloader: cfg.Downloader,
+		uploader:   cfg.Uploader,
+		mapping:    cfg.Mapping,
 		scope:      fmt.Sprintf("projects/%s/locations/%s", cfg.ProjectID, cfg.Location),
 	}, nil
 }
 
+// CheckHealth lists at most one repository in the configured scope to verify
+// the Artifact Registry API is reachable with the current credentials.
+func (a *ArtifactRegistryGeneric) CheckHealth(ctx context.Context) error {
+	iter := a.client.ListRepositories(ctx, &arpb.ListRepositoriesRequest{
+		Parent:   a.scope,
+		PageSize: 1,
+	})
+	if _, err := iter.Next(); err != nil && !errors.Is(err, iterator.Done) {
+		return fmt.Errorf("failed to list repositories: %w", err)
+	}
+	return nil
+}
+
 func (a *ArtifactRegistryGeneric) ListProviderVersions(ctx context.Context, namespace string, name string) (*model.ProviderVersions, error) {
 	logger := logging.FromContext(ctx)
 
-	repo, pkg := namespace, name
+	repo, pkg := a.mapping.Repository(namespace), a.mapping.ProviderPkg(namespace, name)
 	pageToken := ""
-	var fullVersions []string
+	var fullVersions, yanked []string
 
 	for {
 		req := &arpb.ListVersionsRequest{
 			Parent:    fmt.Sprintf("%s/repositories/%s/packages/%s", a.scope, repo, pkg),
 			PageSize:  1000,
 			PageToken: pageToken,
+			View:      arpb.VersionView_FULL,
 		}
 		iter := a.client.ListVersions(ctx, req)
 
@@ -62,6 +97,9 @@ func (a *ArtifactRegistryGeneric) ListProviderVersions(ctx context.Context, name
 			}
 			logger.DebugContext(ctx, "ListProviderVersions found version", "version", v.Name)
 			fullVersions = append(fullVersions, path.Base(v.Name))
+			if isYanked(v) {
+				yanked = append(yanked, path.Base(v.Name))
+			}
 		}
 
 		if iter.PageInfo().Token == "" {
@@ -70,7 +108,7 @@ func (a *ArtifactRegistryGeneric) ListProviderVersions(ctx context.Context, name
 		pageToken = iter.PageInfo().Token
 	}
 
-	vs, err := mapVersions(fullVersions)
+	vs, err := mapVersions(withoutYanked(fullVersions, yanked))
 	if err != nil {
 		logger.ErrorContext(ctx, "ListProviderVersions found unrecognized version names", "error", err)
 	}
@@ -79,30 +117,493 @@ func (a *ArtifactRegistryGeneric) ListProviderVersions(ctx context.Context, name
 }
 
 func (a *ArtifactRegistryGeneric) GetProviderVersion(ctx context.Context, namespace string, name string, version string, os string, arch string) (*model.Provider, error) {
+	repo, pkg := a.mapping.Repository(namespace), a.mapping.ProviderPkg(namespace, name)
+
+	// Versions are per platform, so the version's files are only the binary,
+	// checksums, signature and key of this platform.
+	versionName := fmt.Sprintf("%s/repositories/%s/packages/%s/versions/%s", a.scope, repo, pkg, fullVersion(version, os, arch))
+	files, err := a.listFiles(ctx, repo, versionName)
+	if err != nil {
+		return nil, err
+	}
+
+	return resolveProvider(ctx, namespace, name, pkg, version, os, arch, files, func(ctx context.Context, fileName string) (io.ReadCloser, error) {
+		return a.GetProviderAsset(ctx, namespace, fileName)
+	})
+}
+
+// ProviderPackageHash returns the cached hash from the version annotations, or
+// computes and caches it. Failing to cache isn't an error, e.g. when the
+// server only has read access.
+func (a *ArtifactRegistryGeneric) ProviderPackageHash(ctx context.Context, namespace, name, version, os, arch string) (string, error) {
 	logger := logging.FromContext(ctx)
-	repo, pkg, fullVer := namespace, name, fullVersion(version, os, arch)
-	req := &arpb.ListFilesRequest{
-		Parent:   fmt.Sprintf("%s/repositories/%s", a.scope, repo),
-		Filter:   fmt.Sprintf(`owner="%s/repositories/%s/packages/%s"`, a.scope, repo, pkg),
+
+	repo, pkg := a.mapping.Repository(namespace), a.mapping.ProviderPkg(namespace, name)
+	versionName := fmt.Sprintf("%s/repositories/%s/packages/%s/versions/%s", a.scope, repo, pkg, fullVersion(version, os, arch))
+	v, err := a.client.GetVersion(ctx, &arpb.GetVersionRequest{
+		Name: versionName,
+		View: arpb.VersionView_FULL,
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to get version %s: %w", versionName, err)
+	}
+	if h := v.GetAnnotations()[providerHashAnnotation]; h != "" {
+		return h, nil
+	}
+
+	h, err := packageHashV1(ctx, func(ctx context.Context, fileName string) (io.ReadCloser, error) {
+		return a.GetProviderAsset(ctx, namespace, fileName)
+	}, providerBinaryName(pkg, name, version, os, arch))
+	if err != nil {
+		return "", err
+	}
+
+	annotations := maps.Clone(v.GetAnnotations())
+	if annotations == nil {
+		annotations = make(map[string]string)
+	}
+	annotations[providerHashAnnotation] = h
+	if _, err := a.client.UpdateVersion(ctx, &arpb.UpdateVersionRequest{
+		Version:    &arpb.Version{Name: versionName, Annotations: annotations},
+		UpdateMask: &fieldmaskpb.FieldMask{Paths: []string{"annotations"}},
+	}); err != nil {
+		logger.WarnContext(ctx, "failed to cache provider package hash", "version", versionName, "error", err)
+	}
+	return h, nil
+}
+
+func (a *ArtifactRegistryGeneric) GetProviderAsset(ctx context.Context, namespace string, fileName string) (io.ReadCloser, error) {
+	u := fmt.Sprintf("%s/repositories/%s/files/%s:download", a.scope, a.mapping.Repository(namespace), fileName)
+	r, err := a.downloader.Download(ctx, u)
+	if err != nil {
+		return nil, fmt.Errorf("failed to download %s: %w", fileName, err)
+	}
+	return r, nil
+}
+
+func (a *ArtifactRegistryGeneric) ListModuleVersions(ctx context.Context, namespace, name, system string) ([]*model.ModuleVersion, error) {
+	logger := logging.FromContext(ctx)
+
+	repo, pkg := a.mapping.Repository(namespace), a.mapping.ModulePkg(namespace, name, system)
+	pkgName := fmt.Sprintf("%s/repositories/%s/packages/%s", a.scope, repo, pkg)
+
+	// List the package files once instead of once per version to find out how
+	// each version's archive is packaged.
+	files, err := a.listFiles(ctx, repo, pkgName)
+	if err != nil {
+		return nil, err
+	}
+
+	var vs []*model.ModuleVersion
+	iter := a.client.ListVersions(ctx, &arpb.ListVersionsRequest{
+		Parent:   pkgName,
+		PageSize: 1000,
+		View:     arpb.VersionView_FULL,
+	})
+	for v, err := range iter.All() {
+		if err != nil {
+			return nil, fmt.Errorf("failed to iterate over versions: %w", err)
+		}
+
+		logger.DebugContext(ctx, "ListModuleVersions found version", "version", v.Name)
+		if isYanked(v) {
+			continue
+		}
+
+		version := path.Base(v.Name)
+		fileName, hint := findModuleArchive(files, pkg, version)
+		vs = append(vs, &model.ModuleVersion{
+			Version:   version,
+			SourceURL: moduleSourceURL(namespace, fileName, hint),
+			Subdir:    v.GetAnnotations()[moduleSubdirAnnotation],
+		})
+	}
+
+	return vs, nil
+}
+
+func (a *ArtifactRegistryGeneric) GetModuleVersion(ctx context.Context, namespace, name, system, version string) (*model.ModuleVersion, error) {
+	repo, pkg := a.mapping.Repository(namespace), a.mapping.ModulePkg(namespace, name, system)
+	versionName := fmt.Sprintf("%s/repositories/%s/packages/%s/versions/%s", a.scope, repo, pkg, version)
+
+	v, err := a.client.GetVersion(ctx, &arpb.GetVersionRequest{
+		Name: versionName,
+		View: arpb.VersionView_FULL,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get version %q: %w", version, err)
+	}
+
+	files, err := a.listFiles(ctx, repo, versionName)
+	if err != nil {
+		return nil, err
+	}
+
+	fileName, hint := findModuleArchive(files, pkg, version)
+	return &model.ModuleVersion{
+		Version:   version,
+		SourceURL: moduleSourceURL(namespace, fileName, hint),
+		Subdir:    v.GetAnnotations()[moduleSubdirAnnotation],
+	}, nil
+}
+
+// PutModuleMetadata uploads the metadata as a file of the version.
+func (a *ArtifactRegistryGeneric) PutModuleMetadata(ctx context.Context, namespace, name, system, version string, md *model.ModuleMetadata) error {
+	if a.uploader == nil {
+		return fmt.Errorf("store is read-only: %w", errors.ErrUnsupported)
+	}
+	b, err := json.Marshal(md)
+	if err != nil {
+		return fmt.Errorf("failed to marshal module metadata: %w", err)
+	}
+	repoName := fmt.Sprintf("%s/repositories/%s", a.scope, a.mapping.Repository(namespace))
+	return a.uploader.Upload(ctx, repoName, a.mapping.ModulePkg(namespace, name, system), version, moduleMetadataFile, bytes.NewReader(b))
+}
+
+func (a *ArtifactRegistryGeneric) GetModuleMetadata(ctx context.Context, namespace, name, system, version string) (*model.ModuleMetadata, error) {
+	repo, pkg := a.mapping.Repository(namespace), a.mapping.ModulePkg(namespace, name, system)
+	u := fmt.Sprintf("%s/repositories/%s/files/%s:download", a.scope, repo, moduleMetadataFileName(pkg, version))
+	r, err := a.downloader.Download(ctx, u)
+	if de := (*DownloadError)(nil); errors.As(err, &de) && de.StatusCode == http.StatusNotFound {
+		return nil, fmt.Errorf("metadata of %s: %w", version, model.ErrNotFound)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to download module metadata: %w", err)
+	}
+	defer r.Close()
+
+	var md model.ModuleMetadata
+	if err := json.NewDecoder(r).Decode(&md); err != nil {
+		return nil, fmt.Errorf("failed to parse module metadata: %w", err)
+	}
+	return &md, nil
+}
+
+func (a *ArtifactRegistryGeneric) GetModuleArchive(ctx context.Context, namespace, fileName string) (io.ReadCloser, error) {
+	u := fmt.Sprintf("%s/repositories/%s/files/%s:download", a.scope, a.mapping.Repository(namespace), fileName)
+	r, err := a.downloader.Download(ctx, u)
+	if err != nil {
+		return nil, fmt.Errorf("failed to download %s: %w", fileName, err)
+	}
+	return r, nil
+}
+
+func (a *ArtifactRegistryGeneric) OpenProviderAsset(ctx context.Context, namespace, fileName string) (*model.Asset, error) {
+	return a.openAsset(ctx, namespace, fileName)
+}
+
+func (a *ArtifactRegistryGeneric) OpenModuleArchive(ctx context.Context, namespace, fileName string) (*model.Asset, error) {
+	return a.openAsset(ctx, namespace, fileName)
+}
+
+// openAsset looks up the file's size, hash and update time. The content is
+// only downloaded once it's read, from the offset it has been seeked to.
+func (a *ArtifactRegistryGeneric) openAsset(ctx context.Context, namespace, fileName string) (*model.Asset, error) {
+	name := fmt.Sprintf("%s/repositories/%s/files/%s", a.scope, a.mapping.Repository(namespace), fileName)
+	f, err := a.client.GetFile(ctx, &arpb.GetFileRequest{Name: name})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get file %s: %w", fileName, err)
+	}
+
+	asset := &model.Asset{
+		Size:    f.GetSizeBytes(),
+		ModTime: f.GetUpdateTime().AsTime(),
+	}
+	for _, h := range f.GetHashes() {
+		if h.GetType() == arpb.Hash_SHA256 {
+			asset.SHA256 = hex.EncodeToString(h.GetValue())
+		}
+	}
+	asset.ReadSeekCloser = newRangeReader(ctx, asset.Size, func(ctx context.Context, offset int64) (io.ReadCloser, error) {
+		r, err := a.downloader.DownloadFrom(ctx, name+":download", offset)
+		if err != nil {
+			return nil, fmt.Errorf("failed to download %s: %w", fileName, err)
+		}
+		return r, nil
+	})
+	return asset, nil
+}
+
+func (a *ArtifactRegistryGeneric) PutProviderFile(ctx context.Context, namespace, name, version, os, arch, fileName string, r io.Reader) error {
+	if a.uploader == nil {
+		return fmt.Errorf("store is read-only: %w", errors.ErrUnsupported)
+	}
+	repoName := fmt.Sprintf("%s/repositories/%s", a.scope, a.mapping.Repository(namespace))
+	return a.uploader.Upload(ctx, repoName, a.mapping.ProviderPkg(namespace, name), fullVersion(version, os, arch), fileName, r)
+}
+
+// PutModuleArchive uploads the archive and records the subdir as a version
+// annotation.
+func (a *ArtifactRegistryGeneric) PutModuleArchive(ctx context.Context, namespace, name, system, version, format, subdir string, r io.Reader) error {
+	if a.uploader == nil {
+		return fmt.Errorf("store is read-only: %w", errors.ErrUnsupported)
+	}
+	ext, ok := moduleArchiveExt(format)
+	if !ok {
+		return fmt.Errorf("unsupported module archive format %q", format)
+	}
+
+	repoName := fmt.Sprintf("%s/repositories/%s", a.scope, a.mapping.Repository(namespace))
+	pkg := a.mapping.ModulePkg(namespace, name, system)
+	if err := a.uploader.Upload(ctx, repoName, pkg, version, "module-archive."+ext, r); err != nil {
+		return err
+	}
+	if subdir == "" {
+		return nil
+	}
+
+	if _, err := a.client.UpdateVersion(ctx, &arpb.UpdateVersionRequest{
+		Version: &arpb.Version{
+			Name:        fmt.Sprintf("%s/packages/%s/versions/%s", repoName, pkg, version),
+			Annotations: map[string]string{moduleSubdirAnnotation: subdir},
+		},
+		UpdateMask: &fieldmaskpb.FieldMask{Paths: []string{"annotations"}},
+	}); err != nil {
+		return fmt.Errorf("failed to set module subdir of %s: %w", version, err)
+	}
+	return nil
+}
+
+// ListNamespaces lists the namespaces of the generic repositories in the
+// scope.
+func (a *ArtifactRegistryGeneric) ListNamespaces(ctx context.Context) ([]string, error) {
+	iter := a.client.ListRepositories(ctx, &arpb.ListRepositoriesRequest{
+		Parent:   a.scope,
 		PageSize: 1000,
+	})
+	var namespaces []string
+	for r, err := range iter.All() {
+		if err != nil {
+			return nil, fmt.Errorf("failed to iterate over repositories: %w", err)
+		}
+		if r.GetFormat() == arpb.Repository_GENERIC {
+			namespaces = append(namespaces, a.mapping.Namespace(path.Base(r.GetName())))
+		}
+	}
+	return namespaces, nil
+}
+
+func (a *ArtifactRegistryGeneric) ListPackages(ctx context.Context, namespace string) ([]*model.PackageRef, error) {
+	iter := a.client.ListPackages(ctx, &arpb.ListPackagesRequest{
+		Parent:   fmt.Sprintf("%s/repositories/%s", a.scope, a.mapping.Repository(namespace)),
+		PageSize: 1000,
+	})
+	var refs []*model.PackageRef
+	for p, err := range iter.All() {
+		if err != nil {
+			return nil, fmt.Errorf("failed to iterate over packages: %w", err)
+		}
+		if ref, ok := a.mapping.ParsePackage(namespace, path.Base(p.GetName())); ok {
+			refs = append(refs, ref)
+		}
 	}
+	return refs, nil
+}
+
+// listFiles returns the base names of all files in the repo owned by owner,
+// which may be a package or a version resource name.
+func (a *ArtifactRegistryGeneric) listFiles(ctx context.Context, repo, owner string) ([]string, error) {
+	infos, err := a.listFileInfos(ctx, repo, owner)
+	if err != nil {
+		return nil, err
+	}
+	files := make([]string, 0, len(infos))
+	for _, f := range infos {
+		files = append(files, f.Name)
+	}
+	return files, nil
+}
+
+// listFileInfos is listFiles with the size, hash and update time of each file.
+func (a *ArtifactRegistryGeneric) listFileInfos(ctx context.Context, repo, owner string) ([]*model.FileInfo, error) {
+	iter := a.client.ListFiles(ctx, &arpb.ListFilesRequest{
+		Parent:   fmt.Sprintf("%s/repositories/%s", a.scope, repo),
+		Filter:   fmt.Sprintf(`owner="%s"`, owner),
+		PageSize: 1000,
+	})
 
-	// We don't expect a lot files per version.
-	var files []*arpb.File
-	iter := a.client.ListFiles(ctx, req)
+	var files []*model.FileInfo
 	for f, err := range iter.All() {
 		if err != nil {
 			return nil, fmt.Errorf("failed to iterate over files: %w", err)
 		}
-		files = append(files, f)
+		info := &model.FileInfo{
+			Name:    path.Base(f.GetName()),
+			Size:    f.GetSizeBytes(),
+			ModTime: f.GetUpdateTime().AsTime(),
+		}
+		for _, h := range f.GetHashes() {
+			if h.GetType() == arpb.Hash_SHA256 {
+				info.SHA256 = hex.EncodeToString(h.GetValue())
+			}
+		}
+		files = append(files, info)
+	}
+	return files, nil
+}
+
+// CreateNamespace creates the generic repository holding the namespace.
+func (a *ArtifactRegistryGeneric) CreateNamespace(ctx context.Context, namespace string) error {
+	op, err := a.client.CreateRepository(ctx, &arpb.CreateRepositoryRequest{
+		Parent:       a.scope,
+		RepositoryId: a.mapping.Repository(namespace),
+		Repository:   &arpb.Repository{Format: arpb.Repository_GENERIC},
+	})
+	if err == nil {
+		_, err = op.Wait(ctx)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to create repository for %q: %w", namespace, statusError(err))
+	}
+	return nil
+}
+
+func (a *ArtifactRegistryGeneric) ListVersions(ctx context.Context, namespace string, ref *model.PackageRef) ([]*model.VersionInfo, error) {
+	vs, err := a.listVersions(ctx, namespace, ref)
+	if err != nil {
+		return nil, err
+	}
+	stored := make(map[string]bool, len(vs))
+	for _, v := range vs {
+		stored[path.Base(v.GetName())] = isYanked(v)
+	}
+	return versionInfos(ref.Kind, stored), nil
+}
+
+func (a *ArtifactRegistryGeneric) ListVersionFiles(ctx context.Context, namespace string, ref *model.PackageRef, version string) ([]*model.FileInfo, error) {
+	vs, err := a.versions(ctx, namespace, ref, version)
+	if err != nil {
+		return nil, err
+	}
+	var files []*model.FileInfo
+	for _, v := range vs {
+		infos, err := a.listFileInfos(ctx, a.mapping.Repository(namespace), v.GetName())
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, infos...)
+	}
+	slices.SortFunc(files, func(a, b *model.FileInfo) int { return strings.Compare(a.Name, b.Name) })
+	return files, nil
+}
+
+func (a *ArtifactRegistryGeneric) DeletePackage(ctx context.Context, namespace string, ref *model.PackageRef) error {
+	name := a.packageName(namespace, ref)
+	op, err := a.client.DeletePackage(ctx, &arpb.DeletePackageRequest{Name: name})
+	if err == nil {
+		err = op.Wait(ctx)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to delete package %s: %w", name, statusError(err))
+	}
+	return nil
+}
+
+// DeleteVersion deletes the version, or every platform version of a provider
+// version, with its files.
+func (a *ArtifactRegistryGeneric) DeleteVersion(ctx context.Context, namespace string, ref *model.PackageRef, version string) error {
+	vs, err := a.versions(ctx, namespace, ref, version)
+	if err != nil {
+		return err
+	}
+	for _, v := range vs {
+		op, err := a.client.DeleteVersion(ctx, &arpb.DeleteVersionRequest{Name: v.GetName(), Force: true})
+		if err == nil {
+			err = op.Wait(ctx)
+		}
+		if err != nil {
+			return fmt.Errorf("failed to delete version %s: %w", v.GetName(), statusError(err))
+		}
 	}
+	return nil
+}
+
+// SetYanked sets or removes the yanked annotation of the version, or of every
+// platform version of a provider version.
+func (a *ArtifactRegistryGeneric) SetYanked(ctx context.Context, namespace string, ref *model.PackageRef, version string, yanked bool) error {
+	vs, err := a.versions(ctx, namespace, ref, version)
+	if err != nil {
+		return err
+	}
+	for _, v := range vs {
+		if isYanked(v) == yanked {
+			continue
+		}
+		annotations := maps.Clone(v.GetAnnotations())
+		if annotations == nil {
+			annotations = make(map[string]string)
+		}
+		if yanked {
+			annotations[yankedAnnotation] = "true"
+		} else {
+			delete(annotations, yankedAnnotation)
+		}
+		if _, err := a.client.UpdateVersion(ctx, &arpb.UpdateVersionRequest{
+			Version:    &arpb.Version{Name: v.GetName(), Annotations: annotations},
+			UpdateMask: &fieldmaskpb.FieldMask{Paths: []string{"annotations"}},
+		}); err != nil {
+			return fmt.Errorf("failed to update version %s: %w", v.GetName(), statusError(err))
+		}
+	}
+	return nil
+}
+
+func (a *ArtifactRegistryGeneric) packageName(namespace string, ref *model.PackageRef) string {
+	return fmt.Sprintf("%s/repositories/%s/packages/%s", a.scope, a.mapping.Repository(namespace), a.mapping.Package(namespace, ref))
+}
+
+// listVersions lists the versions of a package with their annotations.
+func (a *ArtifactRegistryGeneric) listVersions(ctx context.Context, namespace string, ref *model.PackageRef) ([]*arpb.Version, error) {
+	iter := a.client.ListVersions(ctx, &arpb.ListVersionsRequest{
+		Parent:   a.packageName(namespace, ref),
+		PageSize: 1000,
+		View:     arpb.VersionView_FULL,
+	})
+	var vs []*arpb.Version
+	for v, err := range iter.All() {
+		if err != nil {
+			return nil, fmt.Errorf("failed to iterate over versions: %w", statusError(err))
+		}
+		vs = append(vs, v)
+	}
+	return vs, nil
+}
+
+// versions returns the stored versions making up a version: the version
+// itself for modules, and its platform versions for providers.
+func (a *ArtifactRegistryGeneric) versions(ctx context.Context, namespace string, ref *model.PackageRef, version string) ([]*arpb.Version, error) {
+	all, err := a.listVersions(ctx, namespace, ref)
+	if err != nil {
+		return nil, err
+	}
+	var vs []*arpb.Version
+	for _, v := range all {
+		if storedVersionOf(ref.Kind, path.Base(v.GetName())) == version {
+			vs = append(vs, v)
+		}
+	}
+	if len(vs) == 0 {
+		return nil, fmt.Errorf("version %s of %s: %w", version, a.mapping.Package(namespace, ref), model.ErrNotFound)
+	}
+	return vs, nil
+}
+
+// openFunc opens a file of a repository by its base name.
+type openFunc func(ctx context.Context, fileName string) (io.ReadCloser, error)
+
+// resolveProvider builds the provider download response for a platform from
+// the base names of the package's files. Stores share the Artifact Registry
+// file naming scheme, so only the way files are listed and opened differs.
+// Asset URLs use the public namespace.
+func resolveProvider(ctx context.Context, namespace, name, pkg, version, os, arch string, files []string, open openFunc) (*model.Provider, error) {
+	logger := logging.FromContext(ctx)
+	fullVer := fullVersion(version, os, arch)
 
 	var providerBinName, shaSumName, shaSumSigName, gpgKeyName string
-	namePrefix := providerFileNamePrefix(pkg, fullVer, version)
+	namePrefix := providerFileNamePrefix(pkg, name, fullVer, version)
 
-	for _, f := range files {
-		logger.DebugContext(ctx, "GetProviderVersion found file", "file", f.Name)
-		fn := path.Base(f.Name)
+	for _, fn := range files {
+		logger.DebugContext(ctx, "GetProviderVersion found file", "file", fn)
 
 		switch fn {
 		case namePrefix + fmt.Sprintf("_%s_%s.zip", os, arch):
@@ -126,19 +627,33 @@ func (a *ArtifactRegistryGeneric) GetProviderVersion(ctx context.Context, namesp
 		return nil, fmt.Errorf("SHA256SUMS.sig not found for %q", fullVer)
 	}
 
-	shaSums, err := a.parseSHASumFile(ctx, repo, shaSumName)
-	if err != nil {
-		return nil, fmt.Errorf("failed to parse SHA256SUMS: %w", err)
+	// Fetch the checksums and the key concurrently; each is a round trip.
+	var (
+		wg             sync.WaitGroup
+		shaSums        map[string]string
+		keys           []model.GpgPublicKeys
+		shaErr, keyErr error
+	)
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		shaSums, shaErr = parseSHASumFile(ctx, open, shaSumName)
+	}()
+	go func() {
+		defer wg.Done()
+		keys, keyErr = parseGPGKeys(ctx, open, gpgKeyName)
+	}()
+	wg.Wait()
+	if shaErr != nil {
+		return nil, fmt.Errorf("failed to parse SHA256SUMS: %w", shaErr)
 	}
-
-	keys, err := a.parseGPGKeys(ctx, repo, gpgKeyName)
-	if err != nil {
-		return nil, fmt.Errorf("failed to parse GPG keys: %w", err)
+	if keyErr != nil {
+		return nil, fmt.Errorf("failed to parse GPG keys: %w", keyErr)
 	}
 
-	downloadUrl := fmt.Sprintf("/download/provider/%s/asset/%s", repo, providerBinName)
-	SHASumURL := fmt.Sprintf("/download/provider/%s/asset/%s", repo, shaSumName)
-	SHASumSigURL := fmt.Sprintf("/download/provider/%s/asset/%s", repo, shaSumSigName)
+	downloadUrl := providerAssetURL(namespace, providerBinName)
+	SHASumURL := providerAssetURL(namespace, shaSumName)
+	SHASumSigURL := providerAssetURL(namespace, shaSumSigName)
 
 	shaSum, fileNameInSHASums, err := findSHA(shaSums, providerBinName)
 	if err != nil {
@@ -160,66 +675,10 @@ func (a *ArtifactRegistryGeneric) GetProviderVersion(ctx context.Context, namesp
 	return p, nil
 }
 
-func (a *ArtifactRegistryGeneric) GetProviderAsset(ctx context.Context, repo string, fileName string) (io.ReadCloser, error) {
-	u := fmt.Sprintf("%s/repositories/%s/files/%s:download", a.scope, repo, fileName)
-	r, err := a.downloader.Download(ctx, u)
-	if err != nil {
-		return nil, fmt.Errorf("failed to download %s: %w", fileName, err)
-	}
-	return r, nil
-}
-
-func (a *ArtifactRegistryGeneric) ListModuleVersions(ctx context.Context, namespace, name, system string) ([]*model.ModuleVersion, error) {
-	logger := logging.FromContext(ctx)
-
-	repo, pkg := namespace, modulePkg(name, system)
-	pageToken := ""
-	var vs []*model.ModuleVersion
-
-	for {
-		req := &arpb.ListVersionsRequest{
-			Parent:    fmt.Sprintf("%s/repositories/%s/packages/%s", a.scope, repo, pkg),
-			PageSize:  1000,
-			PageToken: pageToken,
-		}
-		iter := a.client.ListVersions(ctx, req)
-
-		for v, err := range iter.All() {
-			if err != nil {
-				return nil, fmt.Errorf("failed to iterate over versions: %w", err)
-			}
-
-			logger.DebugContext(ctx, "ListModuleVersions found version", "version", v.Name)
-
-			version := path.Base(v.Name)
-			vs = append(vs, &model.ModuleVersion{
-				Version:   version,
-				SourceURL: fmt.Sprintf("/download/module/%s/asset/%s", repo, moduleFileName(pkg, version)),
-			})
-		}
-
-		if iter.PageInfo().Token == "" {
-			break
-		}
-		pageToken = iter.PageInfo().Token
-	}
-
-	return vs, nil
-}
-
-func (a *ArtifactRegistryGeneric) GetModuleVersion(ctx context.Context, namespace, name, system, version string) (*model.ModuleVersion, error) {
-	repo, pkg := namespace, modulePkg(name, system)
-	return &model.ModuleVersion{
-		Version:   version,
-		SourceURL: fmt.Sprintf("/download/module/%s/asset/%s", repo, moduleFileName(pkg, version)),
-	}, nil
-}
-
-func (a *ArtifactRegistryGeneric) parseSHASumFile(ctx context.Context, repo, fileName string) (map[string]string, error) {
-	u := fmt.Sprintf("%s/repositories/%s/files/%s:download", a.scope, repo, fileName)
-	r, err := a.downloader.Download(ctx, u)
+func parseSHASumFile(ctx context.Context, open openFunc, fileName string) (map[string]string, error) {
+	r, err := open(ctx, fileName)
 	if err != nil {
-		return nil, fmt.Errorf("failed to download %s: %w", fileName, err)
+		return nil, err
 	}
 	defer r.Close()
 
@@ -228,20 +687,25 @@ func (a *ArtifactRegistryGeneric) parseSHASumFile(ctx context.Context, repo, fil
 	for scanner.Scan() {
 		line := scanner.Text()
 		parts := strings.Fields(line)
+		if len(parts) != 2 {
+			continue
+		}
 
 		hash := parts[0]
 		fn := parts[1]
 
 		sums[fn] = hash
 	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
 	return sums, nil
 }
 
-func (a *ArtifactRegistryGeneric) parseGPGKeys(ctx context.Context, namespace, fileName string) ([]model.GpgPublicKeys, error) {
-	u := fmt.Sprintf("%s/repositories/%s/files/%s:download", a.scope, namespace, fileName)
-	r, err := a.downloader.Download(ctx, u)
+func parseGPGKeys(ctx context.Context, open openFunc, fileName string) ([]model.GpgPublicKeys, error) {
+	r, err := open(ctx, fileName)
 	if err != nil {
-		return nil, fmt.Errorf("failed to download %s: %w", fileName, err)
+		return nil, err
 	}
 	defer r.Close()
 
@@ -278,12 +742,68 @@ func findSHA(shaSums map[string]string, fileName string) (string, string, error)
 	return "", "", fmt.Errorf("failed to find SHA for %q", fileName)
 }
 
-func providerFileNamePrefix(pkg, fullVer, version string) string {
-	return fmt.Sprintf("%s:%s:terraform-provider-%s_%s", pkg, fullVer, pkg, version)
+func providerAssetURL(namespace, fileName string) string {
+	return fmt.Sprintf("/download/provider/%s/asset/%s", namespace, fileName)
 }
 
-func moduleFileName(pkg, version string) string {
-	return fmt.Sprintf("%s:%s:module-archive.tar.gz", pkg, version)
+func providerFileNamePrefix(pkg, name, fullVer, version string) string {
+	return fmt.Sprintf("%s:%s:terraform-provider-%s_%s", pkg, fullVer, name, version)
+}
+
+// moduleSubdirAnnotation is the version annotation holding the path of the
+// module inside its archive.
+const moduleSubdirAnnotation = "terraform.subdir"
+
+// moduleArchiveFormats are the supported module archive extensions, in order
+// of preference, with the go-getter archive hint for each.
+var moduleArchiveFormats = []struct {
+	ext  string
+	hint string
+}{
+	{ext: "tar.gz", hint: "tar.gz"},
+	{ext: "tgz", hint: "tgz"},
+	{ext: "zip", hint: "zip"},
+}
+
+// moduleArchiveExt returns the file extension of an archive format.
+func moduleArchiveExt(format string) (string, bool) {
+	for _, f := range moduleArchiveFormats {
+		if f.hint == format {
+			return f.ext, true
+		}
+	}
+	return "", false
+}
+
+func moduleFileName(pkg, version, ext string) string {
+	return fmt.Sprintf("%s:%s:module-archive.%s", pkg, version, ext)
+}
+
+// moduleMetadataFile holds the metadata extracted from a module version's
+// archive when it's published.
+const moduleMetadataFile = "module-metadata.json"
+
+func moduleMetadataFileName(pkg, version string) string {
+	return fmt.Sprintf("%s:%s:%s", pkg, version, moduleMetadataFile)
+}
+
+// findModuleArchive picks the module archive for the version among the given
+// file names. It falls back to the tar.gz name if none is found.
+func findModuleArchive(files []string, pkg, version string) (string, string) {
+	for _, f := range moduleArchiveFormats {
+		fn := moduleFileName(pkg, version, f.ext)
+		if slices.Contains(files, fn) {
+			return fn, f.hint
+		}
+	}
+	f := moduleArchiveFormats[0]
+	return moduleFileName(pkg, version, f.ext), f.hint
+}
+
+// moduleSourceURL is the X-Terraform-Get value for a module archive. The
+// archive hint tells go-getter how to unpack it regardless of the file name.
+func moduleSourceURL(namespace, fileName, hint string) string {
+	return fmt.Sprintf("/download/module/%s/archive/%s?archive=%s", namespace, fileName, hint)
 }
 
 func mapVersions(fullVersions []string) (*model.ProviderVersions, error) {
@@ -313,6 +833,90 @@ func mapVersions(fullVersions []string) (*model.ProviderVersions, error) {
 	return vs, merr
 }
 
+// yankedAnnotation marks versions left out of version listings.
+const yankedAnnotation = "terraform.yanked"
+
+func isYanked(v *arpb.Version) bool {
+	return v.GetAnnotations()[yankedAnnotation] == "true"
+}
+
+// withoutYanked drops the platform versions of every provider version with a
+// yanked platform, so versions published for more platforms after being
+// yanked stay hidden.
+func withoutYanked(fullVersions, yanked []string) []string {
+	if len(yanked) == 0 {
+		return fullVersions
+	}
+	hidden := make(map[string]bool, len(yanked))
+	for _, v := range yanked {
+		hidden[storedVersionOf(model.KindProvider, v)] = true
+	}
+	return slices.DeleteFunc(slices.Clone(fullVersions), func(v string) bool {
+		return hidden[storedVersionOf(model.KindProvider, v)]
+	})
+}
+
+// storedVersionOf returns the version a stored version belongs to, i.e. the
+// version of a provider platform version.
+func storedVersionOf(kind, stored string) string {
+	if kind != model.KindProvider {
+		return stored
+	}
+	version, _, _, err := parseFullVersion(stored)
+	if err != nil {
+		return ""
+	}
+	return version
+}
+
+// versionInfos groups the stored versions of a package, given with whether
+// each is yanked, newest first. A provider version is yanked if any of its
+// platforms is.
+func versionInfos(kind string, stored map[string]bool) []*model.VersionInfo {
+	m := make(map[string]*model.VersionInfo)
+	for name, yanked := range stored {
+		version := storedVersionOf(kind, name)
+		if version == "" {
+			continue
+		}
+		info, ok := m[version]
+		if !ok {
+			info = &model.VersionInfo{Version: version}
+			m[version] = info
+		}
+		info.Yanked = info.Yanked || yanked
+		if kind == model.KindProvider {
+			_, os, arch, _ := parseFullVersion(name)
+			info.Platforms = append(info.Platforms, model.Platform{OS: os, Arch: arch})
+		}
+	}
+
+	infos := slices.Collect(maps.Values(m))
+	for _, info := range infos {
+		slices.SortFunc(info.Platforms, func(a, b model.Platform) int {
+			return strings.Compare(a.OS+"_"+a.Arch, b.OS+"_"+b.Arch)
+		})
+	}
+	slices.SortFunc(infos, func(a, b *model.VersionInfo) int {
+		if c := semver.Compare("v"+b.Version, "v"+a.Version); c != 0 {
+			return c
+		}
+		return strings.Compare(a.Version, b.Version)
+	})
+	return infos
+}
+
+// statusError marks Artifact Registry errors with the model's errors.
+func statusError(err error) error {
+	switch status.Code(err) {
+	case codes.NotFound:
+		return fmt.Errorf("%w: %w", model.ErrNotFound, err)
+	case codes.AlreadyExists:
+		return fmt.Errorf("%w: %w", model.ErrAlreadyExists, err)
+	}
+	return err
+}
+
 func fullVersion(version, os, arch string) string {
 	return fmt.Sprintf("%s-%s-%s", version, os, arch)
 }
@@ -321,10 +925,24 @@ func modulePkg(name, system string) string {
 	return fmt.Sprintf("terraform-%s-%s", system, name)
 }
 
+// parseFullVersion splits "<version>-<os>-<arch>". The version may itself
+// contain dashes, e.g. "1.0.0-beta1".
 func parseFullVersion(version string) (string, string, string, error) {
-	parts := strings.Split(version, "-")
-	if len(parts) != 3 {
+	rest, arch, ok := cutLast(version, "-")
+	if !ok {
 		return "", "", "", fmt.Errorf("invalid version format: %s", version)
 	}
-	return parts[0], parts[1], parts[2], nil
+	v, os, ok := cutLast(rest, "-")
+	if !ok || v == "" || os == "" || arch == "" {
+		return "", "", "", fmt.Errorf("invalid version format: %s", version)
+	}
+	return v, os, arch, nil
+}
+
+func cutLast(s, sep string) (string, string, bool) {
+	i := strings.LastIndex(s, sep)
+	if i < 0 {
+		return s, "", false
+	}
+	return s[:i], s[i+len(sep):], true
 }
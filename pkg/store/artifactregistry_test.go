@@ -0,0 +1,103 @@
+package store
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/ProtonMail/go-crypto/openpgp/armor"
+	openpgp "github.com/ProtonMail/go-crypto/openpgp/v2"
+)
+
+// benchPlatforms are the platforms published for every benchmark version.
+var benchPlatforms = [][2]string{{"linux", "amd64"}, {"linux", "arm64"}, {"darwin", "amd64"}, {"darwin", "arm64"}}
+
+// newProviderFixture seeds a filesystem store, which uses the Artifact
+// Registry file naming, with versions of the "demo" provider in namespace
+// "acme".
+func newProviderFixture(tb testing.TB, versions int) *Filesystem {
+	tb.Helper()
+
+	signer, err := openpgp.NewEntity("bench", "", "bench@example.com", nil)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	var key bytes.Buffer
+	w, err := armor.Encode(&key, openpgp.PublicKeyType, nil)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	if err := signer.Serialize(w); err != nil {
+		tb.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		tb.Fatal(err)
+	}
+
+	fs, err := NewFilesystem(&FilesystemConfig{Root: tb.TempDir()})
+	if err != nil {
+		tb.Fatal(err)
+	}
+	ctx := context.Background()
+	for i := range versions {
+		version := fmt.Sprintf("1.%d.0", i)
+		prefix := "terraform-provider-demo_" + version
+		var sums bytes.Buffer
+		for _, pl := range benchPlatforms {
+			fmt.Fprintf(&sums, "%064x  %s_%s_%s.zip\n", i, prefix, pl[0], pl[1])
+		}
+		for _, pl := range benchPlatforms {
+			files := map[string][]byte{
+				fmt.Sprintf("%s_%s_%s.zip", prefix, pl[0], pl[1]): []byte("zip"),
+				prefix + "_SHA256SUMS":                            sums.Bytes(),
+				prefix + "_SHA256SUMS.sig":                        []byte("sig"),
+				prefix + "_gpg-public-key.pem":                    key.Bytes(),
+			}
+			for name, b := range files {
+				if err := fs.PutProviderFile(ctx, "acme", "demo", version, pl[0], pl[1], name, bytes.NewReader(b)); err != nil {
+					tb.Fatal(err)
+				}
+			}
+		}
+	}
+	return fs
+}
+
+// BenchmarkGetProviderVersion measures resolving a provider download. The
+// "round trip" case adds a fixed latency to every file read, like a remote
+// backend, so fetching SHA256SUMS and the key concurrently shows.
+func BenchmarkGetProviderVersion(b *testing.B) {
+	ctx := context.Background()
+	fs := newProviderFixture(b, 50)
+
+	b.Run("filesystem", func(b *testing.B) {
+		for range b.N {
+			if _, err := fs.GetProviderVersion(ctx, "acme", "demo", "1.25.0", "linux", "arm64"); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+
+	b.Run("round trip", func(b *testing.B) {
+		const latency = 2 * time.Millisecond
+		pkg, fullVer := fs.mapping.ProviderPkg("acme", "demo"), fullVersion("1.25.0", "linux", "arm64")
+		files, err := fs.readDir(false, fs.mapping.Repository("acme"), pkg, fullVer)
+		if err != nil {
+			b.Fatal(err)
+		}
+		open := func(ctx context.Context, fileName string) (io.ReadCloser, error) {
+			time.Sleep(latency)
+			return fs.GetProviderAsset(ctx, "acme", fileName)
+		}
+
+		b.ResetTimer()
+		for range b.N {
+			if _, err := resolveProvider(ctx, "acme", "demo", pkg, "1.25.0", "linux", "arm64", files, open); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
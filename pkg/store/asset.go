@@ -0,0 +1,75 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// openAtFunc opens content at an offset.
+type openAtFunc func(ctx context.Context, offset int64) (io.ReadCloser, error)
+
+// rangeReader is a seekable view of remote content of known size. Seeking is
+// free; the content is (re)opened at the current offset on the next Read, so
+// serving a range only transfers the requested bytes.
+type rangeReader struct {
+	ctx    context.Context
+	open   openAtFunc
+	size   int64
+	offset int64
+	body   io.ReadCloser
+}
+
+func newRangeReader(ctx context.Context, size int64, open openAtFunc) *rangeReader {
+	return &rangeReader{ctx: ctx, open: open, size: size}
+}
+
+func (r *rangeReader) Read(p []byte) (int, error) {
+	if r.offset >= r.size {
+		return 0, io.EOF
+	}
+	if r.body == nil {
+		body, err := r.open(r.ctx, r.offset)
+		if err != nil {
+			return 0, err
+		}
+		r.body = body
+	}
+	n, err := r.body.Read(p)
+	r.offset += int64(n)
+	if errors.Is(err, io.EOF) && r.offset < r.size {
+		err = io.ErrUnexpectedEOF
+	}
+	return n, err
+}
+
+func (r *rangeReader) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekStart:
+	case io.SeekCurrent:
+		offset += r.offset
+	case io.SeekEnd:
+		offset += r.size
+	default:
+		return 0, fmt.Errorf("invalid whence %d", whence)
+	}
+	if offset < 0 {
+		return 0, fmt.Errorf("negative offset %d", offset)
+	}
+	if offset != r.offset && r.body != nil {
+		r.body.Close()
+		r.body = nil
+	}
+	r.offset = offset
+	return offset, nil
+}
+
+func (r *rangeReader) Close() error {
+	if r.body == nil {
+		return nil
+	}
+	err := r.body.Close()
+	r.body = nil
+	return err
+}
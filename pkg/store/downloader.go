@@ -2,46 +2,187 @@ package store
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
+	"strconv"
+	"strings"
+	"time"
 
+	"github.com/abcxyz/pkg/logging"
+	"golang.org/x/oauth2"
 	"golang.org/x/oauth2/google"
 )
 
+// maxErrorBody is how much of an error response is kept for the error message.
+const maxErrorBody = 4 << 10
+
 type Downloader struct {
 	client *http.Client
+	ts     oauth2.TokenSource
+	retry  RetryConfig
+}
+
+// DownloadError is returned for responses other than 200 OK.
+type DownloadError struct {
+	StatusCode int
+	// Body is the beginning of the response body, usually the Artifact
+	// Registry error payload.
+	Body string
+
+	retryAfter time.Duration
 }
 
-func NewDownloader(ctx context.Context) (*Downloader, error) {
+func (e *DownloadError) Error() string {
+	if e.Body == "" {
+		return fmt.Sprintf("unexpected download status code: %d", e.StatusCode)
+	}
+	return fmt.Sprintf("unexpected download status code: %d: %s", e.StatusCode, e.Body)
+}
+
+func NewDownloader(ctx context.Context, retry *RetryConfig) (*Downloader, error) {
 	// Create an HTTP client with the credentials
-	client, err := google.DefaultClient(ctx, "https://www.googleapis.com/auth/cloud-platform")
+	ts, err := google.DefaultTokenSource(ctx, "https://www.googleapis.com/auth/cloud-platform")
 	if err != nil {
 		return nil, fmt.Errorf("failed to create authenticated client: %w", err)
 	}
 
 	return &Downloader{
-		client: client,
+		client: oauth2.NewClient(ctx, ts),
+		ts:     ts,
+		retry:  retry.withDefaults(),
 	}, nil
 }
 
+// CheckHealth verifies the downloader can obtain an access token. The token
+// source caches tokens, so this is cheap once a token has been minted.
+func (d *Downloader) CheckHealth(ctx context.Context) error {
+	if _, err := d.ts.Token(); err != nil {
+		return fmt.Errorf("failed to get access token: %w", err)
+	}
+	return nil
+}
+
+// Download opens the file, retrying transient failures with exponential
+// backoff. The caller must close the returned body.
 func (d *Downloader) Download(ctx context.Context, fullFileName string) (io.ReadCloser, error) {
-	url := fmt.Sprintf("https://artifactregistry.googleapis.com/download/v1/%s", fullFileName)
-	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	return d.DownloadFrom(ctx, fullFileName, 0)
+}
+
+// DownloadFrom is like Download but starts reading at offset.
+func (d *Downloader) DownloadFrom(ctx context.Context, fullFileName string, offset int64) (io.ReadCloser, error) {
+	logger := logging.FromContext(ctx)
+
+	var lastErr error
+	for attempt := 1; attempt <= d.retry.MaxAttempts; attempt++ {
+		if attempt > 1 {
+			pause := d.retry.backoff(attempt - 1)
+			var de *DownloadError
+			if errors.As(lastErr, &de) {
+				pause = max(pause, min(de.retryAfter, d.retry.MaxBackoff))
+			}
+			logger.DebugContext(ctx, "retrying download",
+				"file", fullFileName,
+				"attempt", attempt,
+				"pause", pause,
+				"error", lastErr)
+
+			select {
+			case <-ctx.Done():
+				return nil, fmt.Errorf("download cancelled after %d attempts: %w", attempt-1, errors.Join(ctx.Err(), lastErr))
+			case <-time.After(pause):
+			}
+		}
+
+		body, retryable, err := d.download(ctx, fullFileName, offset)
+		if err == nil {
+			return body, nil
+		}
+		lastErr = err
+		if !retryable {
+			break
+		}
+	}
+	return nil, lastErr
+}
+
+// download makes one attempt. It reports whether a failure is transient.
+func (d *Downloader) download(parent context.Context, fullFileName string, offset int64) (io.ReadCloser, bool, error) {
+	// The timeout only covers waiting for the response; once the body streams
+	// it is bounded by the caller's context.
+	ctx, cancel := context.WithCancel(parent)
+	timer := time.AfterFunc(d.retry.Timeout, cancel)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, downloadURL(fullFileName), nil)
 	if err != nil {
-		return nil, fmt.Errorf("failed to create download request: %w", err)
+		timer.Stop()
+		cancel()
+		return nil, false, fmt.Errorf("failed to create download request: %w", err)
+	}
+	if offset > 0 {
+		req.Header.Set("Range", fmt.Sprintf("bytes=%d-", offset))
 	}
 
 	// Execute request with authenticated client
 	resp, err := d.client.Do(req)
+	if timedOut := !timer.Stop(); timedOut && parent.Err() == nil {
+		if err == nil {
+			resp.Body.Close()
+		}
+		cancel()
+		return nil, true, fmt.Errorf("download request timed out after %s", d.retry.Timeout)
+	}
 	if err != nil {
-		return nil, fmt.Errorf("failed to execute download request: %w", err)
+		cancel()
+		return nil, retryableError(parent, err), fmt.Errorf("failed to execute download request: %w", err)
 	}
 
 	// Check response status
-	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("unexpected download status code: %d", resp.StatusCode)
+	body := &cancelOnClose{ReadCloser: resp.Body, cancel: cancel}
+	switch {
+	case resp.StatusCode == http.StatusPartialContent && offset > 0:
+		return body, false, nil
+	case resp.StatusCode == http.StatusOK && offset > 0:
+		// The range was ignored; skip to the offset.
+		if _, err := io.CopyN(io.Discard, body, offset); err != nil {
+			body.Close()
+			return nil, retryableError(parent, err), fmt.Errorf("failed to skip to offset %d: %w", offset, err)
+		}
+		return body, false, nil
+	case resp.StatusCode != http.StatusOK:
+		defer cancel()
+		defer resp.Body.Close()
+
+		// Drain a bounded amount so the connection can be reused and the error
+		// payload can be reported.
+		b, _ := io.ReadAll(io.LimitReader(resp.Body, maxErrorBody))
+		io.Copy(io.Discard, io.LimitReader(resp.Body, maxErrorBody))
+
+		de := &DownloadError{
+			StatusCode: resp.StatusCode,
+			Body:       strings.TrimSpace(string(b)),
+		}
+		if secs, err := strconv.Atoi(resp.Header.Get("Retry-After")); err == nil && secs > 0 {
+			de.retryAfter = time.Duration(secs) * time.Second
+		}
+		return nil, retryableStatus(resp.StatusCode), de
 	}
 
-	return resp.Body, nil
+	return body, false, nil
+}
+
+// cancelOnClose releases the request context when the body is closed.
+type cancelOnClose struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func (c *cancelOnClose) Close() error {
+	defer c.cancel()
+	return c.ReadCloser.Close()
+}
+
+func downloadURL(fullFileName string) string {
+	return fmt.Sprintf("https://artifactregistry.googleapis.com/download/v1/%s", fullFileName)
 }
@@ -0,0 +1,561 @@
+package store
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/abcxyz/pkg/logging"
+
+	"github.com/yolocs/ar-terraform-registry/pkg/model"
+)
+
+// moduleSubdirFile is the per-version file holding the path of the module
+// inside its archive, the filesystem equivalent of moduleSubdirAnnotation.
+const moduleSubdirFile = "module-subdir"
+
+// providerHashFile is the per-version file caching the "h1:" hash of a
+// provider platform package, the equivalent of providerHashAnnotation.
+const providerHashFile = "package-hash-h1"
+
+// yankedFile is the per-version marker of yanked versions, the equivalent of
+// yankedAnnotation.
+const yankedFile = "yanked"
+
+type FilesystemConfig struct {
+	// Root is the directory holding the repositories.
+	Root    string
+	Mapping *Mapping
+}
+
+// Filesystem is a store backed by a local directory laid out like an Artifact
+// Registry project: <root>/<repo>/<package>/<version>/<file>, where files use
+// the same "<package>:<version>:<name>" naming scheme.
+type Filesystem struct {
+	root    string
+	mapping *Mapping
+}
+
+func NewFilesystem(cfg *FilesystemConfig) (*Filesystem, error) {
+	fi, err := os.Stat(cfg.Root)
+	if err != nil {
+		return nil, fmt.Errorf("failed to stat filesystem store root: %w", err)
+	}
+	if !fi.IsDir() {
+		return nil, fmt.Errorf("filesystem store root %q is not a directory", cfg.Root)
+	}
+	if err := cfg.Mapping.Validate(); err != nil {
+		return nil, err
+	}
+	return &Filesystem{root: cfg.Root, mapping: cfg.Mapping}, nil
+}
+
+// CheckHealth verifies the root directory is still readable.
+func (f *Filesystem) CheckHealth(ctx context.Context) error {
+	if _, err := os.ReadDir(f.root); err != nil {
+		return fmt.Errorf("failed to read filesystem store root: %w", err)
+	}
+	return nil
+}
+
+// ListNamespaces lists the namespaces of the repository directories.
+func (f *Filesystem) ListNamespaces(ctx context.Context) ([]string, error) {
+	entries, err := os.ReadDir(f.root)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read filesystem store root: %w", err)
+	}
+	var namespaces []string
+	for _, e := range entries {
+		if e.IsDir() && !strings.HasPrefix(e.Name(), ".") {
+			namespaces = append(namespaces, f.mapping.Namespace(e.Name()))
+		}
+	}
+	return namespaces, nil
+}
+
+func (f *Filesystem) ListPackages(ctx context.Context, namespace string) ([]*model.PackageRef, error) {
+	pkgs, err := f.readDir(true, f.mapping.Repository(namespace))
+	if err != nil {
+		return nil, err
+	}
+	var refs []*model.PackageRef
+	for _, pkg := range pkgs {
+		if ref, ok := f.mapping.ParsePackage(namespace, pkg); ok {
+			refs = append(refs, ref)
+		}
+	}
+	return refs, nil
+}
+
+func (f *Filesystem) ListProviderVersions(ctx context.Context, namespace string, name string) (*model.ProviderVersions, error) {
+	logger := logging.FromContext(ctx)
+
+	repo, pkg := f.mapping.Repository(namespace), f.mapping.ProviderPkg(namespace, name)
+	fullVersions, err := f.readDir(true, repo, pkg)
+	if err != nil {
+		return nil, err
+	}
+	var yanked []string
+	for _, v := range fullVersions {
+		if f.isYanked(repo, pkg, v) {
+			yanked = append(yanked, v)
+		}
+	}
+
+	vs, err := mapVersions(withoutYanked(fullVersions, yanked))
+	if err != nil {
+		logger.ErrorContext(ctx, "ListProviderVersions found unrecognized version names", "error", err)
+	}
+	return vs, nil
+}
+
+func (f *Filesystem) GetProviderVersion(ctx context.Context, namespace string, name string, version string, os string, arch string) (*model.Provider, error) {
+	repo, pkg := f.mapping.Repository(namespace), f.mapping.ProviderPkg(namespace, name)
+	files, err := f.readDir(false, repo, pkg, fullVersion(version, os, arch))
+	if err != nil {
+		return nil, err
+	}
+
+	return resolveProvider(ctx, namespace, name, pkg, version, os, arch, files, func(ctx context.Context, fileName string) (io.ReadCloser, error) {
+		return f.GetProviderAsset(ctx, namespace, fileName)
+	})
+}
+
+func (f *Filesystem) GetProviderAsset(ctx context.Context, namespace string, fileName string) (io.ReadCloser, error) {
+	file, err := f.openFile(f.mapping.Repository(namespace), fileName)
+	if err != nil {
+		return nil, err
+	}
+	return file, nil
+}
+
+// ProviderPackageHash returns the cached hash, or computes and caches it.
+func (f *Filesystem) ProviderPackageHash(ctx context.Context, namespace, name, version, os, arch string) (string, error) {
+	logger := logging.FromContext(ctx)
+
+	repo, pkg := f.mapping.Repository(namespace), f.mapping.ProviderPkg(namespace, name)
+	fullVer := fullVersion(version, os, arch)
+	elem := []string{repo, pkg, fullVer, fmt.Sprintf("%s:%s:%s", pkg, fullVer, providerHashFile)}
+
+	p, err := f.path(elem...)
+	if err != nil {
+		return "", err
+	}
+	if b, err := readFileIfExists(p); err != nil {
+		return "", err
+	} else if h := strings.TrimSpace(string(b)); h != "" {
+		return h, nil
+	}
+
+	h, err := packageHashV1(ctx, func(ctx context.Context, fileName string) (io.ReadCloser, error) {
+		return f.GetProviderAsset(ctx, namespace, fileName)
+	}, providerBinaryName(pkg, name, version, os, arch))
+	if err != nil {
+		return "", err
+	}
+	if err := f.writeFile(strings.NewReader(h), elem...); err != nil && !errors.Is(err, model.ErrAlreadyExists) {
+		logger.WarnContext(ctx, "failed to cache provider package hash", "version", fullVer, "error", err)
+	}
+	return h, nil
+}
+
+func (f *Filesystem) ListModuleVersions(ctx context.Context, namespace, name, system string) ([]*model.ModuleVersion, error) {
+	repo, pkg := f.mapping.Repository(namespace), f.mapping.ModulePkg(namespace, name, system)
+	versions, err := f.readDir(true, repo, pkg)
+	if err != nil {
+		return nil, err
+	}
+
+	vs := make([]*model.ModuleVersion, 0, len(versions))
+	for _, version := range versions {
+		if f.isYanked(repo, pkg, version) {
+			continue
+		}
+		v, err := f.moduleVersion(namespace, pkg, version)
+		if err != nil {
+			return nil, err
+		}
+		vs = append(vs, v)
+	}
+	return vs, nil
+}
+
+func (f *Filesystem) GetModuleVersion(ctx context.Context, namespace, name, system, version string) (*model.ModuleVersion, error) {
+	return f.moduleVersion(namespace, f.mapping.ModulePkg(namespace, name, system), version)
+}
+
+func (f *Filesystem) GetModuleArchive(ctx context.Context, namespace, fileName string) (io.ReadCloser, error) {
+	file, err := f.openFile(f.mapping.Repository(namespace), fileName)
+	if err != nil {
+		return nil, err
+	}
+	return file, nil
+}
+
+func (f *Filesystem) OpenProviderAsset(ctx context.Context, namespace, fileName string) (*model.Asset, error) {
+	return f.openAsset(f.mapping.Repository(namespace), fileName)
+}
+
+func (f *Filesystem) OpenModuleArchive(ctx context.Context, namespace, fileName string) (*model.Asset, error) {
+	return f.openAsset(f.mapping.Repository(namespace), fileName)
+}
+
+func (f *Filesystem) PutProviderFile(ctx context.Context, namespace, name, version, os, arch, fileName string, r io.Reader) error {
+	pkg, fullVer := f.mapping.ProviderPkg(namespace, name), fullVersion(version, os, arch)
+	return f.writeFile(r, f.mapping.Repository(namespace), pkg, fullVer, fmt.Sprintf("%s:%s:%s", pkg, fullVer, fileName))
+}
+
+func (f *Filesystem) PutModuleArchive(ctx context.Context, namespace, name, system, version, format, subdir string, r io.Reader) error {
+	ext, ok := moduleArchiveExt(format)
+	if !ok {
+		return fmt.Errorf("unsupported module archive format %q", format)
+	}
+	repo, pkg := f.mapping.Repository(namespace), f.mapping.ModulePkg(namespace, name, system)
+	if err := f.writeFile(r, repo, pkg, version, moduleFileName(pkg, version, ext)); err != nil {
+		return err
+	}
+	if subdir == "" {
+		return nil
+	}
+	return f.writeFile(strings.NewReader(subdir), repo, pkg, version, fmt.Sprintf("%s:%s:%s", pkg, version, moduleSubdirFile))
+}
+
+func (f *Filesystem) PutModuleMetadata(ctx context.Context, namespace, name, system, version string, md *model.ModuleMetadata) error {
+	b, err := json.Marshal(md)
+	if err != nil {
+		return fmt.Errorf("failed to marshal module metadata: %w", err)
+	}
+	repo, pkg := f.mapping.Repository(namespace), f.mapping.ModulePkg(namespace, name, system)
+	return f.writeFile(bytes.NewReader(b), repo, pkg, version, moduleMetadataFileName(pkg, version))
+}
+
+func (f *Filesystem) GetModuleMetadata(ctx context.Context, namespace, name, system, version string) (*model.ModuleMetadata, error) {
+	repo, pkg := f.mapping.Repository(namespace), f.mapping.ModulePkg(namespace, name, system)
+	p, err := f.path(repo, pkg, version, moduleMetadataFileName(pkg, version))
+	if err != nil {
+		return nil, err
+	}
+	b, err := os.ReadFile(p)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("metadata of %s: %w", version, model.ErrNotFound)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read module metadata: %w", err)
+	}
+	var md model.ModuleMetadata
+	if err := json.Unmarshal(b, &md); err != nil {
+		return nil, fmt.Errorf("failed to parse module metadata: %w", err)
+	}
+	return &md, nil
+}
+
+// CreateNamespace creates the repository directory of the namespace.
+func (f *Filesystem) CreateNamespace(ctx context.Context, namespace string) error {
+	p, err := f.path(f.mapping.Repository(namespace))
+	if err != nil {
+		return err
+	}
+	if err := os.Mkdir(p, 0o755); err != nil {
+		if errors.Is(err, os.ErrExist) {
+			return fmt.Errorf("namespace %q: %w", namespace, model.ErrAlreadyExists)
+		}
+		return fmt.Errorf("failed to create namespace %q: %w", namespace, err)
+	}
+	return nil
+}
+
+func (f *Filesystem) ListVersions(ctx context.Context, namespace string, ref *model.PackageRef) ([]*model.VersionInfo, error) {
+	repo, pkg := f.mapping.Repository(namespace), f.mapping.Package(namespace, ref)
+	versions, err := f.readDir(true, repo, pkg)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("package %s: %w", pkg, model.ErrNotFound)
+	}
+	if err != nil {
+		return nil, err
+	}
+	stored := make(map[string]bool, len(versions))
+	for _, v := range versions {
+		stored[v] = f.isYanked(repo, pkg, v)
+	}
+	return versionInfos(ref.Kind, stored), nil
+}
+
+func (f *Filesystem) ListVersionFiles(ctx context.Context, namespace string, ref *model.PackageRef, version string) ([]*model.FileInfo, error) {
+	repo, pkg := f.mapping.Repository(namespace), f.mapping.Package(namespace, ref)
+	versions, err := f.versions(repo, pkg, ref.Kind, version)
+	if err != nil {
+		return nil, err
+	}
+	var files []*model.FileInfo
+	for _, v := range versions {
+		p, err := f.path(repo, pkg, v)
+		if err != nil {
+			return nil, err
+		}
+		entries, err := os.ReadDir(p)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %s/%s/%s: %w", repo, pkg, v, err)
+		}
+		for _, e := range entries {
+			// Skip uploads in progress.
+			if !e.Type().IsRegular() || strings.HasPrefix(e.Name(), ".") {
+				continue
+			}
+			fi, err := e.Info()
+			if err != nil {
+				return nil, fmt.Errorf("failed to stat %s: %w", e.Name(), err)
+			}
+			files = append(files, &model.FileInfo{Name: e.Name(), Size: fi.Size(), ModTime: fi.ModTime()})
+		}
+	}
+	slices.SortFunc(files, func(a, b *model.FileInfo) int { return strings.Compare(a.Name, b.Name) })
+	return files, nil
+}
+
+func (f *Filesystem) DeletePackage(ctx context.Context, namespace string, ref *model.PackageRef) error {
+	p, err := f.path(f.mapping.Repository(namespace), f.mapping.Package(namespace, ref))
+	if err != nil {
+		return err
+	}
+	if _, err := os.Stat(p); errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("package %s: %w", filepath.Base(p), model.ErrNotFound)
+	}
+	if err := os.RemoveAll(p); err != nil {
+		return fmt.Errorf("failed to delete package %s: %w", filepath.Base(p), err)
+	}
+	return nil
+}
+
+// DeleteVersion deletes the version directory, or every platform version
+// directory of a provider version.
+func (f *Filesystem) DeleteVersion(ctx context.Context, namespace string, ref *model.PackageRef, version string) error {
+	repo, pkg := f.mapping.Repository(namespace), f.mapping.Package(namespace, ref)
+	versions, err := f.versions(repo, pkg, ref.Kind, version)
+	if err != nil {
+		return err
+	}
+	for _, v := range versions {
+		p, err := f.path(repo, pkg, v)
+		if err != nil {
+			return err
+		}
+		if err := os.RemoveAll(p); err != nil {
+			return fmt.Errorf("failed to delete version %s: %w", v, err)
+		}
+	}
+	return nil
+}
+
+// SetYanked creates or removes the yanked marker of the version, or of every
+// platform version of a provider version.
+func (f *Filesystem) SetYanked(ctx context.Context, namespace string, ref *model.PackageRef, version string, yanked bool) error {
+	repo, pkg := f.mapping.Repository(namespace), f.mapping.Package(namespace, ref)
+	versions, err := f.versions(repo, pkg, ref.Kind, version)
+	if err != nil {
+		return err
+	}
+	for _, v := range versions {
+		elem := []string{repo, pkg, v, fmt.Sprintf("%s:%s:%s", pkg, v, yankedFile)}
+		if yanked {
+			if err := f.writeFile(strings.NewReader("true"), elem...); err != nil && !errors.Is(err, model.ErrAlreadyExists) {
+				return err
+			}
+			continue
+		}
+		p, err := f.path(elem...)
+		if err != nil {
+			return err
+		}
+		if err := os.Remove(p); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return fmt.Errorf("failed to unyank %s: %w", v, err)
+		}
+	}
+	return nil
+}
+
+// versions returns the version directories making up a version: the version
+// itself for modules, and its platform versions for providers.
+func (f *Filesystem) versions(repo, pkg, kind, version string) ([]string, error) {
+	all, err := f.readDir(true, repo, pkg)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+	var versions []string
+	for _, v := range all {
+		if storedVersionOf(kind, v) == version {
+			versions = append(versions, v)
+		}
+	}
+	if len(versions) == 0 {
+		return nil, fmt.Errorf("version %s of %s: %w", version, pkg, model.ErrNotFound)
+	}
+	return versions, nil
+}
+
+func (f *Filesystem) isYanked(repo, pkg, version string) bool {
+	p, err := f.path(repo, pkg, version, fmt.Sprintf("%s:%s:%s", pkg, version, yankedFile))
+	if err != nil {
+		return false
+	}
+	_, err = os.Lstat(p)
+	return err == nil
+}
+
+func (f *Filesystem) moduleVersion(namespace, pkg, version string) (*model.ModuleVersion, error) {
+	repo := f.mapping.Repository(namespace)
+	files, err := f.readDir(false, repo, pkg, version)
+	if err != nil {
+		return nil, err
+	}
+
+	sp, err := f.path(repo, pkg, version, fmt.Sprintf("%s:%s:%s", pkg, version, moduleSubdirFile))
+	if err != nil {
+		return nil, err
+	}
+	b, err := readFileIfExists(sp)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read module subdir: %w", err)
+	}
+	subdir := strings.TrimSpace(string(b))
+
+	fileName, hint := findModuleArchive(files, pkg, version)
+	return &model.ModuleVersion{
+		Version:   version,
+		SourceURL: moduleSourceURL(namespace, fileName, hint),
+		Subdir:    subdir,
+	}, nil
+}
+
+// openFile opens a file by its base name, which encodes the package and
+// version directory it lives in.
+func (f *Filesystem) openFile(repo, fileName string) (*os.File, error) {
+	pkg, version, _, ok := splitFileName(fileName)
+	if !ok {
+		return nil, fmt.Errorf("invalid file name %q", fileName)
+	}
+	p, err := f.path(repo, pkg, version, fileName)
+	if err != nil {
+		return nil, err
+	}
+	r, err := os.Open(p)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open %s: %w", fileName, err)
+	}
+	return r, nil
+}
+
+// openAsset opens a file with its size and modification time. Files aren't
+// hashed on every request, so SHA256 is left empty.
+func (f *Filesystem) openAsset(repo, fileName string) (*model.Asset, error) {
+	file, err := f.openFile(repo, fileName)
+	if err != nil {
+		return nil, err
+	}
+	fi, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, fmt.Errorf("failed to stat %s: %w", fileName, err)
+	}
+	if !fi.Mode().IsRegular() {
+		file.Close()
+		return nil, fmt.Errorf("%s is not a regular file", fileName)
+	}
+	return &model.Asset{ReadSeekCloser: file, Size: fi.Size(), ModTime: fi.ModTime()}, nil
+}
+
+// writeFile atomically creates the file at the path. Existing files are never
+// replaced.
+func (f *Filesystem) writeFile(r io.Reader, elem ...string) error {
+	p, err := f.path(elem...)
+	if err != nil {
+		return err
+	}
+	if _, err := os.Lstat(p); err == nil {
+		return fmt.Errorf("%s: %w", elem[len(elem)-1], model.ErrAlreadyExists)
+	}
+	dir := filepath.Dir(p)
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return fmt.Errorf("failed to create %s: %w", dir, err)
+	}
+
+	tmp, err := os.CreateTemp(dir, ".upload-*")
+	if err != nil {
+		return fmt.Errorf("failed to create temporary file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := io.Copy(tmp, r); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write %s: %w", elem[len(elem)-1], err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to write %s: %w", elem[len(elem)-1], err)
+	}
+	if err := os.Chmod(tmp.Name(), 0o644); err != nil {
+		return fmt.Errorf("failed to chmod %s: %w", elem[len(elem)-1], err)
+	}
+	// Unlike rename, link fails if the file has been created concurrently.
+	if err := os.Link(tmp.Name(), p); err != nil {
+		if errors.Is(err, os.ErrExist) {
+			return fmt.Errorf("%s: %w", elem[len(elem)-1], model.ErrAlreadyExists)
+		}
+		return fmt.Errorf("failed to create %s: %w", elem[len(elem)-1], err)
+	}
+	return nil
+}
+
+// readFileIfExists reads the file, returning no content if it doesn't exist.
+func readFileIfExists(p string) ([]byte, error) {
+	b, err := os.ReadFile(p)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+	return b, nil
+}
+
+// readDir lists the names of the directories (or files) in the given path.
+func (f *Filesystem) readDir(dirs bool, elem ...string) ([]string, error) {
+	p, err := f.path(elem...)
+	if err != nil {
+		return nil, err
+	}
+	entries, err := os.ReadDir(p)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", strings.Join(elem, "/"), err)
+	}
+
+	var names []string
+	for _, e := range entries {
+		if e.IsDir() == dirs {
+			names = append(names, e.Name())
+		}
+	}
+	return names, nil
+}
+
+// path joins the elements under the root, rejecting anything that would
+// escape it. Elements come from request paths and must be single segments.
+func (f *Filesystem) path(elem ...string) (string, error) {
+	for _, e := range elem {
+		if e == "" || e == "." || e == ".." || strings.ContainsAny(e, `/\`) {
+			return "", fmt.Errorf("invalid path element %q", e)
+		}
+	}
+	return filepath.Join(append([]string{f.root}, elem...)...), nil
+}
+
+// splitFileName splits "<package>:<version>:<name>" file names.
+func splitFileName(fileName string) (string, string, string, bool) {
+	parts := strings.SplitN(fileName, ":", 3)
+	if len(parts) != 3 || parts[0] == "" || parts[1] == "" || parts[2] == "" {
+		return "", "", "", false
+	}
+	return parts[0], parts[1], parts[2], true
+}
@@ -0,0 +1,419 @@
+package store
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/abcxyz/pkg/logging"
+	"golang.org/x/mod/semver"
+
+	"github.com/yolocs/ar-terraform-registry/pkg/model"
+)
+
+type GitConfig struct {
+	// Repos maps "<namespace>/<name>/<system>" module addresses to the git
+	// remote holding the module. Versions are read from "vX.Y.Z" tags.
+	Repos map[string]string
+	// CacheDir is where bare mirrors of the remotes are kept.
+	CacheDir string
+	// RefreshInterval is how long a mirror is used before fetching again.
+	RefreshInterval time.Duration
+	// ServeArchives makes the store hand out server-built tarballs instead of
+	// "git::" source URLs, for clients that can't reach the git remotes.
+	ServeArchives bool
+	// Fallback serves modules which are not configured in Repos. It may be nil.
+	Fallback model.ModuleStore
+}
+
+// GitModules is a module store backed by tagged git repositories. It shells
+// out to the git binary, which must be on PATH.
+type GitModules struct {
+	repos         map[string]string
+	cacheDir      string
+	refresh       time.Duration
+	serveArchives bool
+	fallback      model.ModuleStore
+
+	mu      sync.Mutex
+	mirrors map[string]*gitMirror
+}
+
+type gitMirror struct {
+	// mu is held exclusively while fetching and shared while reading, so git
+	// never reads a mirror that is being updated.
+	mu        sync.RWMutex
+	dir       string
+	remote    string
+	fetchedAt time.Time
+}
+
+func NewGitModules(cfg *GitConfig) (*GitModules, error) {
+	if cfg.CacheDir == "" {
+		return nil, fmt.Errorf("git module store requires a cache directory")
+	}
+	if err := os.MkdirAll(cfg.CacheDir, 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create git cache directory: %w", err)
+	}
+
+	repos := make(map[string]string, len(cfg.Repos))
+	for k, v := range cfg.Repos {
+		if strings.Count(k, "/") != 2 {
+			return nil, fmt.Errorf("invalid git module address %q, want <namespace>/<name>/<system>", k)
+		}
+		repos[k] = v
+	}
+
+	return &GitModules{
+		repos:         repos,
+		cacheDir:      cfg.CacheDir,
+		refresh:       cfg.RefreshInterval,
+		serveArchives: cfg.ServeArchives,
+		fallback:      cfg.Fallback,
+		mirrors:       make(map[string]*gitMirror),
+	}, nil
+}
+
+// CheckHealth verifies the git binary is available.
+func (g *GitModules) CheckHealth(ctx context.Context) error {
+	if _, err := runGit(ctx, "", "version"); err != nil {
+		return err
+	}
+	return nil
+}
+
+func (g *GitModules) ListModuleVersions(ctx context.Context, namespace, name, system string) ([]*model.ModuleVersion, error) {
+	remote, ok := g.repos[moduleAddr(namespace, name, system)]
+	if !ok {
+		if g.fallback == nil {
+			return nil, fmt.Errorf("module %q not found", moduleAddr(namespace, name, system))
+		}
+		return g.fallback.ListModuleVersions(ctx, namespace, name, system)
+	}
+
+	tags, err := g.tags(ctx, remote)
+	if err != nil {
+		return nil, err
+	}
+
+	vs := make([]*model.ModuleVersion, 0, len(tags))
+	for version, tag := range tags {
+		vs = append(vs, g.moduleVersion(namespace, name, system, remote, version, tag))
+	}
+	return vs, nil
+}
+
+func (g *GitModules) GetModuleVersion(ctx context.Context, namespace, name, system, version string) (*model.ModuleVersion, error) {
+	remote, ok := g.repos[moduleAddr(namespace, name, system)]
+	if !ok {
+		if g.fallback == nil {
+			return nil, fmt.Errorf("module %q not found", moduleAddr(namespace, name, system))
+		}
+		return g.fallback.GetModuleVersion(ctx, namespace, name, system, version)
+	}
+
+	tags, err := g.tags(ctx, remote)
+	if err != nil {
+		return nil, err
+	}
+	tag, ok := tags[version]
+	if !ok {
+		return nil, fmt.Errorf("version %q not found in %s", version, remote)
+	}
+	return g.moduleVersion(namespace, name, system, remote, version, tag), nil
+}
+
+// GetModuleArchive builds a tarball of the tagged tree. The file name uses the
+// same "<pkg>:<version>:module-archive.tar.gz" scheme as Artifact Registry.
+func (g *GitModules) GetModuleArchive(ctx context.Context, namespace, fileName string) (io.ReadCloser, error) {
+	remote, version, ok := g.archiveRemote(namespace, fileName)
+	if !ok {
+		if g.fallback == nil {
+			return nil, fmt.Errorf("module archive %q not found", fileName)
+		}
+		return g.fallback.GetModuleArchive(ctx, namespace, fileName)
+	}
+
+	tags, err := g.tags(ctx, remote)
+	if err != nil {
+		return nil, err
+	}
+	tag, ok := tags[version]
+	if !ok {
+		return nil, fmt.Errorf("version %q not found in %s", version, remote)
+	}
+
+	return g.mirror(remote).archive(ctx, g.cacheDir, tag)
+}
+
+// OpenModuleArchive delegates to the fallback store. Archives built from git
+// are streamed and can't be opened with metadata.
+func (g *GitModules) OpenModuleArchive(ctx context.Context, namespace, fileName string) (*model.Asset, error) {
+	if _, _, ok := g.archiveRemote(namespace, fileName); !ok {
+		if opener, ok := g.fallback.(model.ModuleArchiveOpener); ok {
+			return opener.OpenModuleArchive(ctx, namespace, fileName)
+		}
+	}
+	return nil, fmt.Errorf("can't open %q: %w", fileName, errors.ErrUnsupported)
+}
+
+// ListNamespaces adds the namespaces of git modules to those of the fallback
+// store.
+func (g *GitModules) ListNamespaces(ctx context.Context) ([]string, error) {
+	var namespaces []string
+	if c, ok := g.fallback.(model.Catalog); ok {
+		ns, err := c.ListNamespaces(ctx)
+		if err != nil {
+			return nil, err
+		}
+		namespaces = ns
+	}
+	for addr := range g.repos {
+		ns, _, _ := strings.Cut(addr, "/")
+		if !slices.Contains(namespaces, ns) {
+			namespaces = append(namespaces, ns)
+		}
+	}
+	return namespaces, nil
+}
+
+// ListPackages adds the git modules of the namespace to the packages of the
+// fallback store. Fallback errors are ignored for namespaces with git modules,
+// which may not exist in the fallback.
+func (g *GitModules) ListPackages(ctx context.Context, namespace string) ([]*model.PackageRef, error) {
+	var refs []*model.PackageRef
+	for addr := range g.repos {
+		parts := strings.Split(addr, "/")
+		if parts[0] == namespace {
+			refs = append(refs, &model.PackageRef{Kind: model.KindModule, Name: parts[1], System: parts[2]})
+		}
+	}
+	if c, ok := g.fallback.(model.Catalog); ok {
+		r, err := c.ListPackages(ctx, namespace)
+		if err != nil && len(refs) == 0 {
+			return nil, err
+		}
+		refs = append(refs, r...)
+	}
+	return refs, nil
+}
+
+// GetModuleMetadata delegates to the fallback store. Modules built from git
+// have no stored metadata.
+func (g *GitModules) GetModuleMetadata(ctx context.Context, namespace, name, system, version string) (*model.ModuleMetadata, error) {
+	if _, ok := g.repos[moduleAddr(namespace, name, system)]; ok {
+		return nil, fmt.Errorf("metadata of git module %s: %w", version, model.ErrNotFound)
+	}
+	if r, ok := g.fallback.(model.ModuleMetadataReader); ok {
+		return r.GetModuleMetadata(ctx, namespace, name, system, version)
+	}
+	return nil, fmt.Errorf("fallback store can't read metadata: %w", errors.ErrUnsupported)
+}
+
+// archiveRemote returns the remote and version of an archive built by this
+// store. Other names, including those of fallback stores with custom package
+// naming, are reported as not found.
+func (g *GitModules) archiveRemote(namespace, fileName string) (string, string, bool) {
+	pkg, version, ok := parseModuleFileName(fileName)
+	if !ok {
+		return "", "", false
+	}
+	name, system, ok := parseModulePkg(pkg)
+	if !ok {
+		return "", "", false
+	}
+	remote, ok := g.repos[moduleAddr(namespace, name, system)]
+	return remote, version, ok
+}
+
+func (g *GitModules) moduleVersion(namespace, name, system, remote, version, tag string) *model.ModuleVersion {
+	if g.serveArchives {
+		fn := moduleFileName(modulePkg(name, system), version, "tar.gz")
+		return &model.ModuleVersion{
+			Version:   version,
+			SourceURL: moduleSourceURL(namespace, fn, "tar.gz"),
+		}
+	}
+	return &model.ModuleVersion{
+		Version:   version,
+		SourceURL: gitSourceURL(remote, tag),
+	}
+}
+
+// gitSourceURL returns the "git::" source of the ref, merging the ref into the
+// query the remote may already have.
+func gitSourceURL(remote, ref string) string {
+	base, rawQuery, _ := strings.Cut(remote, "?")
+	q, err := url.ParseQuery(rawQuery)
+	if err != nil {
+		return fmt.Sprintf("git::%s&ref=%s", remote, url.QueryEscape(ref))
+	}
+	q.Set("ref", ref)
+	return fmt.Sprintf("git::%s?%s", base, q.Encode())
+}
+
+// tags returns the versions found in the remote's tags, mapped to the tag name.
+func (g *GitModules) tags(ctx context.Context, remote string) (map[string]string, error) {
+	m := g.mirror(remote)
+	if err := m.sync(ctx, g.refresh); err != nil {
+		return nil, err
+	}
+
+	m.mu.RLock()
+	out, err := runGit(ctx, m.dir, "for-each-ref", "--format=%(refname:strip=2)", "refs/tags")
+	m.mu.RUnlock()
+	if err != nil {
+		return nil, err
+	}
+
+	logger := logging.FromContext(ctx)
+	tags := make(map[string]string)
+	for _, tag := range strings.Fields(out) {
+		v := tag
+		if !strings.HasPrefix(v, "v") {
+			v = "v" + v
+		}
+		if !semver.IsValid(v) || semver.Canonical(v) != v {
+			logger.DebugContext(ctx, "ignoring non-version tag", "remote", remote, "tag", tag)
+			continue
+		}
+		tags[strings.TrimPrefix(v, "v")] = tag
+	}
+	return tags, nil
+}
+
+func (g *GitModules) mirror(remote string) *gitMirror {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	m, ok := g.mirrors[remote]
+	if !ok {
+		sum := sha256.Sum256([]byte(remote))
+		m = &gitMirror{
+			dir:    filepath.Join(g.cacheDir, hex.EncodeToString(sum[:8])+".git"),
+			remote: remote,
+		}
+		g.mirrors[remote] = m
+	}
+	return m
+}
+
+// sync clones the mirror if it doesn't exist yet, or fetches if it is older
+// than the refresh interval.
+func (m *gitMirror) sync(ctx context.Context, refresh time.Duration) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if !m.fetchedAt.IsZero() && time.Since(m.fetchedAt) < refresh {
+		return nil
+	}
+
+	if _, err := os.Stat(m.dir); errors.Is(err, os.ErrNotExist) {
+		if _, err := runGit(ctx, "", "clone", "--mirror", "--quiet", m.remote, m.dir); err != nil {
+			return err
+		}
+	} else {
+		if _, err := runGit(ctx, m.dir, "fetch", "--prune", "--prune-tags", "--quiet", "origin"); err != nil {
+			return err
+		}
+	}
+
+	m.fetchedAt = time.Now()
+	return nil
+}
+
+// archive writes a tarball of the ref to a temporary file in dir. The mirror
+// is only locked while git runs, not while the caller streams the file, which
+// is removed on Close.
+func (m *gitMirror) archive(ctx context.Context, dir, ref string) (io.ReadCloser, error) {
+	f, err := os.CreateTemp(dir, "archive-*.tar.gz")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create archive file: %w", err)
+	}
+
+	m.mu.RLock()
+	err = runGitTo(ctx, m.dir, f, "archive", "--format=tar.gz", ref)
+	m.mu.RUnlock()
+	if err == nil {
+		_, err = f.Seek(0, io.SeekStart)
+	}
+	if err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return nil, err
+	}
+	return &tempFile{File: f}, nil
+}
+
+func runGit(ctx context.Context, dir string, args ...string) (string, error) {
+	var stdout bytes.Buffer
+	if err := runGitTo(ctx, dir, &stdout, args...); err != nil {
+		return "", err
+	}
+	return stdout.String(), nil
+}
+
+func runGitTo(ctx context.Context, dir string, stdout io.Writer, args ...string) error {
+	cmd := exec.CommandContext(ctx, "git", args...)
+	cmd.Dir = dir
+	cmd.Env = append(os.Environ(), "GIT_TERMINAL_PROMPT=0")
+	var stderr bytes.Buffer
+	cmd.Stdout = stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("git %s failed: %w: %s", args[0], err, strings.TrimSpace(stderr.String()))
+	}
+	return nil
+}
+
+// tempFile is a temporary file removed on Close.
+type tempFile struct {
+	*os.File
+}
+
+func (f *tempFile) Close() error {
+	err := f.File.Close()
+	if rerr := os.Remove(f.Name()); rerr != nil && err == nil {
+		err = rerr
+	}
+	return err
+}
+
+func moduleAddr(namespace, name, system string) string {
+	return fmt.Sprintf("%s/%s/%s", namespace, name, system)
+}
+
+// parseModuleFileName is the inverse of moduleFileName.
+func parseModuleFileName(fileName string) (string, string, bool) {
+	parts := strings.Split(fileName, ":")
+	if len(parts) != 3 || !strings.HasPrefix(parts[2], "module-archive.") {
+		return "", "", false
+	}
+	return parts[0], parts[1], true
+}
+
+// parseModulePkg is the inverse of modulePkg. Systems can't contain dashes,
+// so the first dash after the prefix separates system and name.
+func parseModulePkg(pkg string) (string, string, bool) {
+	rest, ok := strings.CutPrefix(pkg, "terraform-")
+	if !ok {
+		return "", "", false
+	}
+	system, name, ok := strings.Cut(rest, "-")
+	if !ok || system == "" || name == "" {
+		return "", "", false
+	}
+	return name, system, true
+}
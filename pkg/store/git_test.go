@@ -0,0 +1,179 @@
+package store
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"context"
+	"errors"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+// newGitRemote creates a repository with a commit per tag, each writing the
+// tag into main.tf.
+func newGitRemote(t *testing.T, tags ...string) string {
+	t.Helper()
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not on PATH")
+	}
+
+	dir := t.TempDir()
+	git := func(args ...string) {
+		t.Helper()
+		cmd := exec.Command("git", args...)
+		cmd.Dir = dir
+		cmd.Env = append(os.Environ(),
+			"GIT_AUTHOR_NAME=test", "GIT_AUTHOR_EMAIL=test@example.com",
+			"GIT_COMMITTER_NAME=test", "GIT_COMMITTER_EMAIL=test@example.com")
+		if out, err := cmd.CombinedOutput(); err != nil {
+			t.Fatalf("git %v: %v: %s", args, err, out)
+		}
+	}
+	git("init", "--quiet")
+	for _, tag := range tags {
+		if err := os.WriteFile(filepath.Join(dir, "main.tf"), []byte("# "+tag+"\n"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		git("add", "main.tf")
+		git("commit", "--quiet", "-m", tag)
+		git("tag", tag)
+	}
+	return dir
+}
+
+func TestGitModules(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	remote := newGitRemote(t, "v1.0.0", "1.1.0", "latest", "v2.0")
+
+	for _, serveArchives := range []bool{false, true} {
+		g, err := NewGitModules(&GitConfig{
+			Repos:         map[string]string{"acme/network/aws": remote},
+			CacheDir:      t.TempDir(),
+			ServeArchives: serveArchives,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		vs, err := g.ListModuleVersions(ctx, "acme", "network", "aws")
+		if err != nil {
+			t.Fatalf("ListModuleVersions: %v", err)
+		}
+		var got []string
+		for _, v := range vs {
+			got = append(got, v.Version)
+		}
+		slices.Sort(got)
+		if want := []string{"1.0.0", "1.1.0"}; !slices.Equal(got, want) {
+			t.Errorf("ListModuleVersions: got %v, want %v", got, want)
+		}
+
+		v, err := g.GetModuleVersion(ctx, "acme", "network", "aws", "1.1.0")
+		if err != nil {
+			t.Fatalf("GetModuleVersion: %v", err)
+		}
+		want := "git::" + remote + "?ref=1.1.0"
+		if serveArchives {
+			want = moduleSourceURL("acme", "terraform-aws-network:1.1.0:module-archive.tar.gz", "tar.gz")
+		}
+		if v.SourceURL != want {
+			t.Errorf("GetModuleVersion(serveArchives=%t): got source %q, want %q", serveArchives, v.SourceURL, want)
+		}
+
+		if _, err := g.GetModuleVersion(ctx, "acme", "network", "aws", "3.0.0"); err == nil {
+			t.Error("GetModuleVersion of a missing version: got no error")
+		}
+		if _, err := g.ListModuleVersions(ctx, "acme", "missing", "aws"); err == nil {
+			t.Error("ListModuleVersions of an unconfigured module without fallback: got no error")
+		}
+	}
+}
+
+func TestGitModulesArchive(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	remote := newGitRemote(t, "v1.0.0", "v1.1.0")
+	cacheDir := t.TempDir()
+	g, err := NewGitModules(&GitConfig{
+		Repos:         map[string]string{"acme/network/aws": remote},
+		CacheDir:      cacheDir,
+		ServeArchives: true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r, err := g.GetModuleArchive(ctx, "acme", "terraform-aws-network:1.0.0:module-archive.tar.gz")
+	if err != nil {
+		t.Fatalf("GetModuleArchive: %v", err)
+	}
+	main, err := readTarGzFile(r, "main.tf")
+	if err != nil {
+		t.Fatalf("reading archive: %v", err)
+	}
+	if err := r.Close(); err != nil {
+		t.Errorf("Close: %v", err)
+	}
+	if got, want := string(main), "# v1.0.0\n"; got != want {
+		t.Errorf("main.tf: got %q, want %q", got, want)
+	}
+
+	// The archive is built in a temporary file removed on Close.
+	matches, err := filepath.Glob(filepath.Join(cacheDir, "archive-*"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(matches) > 0 {
+		t.Errorf("archive files left after Close: %v", matches)
+	}
+
+	if _, err := g.GetModuleArchive(ctx, "acme", "terraform-aws-network:9.9.9:module-archive.tar.gz"); err == nil {
+		t.Error("GetModuleArchive of a missing version: got no error")
+	}
+	if _, err := g.OpenModuleArchive(ctx, "acme", "terraform-aws-network:1.0.0:module-archive.tar.gz"); !errors.Is(err, errors.ErrUnsupported) {
+		t.Errorf("OpenModuleArchive: got %v, want errors.ErrUnsupported", err)
+	}
+}
+
+func TestGitSourceURL(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		remote string
+		want   string
+	}{
+		{"https://example.com/network.git", "git::https://example.com/network.git?ref=v1.0.0"},
+		{"https://example.com/network.git?depth=1", "git::https://example.com/network.git?depth=1&ref=v1.0.0"},
+		{"https://example.com/network.git?ref=main", "git::https://example.com/network.git?ref=v1.0.0"},
+		{"git@example.com:acme/network.git", "git::git@example.com:acme/network.git?ref=v1.0.0"},
+	}
+	for _, tc := range cases {
+		if got := gitSourceURL(tc.remote, "v1.0.0"); got != tc.want {
+			t.Errorf("gitSourceURL(%q): got %q, want %q", tc.remote, got, tc.want)
+		}
+	}
+}
+
+func readTarGzFile(r io.Reader, name string) ([]byte, error) {
+	gr, err := gzip.NewReader(r)
+	if err != nil {
+		return nil, err
+	}
+	tr := tar.NewReader(gr)
+	for {
+		h, err := tr.Next()
+		if err != nil {
+			return nil, err
+		}
+		if h.Name == name {
+			return io.ReadAll(tr)
+		}
+	}
+}
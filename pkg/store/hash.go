@@ -0,0 +1,50 @@
+package store
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+
+	"golang.org/x/mod/sumdb/dirhash"
+)
+
+// providerHashAnnotation is the version annotation caching the "h1:" hash of
+// a provider platform package.
+const providerHashAnnotation = "terraform.h1"
+
+// packageHashV1 computes the "h1:" hash of a provider zip, a hash over the
+// files inside the archive rather than the archive itself.
+func packageHashV1(ctx context.Context, open openFunc, fileName string) (string, error) {
+	r, err := open(ctx, fileName)
+	if err != nil {
+		return "", err
+	}
+	defer r.Close()
+
+	// Reading a zip requires random access.
+	tmp, err := os.CreateTemp("", "provider-*.zip")
+	if err != nil {
+		return "", fmt.Errorf("failed to create temporary file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	if _, err := io.Copy(tmp, r); err != nil {
+		return "", fmt.Errorf("failed to read %s: %w", fileName, err)
+	}
+	if err := tmp.Close(); err != nil {
+		return "", fmt.Errorf("failed to write %s: %w", fileName, err)
+	}
+
+	h, err := dirhash.HashZip(tmp.Name(), dirhash.Hash1)
+	if err != nil {
+		return "", fmt.Errorf("failed to hash %s: %w", fileName, err)
+	}
+	return h, nil
+}
+
+// providerBinaryName is the file name of a provider platform package.
+func providerBinaryName(pkg, name, version, os, arch string) string {
+	return providerFileNamePrefix(pkg, name, fullVersion(version, os, arch), version) + fmt.Sprintf("_%s_%s.zip", os, arch)
+}
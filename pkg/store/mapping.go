@@ -0,0 +1,156 @@
+package store
+
+import (
+	"fmt"
+	"maps"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/yolocs/ar-terraform-registry/pkg/model"
+)
+
+const (
+	defaultModulePackage   = "terraform-{system}-{name}"
+	defaultProviderPackage = "{name}"
+)
+
+// Mapping translates registry addresses into store locations. Stores look up
+// backend resources with the mapped repository and package, while the URLs
+// they hand out keep the public namespace so that they route back to the
+// same store.
+//
+// A nil Mapping uses namespaces verbatim as repositories and the default
+// package naming.
+type Mapping struct {
+	// Repositories maps public namespaces to repository IDs. Namespaces not in
+	// the map are used verbatim.
+	Repositories map[string]string
+	// ModulePackage is the package name template for modules. It supports the
+	// "{namespace}", "{name}" and "{system}" placeholders and defaults to
+	// "terraform-{system}-{name}".
+	ModulePackage string
+	// ProviderPackage is the package name template for providers. It supports
+	// the "{namespace}" and "{name}" placeholders and defaults to "{name}".
+	ProviderPackage string
+}
+
+// Validate checks the templates and repositories identify packages uniquely.
+func (m *Mapping) Validate() error {
+	if m == nil {
+		return nil
+	}
+	if t := m.ModulePackage; t != "" && (!strings.Contains(t, "{name}") || !strings.Contains(t, "{system}")) {
+		return fmt.Errorf("module package template %q must contain {name} and {system}", t)
+	}
+	if t := m.ProviderPackage; t != "" && !strings.Contains(t, "{name}") {
+		return fmt.Errorf("provider package template %q must contain {name}", t)
+	}
+	// Namespace reverses the mapping, so repositories can't be shared.
+	namespaces := make(map[string]string, len(m.Repositories))
+	for _, ns := range slices.Sorted(maps.Keys(m.Repositories)) {
+		repo := m.Repositories[ns]
+		if ns == "" || repo == "" || strings.Contains(repo, "/") {
+			return fmt.Errorf("invalid repository mapping %q => %q", ns, repo)
+		}
+		if other, ok := namespaces[repo]; ok {
+			return fmt.Errorf("namespaces %q and %q are both mapped to repository %q", other, ns, repo)
+		}
+		namespaces[repo] = ns
+	}
+	return nil
+}
+
+// Repository returns the repository holding the namespace.
+func (m *Mapping) Repository(namespace string) string {
+	if m != nil {
+		if repo, ok := m.Repositories[namespace]; ok {
+			return repo
+		}
+	}
+	return namespace
+}
+
+// ModulePkg returns the package holding the module.
+func (m *Mapping) ModulePkg(namespace, name, system string) string {
+	t := defaultModulePackage
+	if m != nil && m.ModulePackage != "" {
+		t = m.ModulePackage
+	}
+	return strings.NewReplacer("{namespace}", namespace, "{name}", name, "{system}", system).Replace(t)
+}
+
+// ProviderPkg returns the package holding the provider.
+func (m *Mapping) ProviderPkg(namespace, name string) string {
+	t := defaultProviderPackage
+	if m != nil && m.ProviderPackage != "" {
+		t = m.ProviderPackage
+	}
+	return strings.NewReplacer("{namespace}", namespace, "{name}", name).Replace(t)
+}
+
+// Package returns the package holding a provider or module.
+func (m *Mapping) Package(namespace string, ref *model.PackageRef) string {
+	if ref.Kind == model.KindModule {
+		return m.ModulePkg(namespace, ref.Name, ref.System)
+	}
+	return m.ProviderPkg(namespace, ref.Name)
+}
+
+// Namespace returns the public namespace of a repository, the inverse of
+// Repository.
+func (m *Mapping) Namespace(repo string) string {
+	if m != nil {
+		for ns, r := range m.Repositories {
+			if r == repo {
+				return ns
+			}
+		}
+	}
+	return repo
+}
+
+// ParsePackage identifies the provider or module held by a package, the
+// inverse of ModulePkg and ProviderPkg. Packages matching the module template
+// are modules.
+func (m *Mapping) ParsePackage(namespace, pkg string) (*model.PackageRef, bool) {
+	mt, pt := defaultModulePackage, defaultProviderPackage
+	if m != nil && m.ModulePackage != "" {
+		mt = m.ModulePackage
+	}
+	if m != nil && m.ProviderPackage != "" {
+		pt = m.ProviderPackage
+	}
+
+	if v, ok := matchTemplate(mt, namespace, pkg); ok {
+		return &model.PackageRef{Kind: model.KindModule, Name: v["name"], System: v["system"]}, true
+	}
+	if v, ok := matchTemplate(pt, namespace, pkg); ok {
+		return &model.PackageRef{Kind: model.KindProvider, Name: v["name"]}, true
+	}
+	return nil, false
+}
+
+// matchTemplate extracts the placeholders of a package name template. Systems
+// can't contain dashes.
+func matchTemplate(t, namespace, pkg string) (map[string]string, bool) {
+	expr := regexp.QuoteMeta(t)
+	expr = strings.ReplaceAll(expr, regexp.QuoteMeta("{namespace}"), regexp.QuoteMeta(namespace))
+	expr = strings.ReplaceAll(expr, regexp.QuoteMeta("{system}"), `(?P<system>[a-z0-9]+)`)
+	expr = strings.ReplaceAll(expr, regexp.QuoteMeta("{name}"), `(?P<name>.+)`)
+	re, err := regexp.Compile("^" + expr + "$")
+	if err != nil {
+		return nil, false
+	}
+	match := re.FindStringSubmatch(pkg)
+	if match == nil {
+		return nil, false
+	}
+	v := make(map[string]string)
+	for i, n := range re.SubexpNames() {
+		if n != "" {
+			v[n] = match[i]
+		}
+	}
+	return v, true
+}
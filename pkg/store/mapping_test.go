@@ -0,0 +1,26 @@
+package store
+
+import "testing"
+
+func TestMappingValidate(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		name    string
+		m       *Mapping
+		wantErr bool
+	}{
+		{name: "nil", m: nil},
+		{name: "repositories", m: &Mapping{Repositories: map[string]string{"acme": "acme-tf", "corp": "corp-tf"}}},
+		{name: "shared repository", m: &Mapping{Repositories: map[string]string{"acme": "shared", "corp": "shared"}}, wantErr: true},
+		{name: "empty repository", m: &Mapping{Repositories: map[string]string{"acme": ""}}, wantErr: true},
+		{name: "nested repository", m: &Mapping{Repositories: map[string]string{"acme": "a/b"}}, wantErr: true},
+		{name: "module template without system", m: &Mapping{ModulePackage: "{name}"}, wantErr: true},
+		{name: "provider template without name", m: &Mapping{ProviderPackage: "provider"}, wantErr: true},
+	}
+	for _, tc := range cases {
+		if err := tc.m.Validate(); (err != nil) != tc.wantErr {
+			t.Errorf("%s: got error %v, want error %t", tc.name, err, tc.wantErr)
+		}
+	}
+}
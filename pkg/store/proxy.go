@@ -0,0 +1,245 @@
+package store
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+
+	"github.com/yolocs/ar-terraform-registry/pkg/model"
+)
+
+type ProxyConfig struct {
+	// URL is the base URL of the upstream registry, e.g.
+	// "https://registry.terraform.io".
+	URL string
+	// Client is the HTTP client used to talk to the upstream registry. It
+	// defaults to http.DefaultClient.
+	Client *http.Client
+	// Mapping maps public namespaces to upstream namespaces. Package templates
+	// don't apply to upstream registries.
+	Mapping *Mapping
+}
+
+// Proxy is a read-only store that resolves providers and modules from an
+// upstream registry speaking the Terraform registry protocols. Download URLs
+// point at the upstream, so assets are never served through this store.
+type Proxy struct {
+	base    *url.URL
+	client  *http.Client
+	mapping *Mapping
+
+	mu        sync.Mutex
+	discovery *proxyDiscovery
+}
+
+type proxyDiscovery struct {
+	modules   *url.URL
+	providers *url.URL
+}
+
+func NewProxy(cfg *ProxyConfig) (*Proxy, error) {
+	base, err := url.Parse(cfg.URL)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse upstream registry URL: %w", err)
+	}
+	if !base.IsAbs() {
+		return nil, fmt.Errorf("upstream registry URL %q must be absolute", cfg.URL)
+	}
+
+	client := cfg.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	if err := cfg.Mapping.Validate(); err != nil {
+		return nil, err
+	}
+	return &Proxy{base: base, client: client, mapping: cfg.Mapping}, nil
+}
+
+// CheckHealth runs service discovery against the upstream registry.
+func (p *Proxy) CheckHealth(ctx context.Context) error {
+	_, err := p.discover(ctx)
+	return err
+}
+
+func (p *Proxy) ListProviderVersions(ctx context.Context, namespace string, name string) (*model.ProviderVersions, error) {
+	d, err := p.discover(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var vs model.ProviderVersions
+	if _, err := p.getJSON(ctx, d.providers, fmt.Sprintf("%s/%s/versions", p.mapping.Repository(namespace), name), &vs); err != nil {
+		return nil, err
+	}
+	return &vs, nil
+}
+
+func (p *Proxy) GetProviderVersion(ctx context.Context, namespace string, name string, version string, os string, arch string) (*model.Provider, error) {
+	d, err := p.discover(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var provider model.Provider
+	u, err := p.getJSON(ctx, d.providers, fmt.Sprintf("%s/%s/%s/download/%s/%s", p.mapping.Repository(namespace), name, version, os, arch), &provider)
+	if err != nil {
+		return nil, err
+	}
+
+	// The protocol allows relative URLs, which must resolve against upstream.
+	provider.DownloadURL = resolveURL(u, provider.DownloadURL)
+	provider.SHASumsURL = resolveURL(u, provider.SHASumsURL)
+	provider.SHASumsSignatureURL = resolveURL(u, provider.SHASumsSignatureURL)
+	return &provider, nil
+}
+
+func (p *Proxy) GetProviderAsset(ctx context.Context, namespace string, fileName string) (io.ReadCloser, error) {
+	return nil, fmt.Errorf("proxy store does not serve assets: %w", errors.ErrUnsupported)
+}
+
+func (p *Proxy) ListModuleVersions(ctx context.Context, namespace, name, system string) ([]*model.ModuleVersion, error) {
+	d, err := p.discover(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var resp struct {
+		Modules []struct {
+			Versions []struct {
+				Version string `json:"version"`
+			} `json:"versions"`
+		} `json:"modules"`
+	}
+	if _, err := p.getJSON(ctx, d.modules, fmt.Sprintf("%s/%s/%s/versions", p.mapping.Repository(namespace), name, system), &resp); err != nil {
+		return nil, err
+	}
+
+	var vs []*model.ModuleVersion
+	for _, m := range resp.Modules {
+		for _, v := range m.Versions {
+			vs = append(vs, &model.ModuleVersion{Version: v.Version})
+		}
+	}
+	return vs, nil
+}
+
+func (p *Proxy) GetModuleVersion(ctx context.Context, namespace, name, system, version string) (*model.ModuleVersion, error) {
+	d, err := p.discover(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	u := d.modules.JoinPath(p.mapping.Repository(namespace), name, system, version, "download")
+	resp, err := p.do(ctx, u)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	src := resp.Header.Get("X-Terraform-Get")
+	if src == "" {
+		return nil, fmt.Errorf("upstream returned no X-Terraform-Get for %s", u)
+	}
+	return &model.ModuleVersion{
+		Version:   version,
+		SourceURL: resolveGetterSource(u, src),
+	}, nil
+}
+
+func (p *Proxy) GetModuleArchive(ctx context.Context, namespace, fileName string) (io.ReadCloser, error) {
+	return nil, fmt.Errorf("proxy store does not serve module archives: %w", errors.ErrUnsupported)
+}
+
+// discover runs and caches service discovery against the upstream registry.
+func (p *Proxy) discover(ctx context.Context) (*proxyDiscovery, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.discovery != nil {
+		return p.discovery, nil
+	}
+
+	var spec struct {
+		ModulesV1   string `json:"modules.v1"`
+		ProvidersV1 string `json:"providers.v1"`
+	}
+	u, err := p.getJSON(ctx, p.base, ".well-known/terraform.json", &spec)
+	if err != nil {
+		return nil, fmt.Errorf("failed to discover upstream services: %w", err)
+	}
+
+	d := &proxyDiscovery{}
+	if d.modules, err = u.Parse(spec.ModulesV1); err != nil {
+		return nil, fmt.Errorf("invalid upstream modules.v1 %q: %w", spec.ModulesV1, err)
+	}
+	if d.providers, err = u.Parse(spec.ProvidersV1); err != nil {
+		return nil, fmt.Errorf("invalid upstream providers.v1 %q: %w", spec.ProvidersV1, err)
+	}
+	p.discovery = d
+	return d, nil
+}
+
+// getJSON decodes the response of the endpoint relative to base into v and
+// returns the URL that was requested.
+func (p *Proxy) getJSON(ctx context.Context, base *url.URL, ref string, v any) (*url.URL, error) {
+	u, err := base.Parse(ref)
+	if err != nil {
+		return nil, fmt.Errorf("failed to build upstream URL: %w", err)
+	}
+
+	resp, err := p.do(ctx, u)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+		return nil, fmt.Errorf("failed to decode upstream response from %s: %w", u, err)
+	}
+	return u, nil
+}
+
+func (p *Proxy) do(ctx context.Context, u *url.URL) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create upstream request: %w", err)
+	}
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to execute upstream request: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusNoContent {
+		resp.Body.Close()
+		return nil, fmt.Errorf("unexpected upstream status code %d from %s", resp.StatusCode, u)
+	}
+	return resp, nil
+}
+
+func resolveURL(base *url.URL, ref string) string {
+	if ref == "" {
+		return ""
+	}
+	u, err := base.Parse(ref)
+	if err != nil {
+		return ref
+	}
+	return u.String()
+}
+
+// resolveGetterSource resolves X-Terraform-Get values the way Terraform does:
+// only values that look like relative URLs are resolved, since the header is a
+// go-getter address which is not necessarily a URL.
+func resolveGetterSource(base *url.URL, src string) string {
+	if strings.HasPrefix(src, "/") || strings.HasPrefix(src, "./") || strings.HasPrefix(src, "../") {
+		return resolveURL(base, src)
+	}
+	return src
+}
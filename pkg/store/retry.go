@@ -0,0 +1,162 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"net"
+	"net/http"
+	"syscall"
+	"time"
+
+	ar "cloud.google.com/go/artifactregistry/apiv1"
+	"github.com/googleapis/gax-go/v2"
+	"google.golang.org/api/option"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+)
+
+// RetryConfig is the retry and timeout policy for calls to Artifact Registry.
+// Zero values use the defaults.
+type RetryConfig struct {
+	// MaxAttempts is the total number of attempts per call. Defaults to 4.
+	MaxAttempts int
+	// InitialBackoff is the pause before the first retry. It doubles with
+	// every retry, up to MaxBackoff, with full jitter. Defaults to 200ms and
+	// 5s.
+	InitialBackoff time.Duration
+	MaxBackoff     time.Duration
+	// Timeout bounds each attempt. For downloads it covers receiving the
+	// response headers, not streaming the body. Defaults to 30s.
+	Timeout time.Duration
+}
+
+func (c *RetryConfig) withDefaults() RetryConfig {
+	var r RetryConfig
+	if c != nil {
+		r = *c
+	}
+	if r.MaxAttempts <= 0 {
+		r.MaxAttempts = 4
+	}
+	if r.InitialBackoff <= 0 {
+		r.InitialBackoff = 200 * time.Millisecond
+	}
+	if r.MaxBackoff <= 0 {
+		r.MaxBackoff = 5 * time.Second
+	}
+	if r.Timeout <= 0 {
+		r.Timeout = 30 * time.Second
+	}
+	return r
+}
+
+// backoff returns the jittered pause before the given retry (starting at 1).
+func (c RetryConfig) backoff(retry int) time.Duration {
+	d := c.InitialBackoff << (retry - 1)
+	if d <= 0 || d > c.MaxBackoff {
+		d = c.MaxBackoff
+	}
+	return rand.N(d) + 1
+}
+
+// retryableCodes are the transient gRPC errors worth retrying. Attempts
+// timing out report DeadlineExceeded; gax stops retrying once the caller's
+// context is done.
+var retryableCodes = []codes.Code{
+	codes.DeadlineExceeded,
+	codes.Unavailable,
+	codes.ResourceExhausted,
+	codes.Aborted,
+	codes.Internal,
+}
+
+// NewArtifactRegistryClient creates an Artifact Registry client whose read
+// calls are retried with the policy. gax only supports a deadline for the
+// whole call, so Timeout is applied to each attempt by a gRPC interceptor; the
+// whole call is bounded by the caller's context.
+func NewArtifactRegistryClient(ctx context.Context, cfg *RetryConfig) (*ar.Client, error) {
+	c := cfg.withDefaults()
+	client, err := ar.NewClient(ctx, option.WithGRPCDialOption(grpc.WithChainUnaryInterceptor(attemptTimeout(c.Timeout))))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create artifact registry client: %w", err)
+	}
+
+	opts := []gax.CallOption{
+		gax.WithRetry(func() gax.Retryer {
+			return &attemptRetryer{
+				Retryer: gax.OnCodes(retryableCodes, gax.Backoff{
+					Initial:    c.InitialBackoff,
+					Max:        c.MaxBackoff,
+					Multiplier: 2,
+				}),
+				left: c.MaxAttempts - 1,
+			}
+		}),
+	}
+
+	co := client.CallOptions
+	co.ListRepositories = opts
+	co.GetRepository = opts
+	co.ListPackages = opts
+	co.GetPackage = opts
+	co.ListVersions = opts
+	co.GetVersion = opts
+	co.ListFiles = opts
+	co.GetFile = opts
+	co.ListTags = opts
+	return client, nil
+}
+
+// attemptTimeout bounds every attempt of a unary call, including retries.
+func attemptTimeout(d time.Duration) grpc.UnaryClientInterceptor {
+	return func(ctx context.Context, method string, req, reply any, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		ctx, cancel := context.WithTimeout(ctx, d)
+		defer cancel()
+		return invoker(ctx, method, req, reply, cc, opts...)
+	}
+}
+
+// attemptRetryer caps the number of retries of a gax retryer.
+type attemptRetryer struct {
+	gax.Retryer
+	left int
+}
+
+func (r *attemptRetryer) Retry(err error) (time.Duration, bool) {
+	if r.left <= 0 {
+		return 0, false
+	}
+	r.left--
+	return r.Retryer.Retry(err)
+}
+
+// retryableStatus reports whether an HTTP status is transient.
+func retryableStatus(code int) bool {
+	switch code {
+	case http.StatusTooManyRequests,
+		http.StatusInternalServerError,
+		http.StatusBadGateway,
+		http.StatusServiceUnavailable,
+		http.StatusGatewayTimeout:
+		return true
+	}
+	return false
+}
+
+// retryableError reports whether a transport error is transient. Errors
+// caused by the caller's context are not.
+func retryableError(ctx context.Context, err error) bool {
+	if ctx.Err() != nil {
+		return false
+	}
+	var netErr net.Error
+	return errors.Is(err, syscall.ECONNRESET) ||
+		errors.Is(err, syscall.ECONNREFUSED) ||
+		errors.Is(err, io.ErrUnexpectedEOF) ||
+		errors.Is(err, io.EOF) ||
+		errors.Is(err, context.DeadlineExceeded) ||
+		(errors.As(err, &netErr) && netErr.Timeout())
+}
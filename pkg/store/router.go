@@ -0,0 +1,394 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"slices"
+	"strings"
+	"sync/atomic"
+
+	"github.com/yolocs/ar-terraform-registry/pkg/model"
+)
+
+// Route sends the namespaces matching Namespace to a backend.
+type Route struct {
+	// Namespace is a path.Match pattern, e.g. "acme-*" or "*".
+	Namespace string
+	Providers model.ProviderStore
+	Modules   model.ModuleStore
+}
+
+// Router is a store that dispatches each call to the first route whose
+// pattern matches the namespace, so one registry host can front several
+// backends.
+type Router struct {
+	routes atomic.Pointer[[]*Route]
+}
+
+func NewRouter(routes []*Route) (*Router, error) {
+	rt := &Router{}
+	if err := rt.SetRoutes(routes); err != nil {
+		return nil, err
+	}
+	return rt, nil
+}
+
+// SetRoutes atomically replaces the routes. Calls already dispatched keep
+// using the backend they were routed to.
+func (rt *Router) SetRoutes(routes []*Route) error {
+	for _, r := range routes {
+		if _, err := path.Match(r.Namespace, ""); err != nil {
+			return fmt.Errorf("invalid namespace pattern %q: %w", r.Namespace, err)
+		}
+		if r.Providers == nil && r.Modules == nil {
+			return fmt.Errorf("route %q has no backend", r.Namespace)
+		}
+	}
+	rt.routes.Store(&routes)
+	return nil
+}
+
+func (rt *Router) ListProviderVersions(ctx context.Context, namespace string, name string) (*model.ProviderVersions, error) {
+	ps, err := rt.providers(namespace)
+	if err != nil {
+		return nil, err
+	}
+	return ps.ListProviderVersions(ctx, namespace, name)
+}
+
+func (rt *Router) GetProviderVersion(ctx context.Context, namespace string, name string, version string, os string, arch string) (*model.Provider, error) {
+	ps, err := rt.providers(namespace)
+	if err != nil {
+		return nil, err
+	}
+	return ps.GetProviderVersion(ctx, namespace, name, version, os, arch)
+}
+
+func (rt *Router) GetProviderAsset(ctx context.Context, namespace string, fileName string) (io.ReadCloser, error) {
+	ps, err := rt.providers(namespace)
+	if err != nil {
+		return nil, err
+	}
+	return ps.GetProviderAsset(ctx, namespace, fileName)
+}
+
+func (rt *Router) ListModuleVersions(ctx context.Context, namespace, name, system string) ([]*model.ModuleVersion, error) {
+	ms, err := rt.modules(namespace)
+	if err != nil {
+		return nil, err
+	}
+	return ms.ListModuleVersions(ctx, namespace, name, system)
+}
+
+func (rt *Router) GetModuleVersion(ctx context.Context, namespace, name, system, version string) (*model.ModuleVersion, error) {
+	ms, err := rt.modules(namespace)
+	if err != nil {
+		return nil, err
+	}
+	return ms.GetModuleVersion(ctx, namespace, name, system, version)
+}
+
+func (rt *Router) GetModuleArchive(ctx context.Context, namespace, fileName string) (io.ReadCloser, error) {
+	ms, err := rt.modules(namespace)
+	if err != nil {
+		return nil, err
+	}
+	return ms.GetModuleArchive(ctx, namespace, fileName)
+}
+
+// OpenProviderAsset returns errors.ErrUnsupported if the routed backend can't
+// open assets with metadata.
+func (rt *Router) OpenProviderAsset(ctx context.Context, namespace, fileName string) (*model.Asset, error) {
+	ps, err := rt.providers(namespace)
+	if err != nil {
+		return nil, err
+	}
+	opener, ok := ps.(model.ProviderAssetOpener)
+	if !ok {
+		return nil, fmt.Errorf("provider store for %q can't open assets: %w", namespace, errors.ErrUnsupported)
+	}
+	return opener.OpenProviderAsset(ctx, namespace, fileName)
+}
+
+// OpenModuleArchive returns errors.ErrUnsupported if the routed backend can't
+// open archives with metadata.
+func (rt *Router) OpenModuleArchive(ctx context.Context, namespace, fileName string) (*model.Asset, error) {
+	ms, err := rt.modules(namespace)
+	if err != nil {
+		return nil, err
+	}
+	opener, ok := ms.(model.ModuleArchiveOpener)
+	if !ok {
+		return nil, fmt.Errorf("module store for %q can't open archives: %w", namespace, errors.ErrUnsupported)
+	}
+	return opener.OpenModuleArchive(ctx, namespace, fileName)
+}
+
+// ProviderPackageHash returns errors.ErrUnsupported if the routed backend
+// can't compute package hashes.
+func (rt *Router) ProviderPackageHash(ctx context.Context, namespace, name, version, os, arch string) (string, error) {
+	ps, err := rt.providers(namespace)
+	if err != nil {
+		return "", err
+	}
+	h, ok := ps.(model.ProviderHasher)
+	if !ok {
+		return "", fmt.Errorf("provider store for %q can't compute package hashes: %w", namespace, errors.ErrUnsupported)
+	}
+	return h.ProviderPackageHash(ctx, namespace, name, version, os, arch)
+}
+
+// PutProviderFile returns errors.ErrUnsupported if the routed backend is
+// read-only.
+func (rt *Router) PutProviderFile(ctx context.Context, namespace, name, version, os, arch, fileName string, r io.Reader) error {
+	ps, err := rt.providers(namespace)
+	if err != nil {
+		return err
+	}
+	w, ok := ps.(model.ProviderWriter)
+	if !ok {
+		return fmt.Errorf("provider store for %q is read-only: %w", namespace, errors.ErrUnsupported)
+	}
+	return w.PutProviderFile(ctx, namespace, name, version, os, arch, fileName, r)
+}
+
+// PutModuleArchive returns errors.ErrUnsupported if the routed backend is
+// read-only.
+func (rt *Router) PutModuleArchive(ctx context.Context, namespace, name, system, version, format, subdir string, r io.Reader) error {
+	ms, err := rt.modules(namespace)
+	if err != nil {
+		return err
+	}
+	w, ok := ms.(model.ModuleWriter)
+	if !ok {
+		return fmt.Errorf("module store for %q is read-only: %w", namespace, errors.ErrUnsupported)
+	}
+	return w.PutModuleArchive(ctx, namespace, name, system, version, format, subdir, r)
+}
+
+// PutModuleMetadata returns errors.ErrUnsupported if the routed backend
+// doesn't keep metadata.
+func (rt *Router) PutModuleMetadata(ctx context.Context, namespace, name, system, version string, md *model.ModuleMetadata) error {
+	ms, err := rt.modules(namespace)
+	if err != nil {
+		return err
+	}
+	w, ok := ms.(model.ModuleMetadataWriter)
+	if !ok {
+		return fmt.Errorf("module store for %q doesn't keep metadata: %w", namespace, errors.ErrUnsupported)
+	}
+	return w.PutModuleMetadata(ctx, namespace, name, system, version, md)
+}
+
+// GetModuleMetadata returns errors.ErrUnsupported if the routed backend
+// doesn't keep metadata.
+func (rt *Router) GetModuleMetadata(ctx context.Context, namespace, name, system, version string) (*model.ModuleMetadata, error) {
+	ms, err := rt.modules(namespace)
+	if err != nil {
+		return nil, err
+	}
+	r, ok := ms.(model.ModuleMetadataReader)
+	if !ok {
+		return nil, fmt.Errorf("module store for %q doesn't keep metadata: %w", namespace, errors.ErrUnsupported)
+	}
+	return r.GetModuleMetadata(ctx, namespace, name, system, version)
+}
+
+// ListNamespaces lists the namespaces of the backends that can enumerate
+// them, keeping those routed back to the backend holding them.
+func (rt *Router) ListNamespaces(ctx context.Context) ([]string, error) {
+	var namespaces []string
+	seen := make(map[any]bool)
+	for _, r := range *rt.routes.Load() {
+		for _, b := range []any{r.Providers, r.Modules} {
+			c, ok := b.(model.Catalog)
+			if !ok || seen[b] {
+				continue
+			}
+			seen[b] = true
+
+			ns, err := c.ListNamespaces(ctx)
+			if err != nil {
+				return nil, err
+			}
+			for _, n := range ns {
+				if slices.Contains(namespaces, n) {
+					continue
+				}
+				ps, _ := rt.providers(n)
+				ms, _ := rt.modules(n)
+				if any(ps) == b || any(ms) == b {
+					namespaces = append(namespaces, n)
+				}
+			}
+		}
+	}
+	slices.Sort(namespaces)
+	return namespaces, nil
+}
+
+// ListPackages lists the providers of the namespace's provider backend and the
+// modules of its module backend.
+func (rt *Router) ListPackages(ctx context.Context, namespace string) ([]*model.PackageRef, error) {
+	ps, _ := rt.providers(namespace)
+	ms, _ := rt.modules(namespace)
+
+	var refs []*model.PackageRef
+	var found bool
+	listed := make(map[any][]*model.PackageRef)
+	for _, role := range []struct {
+		kind    string
+		backend any
+	}{
+		{kind: model.KindProvider, backend: ps},
+		{kind: model.KindModule, backend: ms},
+	} {
+		c, ok := role.backend.(model.Catalog)
+		if !ok {
+			continue
+		}
+		found = true
+		r, ok := listed[role.backend]
+		if !ok {
+			var err error
+			if r, err = c.ListPackages(ctx, namespace); err != nil {
+				return nil, err
+			}
+			listed[role.backend] = r
+		}
+		for _, ref := range r {
+			if ref.Kind == role.kind {
+				refs = append(refs, ref)
+			}
+		}
+	}
+	if !found {
+		return nil, fmt.Errorf("no backend for %q can list packages: %w", namespace, errors.ErrUnsupported)
+	}
+	slices.SortFunc(refs, func(a, b *model.PackageRef) int {
+		return strings.Compare(a.Kind+"/"+a.Name+"/"+a.System, b.Kind+"/"+b.Name+"/"+b.System)
+	})
+	return refs, nil
+}
+
+// CreateNamespace creates the namespace in its provider and module backends.
+// It returns model.ErrAlreadyExists only if it exists in all of them, and
+// errors.ErrUnsupported if none can be managed.
+func (rt *Router) CreateNamespace(ctx context.Context, namespace string) error {
+	ps, _ := rt.providers(namespace)
+	ms, _ := rt.modules(namespace)
+
+	var created, found bool
+	seen := make(map[any]bool)
+	for _, b := range []any{ps, ms} {
+		a, ok := b.(model.Admin)
+		if !ok || seen[b] {
+			continue
+		}
+		seen[b] = true
+		found = true
+		err := a.CreateNamespace(ctx, namespace)
+		if errors.Is(err, model.ErrAlreadyExists) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		created = true
+	}
+	if !found {
+		return fmt.Errorf("no backend for %q can be managed: %w", namespace, errors.ErrUnsupported)
+	}
+	if !created {
+		return fmt.Errorf("namespace %q: %w", namespace, model.ErrAlreadyExists)
+	}
+	return nil
+}
+
+func (rt *Router) ListVersions(ctx context.Context, namespace string, ref *model.PackageRef) ([]*model.VersionInfo, error) {
+	a, err := rt.admin(namespace, ref)
+	if err != nil {
+		return nil, err
+	}
+	return a.ListVersions(ctx, namespace, ref)
+}
+
+func (rt *Router) ListVersionFiles(ctx context.Context, namespace string, ref *model.PackageRef, version string) ([]*model.FileInfo, error) {
+	a, err := rt.admin(namespace, ref)
+	if err != nil {
+		return nil, err
+	}
+	return a.ListVersionFiles(ctx, namespace, ref, version)
+}
+
+func (rt *Router) DeletePackage(ctx context.Context, namespace string, ref *model.PackageRef) error {
+	a, err := rt.admin(namespace, ref)
+	if err != nil {
+		return err
+	}
+	return a.DeletePackage(ctx, namespace, ref)
+}
+
+func (rt *Router) DeleteVersion(ctx context.Context, namespace string, ref *model.PackageRef, version string) error {
+	a, err := rt.admin(namespace, ref)
+	if err != nil {
+		return err
+	}
+	return a.DeleteVersion(ctx, namespace, ref, version)
+}
+
+func (rt *Router) SetYanked(ctx context.Context, namespace string, ref *model.PackageRef, version string, yanked bool) error {
+	a, err := rt.admin(namespace, ref)
+	if err != nil {
+		return err
+	}
+	return a.SetYanked(ctx, namespace, ref, version, yanked)
+}
+
+// admin returns the backend holding the package if it can be managed, or
+// errors.ErrUnsupported.
+func (rt *Router) admin(namespace string, ref *model.PackageRef) (model.Admin, error) {
+	var (
+		b   any
+		err error
+	)
+	if ref.Kind == model.KindModule {
+		b, err = rt.modules(namespace)
+	} else {
+		b, err = rt.providers(namespace)
+	}
+	if err != nil {
+		return nil, err
+	}
+	a, ok := b.(model.Admin)
+	if !ok {
+		return nil, fmt.Errorf("%s store for %q can't be managed: %w", ref.Kind, namespace, errors.ErrUnsupported)
+	}
+	return a, nil
+}
+
+func (rt *Router) providers(namespace string) (model.ProviderStore, error) {
+	for _, r := range *rt.routes.Load() {
+		if r.Providers != nil && matchNamespace(r.Namespace, namespace) {
+			return r.Providers, nil
+		}
+	}
+	return nil, fmt.Errorf("no provider backend for namespace %q", namespace)
+}
+
+func (rt *Router) modules(namespace string) (model.ModuleStore, error) {
+	for _, r := range *rt.routes.Load() {
+		if r.Modules != nil && matchNamespace(r.Namespace, namespace) {
+			return r.Modules, nil
+		}
+	}
+	return nil, fmt.Errorf("no module backend for namespace %q", namespace)
+}
+
+func matchNamespace(pattern, namespace string) bool {
+	ok, _ := path.Match(pattern, namespace)
+	return ok
+}
@@ -0,0 +1,71 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	arapi "google.golang.org/api/artifactregistry/v1"
+	"google.golang.org/api/googleapi"
+	"google.golang.org/api/option"
+	"google.golang.org/grpc/codes"
+
+	"github.com/yolocs/ar-terraform-registry/pkg/model"
+)
+
+// operationPollInterval is how often an upload operation is checked.
+const operationPollInterval = time.Second
+
+// Uploader publishes files to generic repositories. Uploads are media
+// requests, which the gRPC client doesn't support.
+type Uploader struct {
+	svc *arapi.Service
+}
+
+func NewUploader(ctx context.Context) (*Uploader, error) {
+	svc, err := arapi.NewService(ctx, option.WithScopes(arapi.CloudPlatformScope))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create upload client: %w", err)
+	}
+	return &Uploader{svc: svc}, nil
+}
+
+// Upload stores r as the file of the package version in the repository,
+// given by its full resource name, and waits for the upload to complete.
+// Existing files are reported as model.ErrAlreadyExists.
+func (u *Uploader) Upload(ctx context.Context, repoName, pkg, version, fileName string, r io.Reader) error {
+	resp, err := u.svc.Projects.Locations.Repositories.GenericArtifacts.Upload(repoName, &arapi.UploadGenericArtifactRequest{
+		PackageId: pkg,
+		VersionId: version,
+		Filename:  fileName,
+	}).Media(r).Context(ctx).Do()
+	if err != nil {
+		var gerr *googleapi.Error
+		if errors.As(err, &gerr) && gerr.Code == http.StatusConflict {
+			return fmt.Errorf("%s: %w", fileName, model.ErrAlreadyExists)
+		}
+		return fmt.Errorf("failed to upload %s: %w", fileName, err)
+	}
+
+	op := resp.Operation
+	for op != nil && !op.Done {
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("failed to wait for upload of %s: %w", fileName, ctx.Err())
+		case <-time.After(operationPollInterval):
+		}
+		if op, err = u.svc.Projects.Locations.Operations.Get(op.Name).Context(ctx).Do(); err != nil {
+			return fmt.Errorf("failed to get upload operation of %s: %w", fileName, err)
+		}
+	}
+	if op != nil && op.Error != nil {
+		if codes.Code(op.Error.Code) == codes.AlreadyExists {
+			return fmt.Errorf("%s: %w", fileName, model.ErrAlreadyExists)
+		}
+		return fmt.Errorf("failed to upload %s: %s", fileName, op.Error.Message)
+	}
+	return nil
+}